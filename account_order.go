@@ -0,0 +1,66 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// orderAccounts returns accounts in the order given by -account-order:
+//
+//	api      as the API returned them, which can change between runs
+//	alpha    by name, case-insensitively
+//	config   as listed in configured (names or IDs), then the rest by name;
+//	         names matching none of accounts are ignored
+//	balance  by balance at the end of asOf, largest first
+func orderAccounts(client ActualClient, accounts []Account, order string, configured []string, asOf Date) ([]Account, error) {
+	sorted := slices.Clone(accounts)
+	byName := func(a, b Account) int {
+		return cmp.Or(strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), strings.Compare(a.ID, b.ID))
+	}
+	switch order {
+	case "", "api":
+	case "alpha":
+		slices.SortFunc(sorted, byName)
+	case "config":
+		rank := make(map[string]int)
+		for i, name := range configured {
+			account, err := findAccount(accounts, name)
+			if err != nil {
+				continue
+			}
+			if _, ok := rank[account.ID]; !ok {
+				rank[account.ID] = i
+			}
+		}
+		slices.SortFunc(sorted, func(a, b Account) int {
+			ra, aListed := rank[a.ID]
+			rb, bListed := rank[b.ID]
+			switch {
+			case aListed && bListed:
+				return cmp.Compare(ra, rb)
+			case aListed:
+				return -1
+			case bListed:
+				return 1
+			}
+			return byName(a, b)
+		})
+	case "balance":
+		balances := make(map[string]Money, len(accounts))
+		for _, account := range accounts {
+			resp, err := client.FetchBalance(account.ID, asOf.String())
+			if err != nil {
+				return nil, fmt.Errorf("fetching balance for account %s: %w", account.Name, err)
+			}
+			balances[account.ID] = resp.Data
+		}
+		slices.SortFunc(sorted, func(a, b Account) int {
+			return cmp.Or(cmp.Compare(balances[b.ID].Cents, balances[a.ID].Cents), byName(a, b))
+		})
+	default:
+		return nil, fmt.Errorf("unknown account order %q", order)
+	}
+	return sorted, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// AccountPatterns match accounts by name or ID. A pattern is either a glob
+// such as "Mortgage*", matched case-insensitively against the whole name, or
+// a regular expression between slashes such as /(?i)escrow|loan/.
+type AccountPatterns []*regexp.Regexp
+
+func ParseAccountPatterns(patterns []string) (AccountPatterns, error) {
+	var ps AccountPatterns
+	for _, p := range patterns {
+		expr := globRegexp(p)
+		if len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			expr = p[1 : len(p)-1]
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid account pattern %q: %w", p, err)
+		}
+		ps = append(ps, re)
+	}
+	return ps, nil
+}
+
+// globRegexp translates a glob with *, ? and [...] into an anchored,
+// case-insensitive regular expression.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			if end := slices.Index(runes[i:], ']'); end > 0 {
+				class := string(runes[i+1 : i+end])
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += end
+				continue
+			}
+			b.WriteString(`\[`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Match reports whether any pattern matches acct's name or ID.
+func (ps AccountPatterns) Match(acct Account) bool {
+	for _, re := range ps {
+		if re.MatchString(acct.Name) || re.MatchString(acct.ID) {
+			return true
+		}
+	}
+	return false
+}
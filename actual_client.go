@@ -1,124 +1,200 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
-// https://actualbudget.org/docs/api/reference
-
 type FetchAccountsResponse struct {
 	Data []Account `json:"data"`
 }
 
-type Account struct {
-	ID     string `json:"id"`
-	Name   string `json:"name"`
-	Closed bool   `json:"closed"`
-}
-
 type FetchTransactionsResponse struct {
 	Data []Transaction `json:"data"`
 }
 
-type Transaction struct {
-	ID         string `json:"id"`
-	AccountID  string `json:"account"`
-	CategoryID string `json:"category"`
-	Amount     int    `json:"amount"` // in cents
-	PayeeID    string `json:"payee"`
-	Notes      string `json:"notes"`
-	Date       string `json:"date"` // YYYY-MM-DD
-	// Error      string `json:"error"`
-	// ImportedPayee *string `json:"imported_payee,omitempty"`
-	// Cleared       bool    `json:"cleared"`
-	// Tombstone     bool    `json:"tombstone"`
-	// Additional fields that may be present but not used:
-	// IsParent            bool     `json:"is_parent,omitempty"`
-	// IsChild             bool     `json:"is_child,omitempty"`
-	// ParentID            *string  `json:"parent_id,omitempty"`
-	// ImportedID          *string  `json:"imported_id,omitempty"`
-	// StartingBalanceFlag bool     `json:"starting_balance_flag,omitempty"`
-	// TransferID          *string  `json:"transfer_id,omitempty"`
-	// SortOrder           int64    `json:"sort_order,omitempty"`
-	// Schedule            *string  `json:"schedule,omitempty"`
-	// Subtransactions     []string `json:"subtransactions,omitempty"`
+type FetchBalanceResponse struct {
+	Data Money `json:"data"`
 }
 
 type FetchCategoriesResponse struct {
 	Data []Category `json:"data"`
 }
 
-type Category struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	IsIncome bool   `json:"is_income"`
+type FetchCategoryGroupsResponse struct {
+	Data []CategoryGroup `json:"data"`
 }
 
 type FetchPayeesResponse struct {
 	Data []Payee `json:"data"`
 }
 
-type Payee struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+type FetchBudgetsResponse struct {
+	Data []Budget `json:"data"`
+}
+
+// FetchMonthsResponse lists the budget's months as YYYY-MM.
+type FetchMonthsResponse struct {
+	Data []string `json:"data"`
+}
+
+type FetchMonthResponse struct {
+	Data BudgetMonth `json:"data"`
+}
+
+// FetchSchedulesResponse lists the budget's schedules, which older servers
+// don't support (see CapSchedules).
+type FetchSchedulesResponse struct {
+	Data []Schedule `json:"data"`
+}
+
+// BudgetMonth is a month's budget summary.
+type BudgetMonth struct {
+	Month              string             `json:"month"`
+	IncomeAvailable    Money              `json:"incomeAvailable"`
+	LastMonthOverspent Money              `json:"lastMonthOverspent"`
+	ForNextMonth       Money              `json:"forNextMonth"`
+	TotalBudgeted      Money              `json:"totalBudgeted"`
+	ToBudget           Money              `json:"toBudget"`
+	FromLastMonth      Money              `json:"fromLastMonth"`
+	TotalIncome        Money              `json:"totalIncome"`
+	TotalSpent         Money              `json:"totalSpent"`
+	TotalBalance       Money              `json:"totalBalance"`
+	CategoryGroups     []BudgetMonthGroup `json:"categoryGroups"`
+}
+
+type BudgetMonthGroup struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	IsIncome   bool                  `json:"is_income"`
+	Hidden     bool                  `json:"hidden"`
+	Categories []BudgetMonthCategory `json:"categories"`
+}
+
+type BudgetMonthCategory struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IsIncome  bool   `json:"is_income"`
+	Hidden    bool   `json:"hidden"`
+	GroupID   string `json:"group_id"`
+	Budgeted  Money  `json:"budgeted"`
+	Spent     Money  `json:"spent"`
+	Balance   Money  `json:"balance"`
+	Carryover bool   `json:"carryover"`
 }
 
 type ActualClient interface {
+	FetchBudgets() (FetchBudgetsResponse, error)
 	FetchAccounts() (FetchAccountsResponse, error)
 	FetchTransactions(accountID, startDate, endDate string) (FetchTransactionsResponse, error)
 	FetchCategories() (FetchCategoriesResponse, error)
+	FetchCategoryGroups() (FetchCategoryGroupsResponse, error)
+	FetchBalance(accountID, cutoffDate string) (FetchBalanceResponse, error)
 	FetchPayees() (FetchPayeesResponse, error)
+	FetchMonths() (FetchMonthsResponse, error)
+	FetchMonth(month string) (FetchMonthResponse, error)
+	FetchSchedules() (FetchSchedulesResponse, error)
+	MergePayees(targetID string, mergeIDs []string) error
+	Capabilities() (Capabilities, error)
 }
 
 type actualClient struct {
-	cfg    Config
-	client *http.Client
+	cfg     Config
+	client  *http.Client
+	cache   *responseCache
+	baseURL string
+
+	// keys holds every configured API key; keyIdx is the one currently in use.
+	// A 401 advances to the next key so rotated-out keys fail over.
+	keys   []string
+	mu     sync.Mutex // guards keyIdx
+	keyIdx int
+
+	capsOnce sync.Once
+	caps     Capabilities
+	capsErr  error
 }
 
 func NewActualClient(cfg Config, client *http.Client) ActualClient {
+	// ACTUAL_API_URL is validated by loadConfig
+	t, _ := parseAPITransport(cfg.ActualAPIURL)
 	return &actualClient{
-		cfg:    cfg,
-		client: client,
+		cfg:     cfg,
+		client:  client,
+		cache:   newResponseCache(cfg.CacheDir),
+		baseURL: t.baseURL,
+		keys:    splitAPIKeys(cfg.ActualAPIKey),
 	}
 }
 
-func (c *actualClient) FetchAccounts() (FetchAccountsResponse, error) {
-	url := fmt.Sprintf("%s/budgets/%s/accounts", c.cfg.ActualAPIURL, c.cfg.BudgetSyncID)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return FetchAccountsResponse{}, fmt.Errorf("creating request: %w", err)
+func newHTTPClient(cfg Config) *http.Client {
+	t, _ := parseAPITransport(cfg.ActualAPIURL)
+	transport := t.roundTripper()
+	switch cfg.AuthMode {
+	case "":
+	case authModeClientCredentials, authModeDevice:
+		transport = &bearerTransport{base: transport, source: newOIDCTokenSource(cfg)}
+	default:
+		log.Fatalf("Unsupported AUTH_MODE %q", cfg.AuthMode)
 	}
-	req.Header.Set("x-api-key", c.cfg.ActualAPIKey)
+	if cfg.RequestRate > 0 {
+		transport = newRateLimitTransport(transport, cfg.RequestRate)
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+	}
+}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return FetchAccountsResponse{}, fmt.Errorf("making request: %w", err)
+// splitAPIKeys parses a comma-separated list of API keys.
+func splitAPIKeys(s string) []string {
+	var keys []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
 	}
-	defer resp.Body.Close() //nolint
+	return keys
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return FetchAccountsResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+func (c *actualClient) FetchBudgets() (FetchBudgetsResponse, error) {
+	url := fmt.Sprintf("%s/budgets", c.baseURL)
+
+	var budgets FetchBudgetsResponse
+	if err := c.getCached(url, &budgets); err != nil {
+		return FetchBudgetsResponse{}, err
 	}
 
+	return budgets, nil
+}
+
+func (c *actualClient) FetchAccounts() (FetchAccountsResponse, error) {
+	url := fmt.Sprintf("%s/budgets/%s/accounts", c.baseURL, c.cfg.BudgetSyncID)
+
 	var accounts FetchAccountsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&accounts); err != nil {
-		return FetchAccountsResponse{}, fmt.Errorf("decoding response: %w", err)
+	if err := c.getCached(url, &accounts); err != nil {
+		return FetchAccountsResponse{}, err
 	}
 
 	return accounts, nil
 }
 
 func (c *actualClient) FetchTransactions(accountID, startDate, endDate string) (FetchTransactionsResponse, error) {
-	url := fmt.Sprintf("%s/budgets/%s/accounts/%s/transactions", c.cfg.ActualAPIURL, c.cfg.BudgetSyncID, accountID)
+	url := fmt.Sprintf("%s/budgets/%s/accounts/%s/transactions", c.baseURL, c.cfg.BudgetSyncID, accountID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := c.newRequest(url)
 	if err != nil {
-		return FetchTransactionsResponse{}, fmt.Errorf("creating request: %w", err)
+		return FetchTransactionsResponse{}, err
 	}
-	req.Header.Set("x-api-key", c.cfg.ActualAPIKey)
 
 	// Add query parameters
 	q := req.URL.Query()
@@ -126,7 +202,7 @@ func (c *actualClient) FetchTransactions(accountID, startDate, endDate string) (
 	q.Add("until_date", endDate)
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return FetchTransactionsResponse{}, fmt.Errorf("making request: %w", err)
 	}
@@ -136,64 +212,294 @@ func (c *actualClient) FetchTransactions(accountID, startDate, endDate string) (
 		return FetchTransactionsResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
+	body, err := responseBody(resp, c.cfg.MaxResponseBytes)
+	if err != nil {
+		return FetchTransactionsResponse{}, err
+	}
 	var transactionsResp FetchTransactionsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&transactionsResp); err != nil {
+	var decodeErr error
+	if err := decodeDataArray(body, func(raw json.RawMessage) {
+		var txn Transaction
+		if err := c.unmarshal(raw, &txn); err != nil {
+			decodeErr = errors.Join(decodeErr, err)
+			return
+		}
+		transactionsResp.Data = append(transactionsResp.Data, txn)
+	}); err != nil {
 		return FetchTransactionsResponse{}, fmt.Errorf("decoding response: %w", err)
 	}
+	if decodeErr != nil {
+		return FetchTransactionsResponse{}, fmt.Errorf("decoding response: %w", decodeErr)
+	}
 
 	return transactionsResp, nil
 }
 
-func (c *actualClient) FetchCategories() (FetchCategoriesResponse, error) {
-	url := fmt.Sprintf("%s/budgets/%s/categories", c.cfg.ActualAPIURL, c.cfg.BudgetSyncID)
+func (c *actualClient) FetchCategoryGroups() (FetchCategoryGroupsResponse, error) {
+	url := fmt.Sprintf("%s/budgets/%s/categorygroups", c.baseURL, c.cfg.BudgetSyncID)
+
+	var groupsResp FetchCategoryGroupsResponse
+	if err := c.getCached(url, &groupsResp); err != nil {
+		return FetchCategoryGroupsResponse{}, err
+	}
+
+	return groupsResp, nil
+}
+
+// FetchBalance returns the account balance including all transactions up to and including cutoffDate.
+func (c *actualClient) FetchBalance(accountID, cutoffDate string) (FetchBalanceResponse, error) {
+	url := fmt.Sprintf("%s/budgets/%s/accounts/%s/balance", c.baseURL, c.cfg.BudgetSyncID, accountID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := c.newRequest(url)
 	if err != nil {
-		return FetchCategoriesResponse{}, fmt.Errorf("creating request: %w", err)
+		return FetchBalanceResponse{}, err
 	}
-	req.Header.Set("x-api-key", c.cfg.ActualAPIKey)
+	q := req.URL.Query()
+	q.Add("cutoff_date", cutoffDate)
+	req.URL.RawQuery = q.Encode()
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return FetchCategoriesResponse{}, fmt.Errorf("making request: %w", err)
+		return FetchBalanceResponse{}, fmt.Errorf("making request: %w", err)
 	}
 	defer resp.Body.Close() //nolint
 
 	if resp.StatusCode != http.StatusOK {
-		return FetchCategoriesResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return FetchBalanceResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
+	body, err := responseBody(resp, c.cfg.MaxResponseBytes)
+	if err != nil {
+		return FetchBalanceResponse{}, err
+	}
+	var balanceResp FetchBalanceResponse
+	if err := json.NewDecoder(body).Decode(&balanceResp); err != nil {
+		return FetchBalanceResponse{}, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return balanceResp, nil
+}
+
+func (c *actualClient) FetchCategories() (FetchCategoriesResponse, error) {
+	url := fmt.Sprintf("%s/budgets/%s/categories", c.baseURL, c.cfg.BudgetSyncID)
+
 	var categoriesResp FetchCategoriesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&categoriesResp); err != nil {
-		return FetchCategoriesResponse{}, fmt.Errorf("decoding response: %w", err)
+	if err := c.getCached(url, &categoriesResp); err != nil {
+		return FetchCategoriesResponse{}, err
 	}
 
 	return categoriesResp, nil
 }
 
 func (c *actualClient) FetchPayees() (FetchPayeesResponse, error) {
-	url := fmt.Sprintf("%s/budgets/%s/payees", c.cfg.ActualAPIURL, c.cfg.BudgetSyncID)
+	url := fmt.Sprintf("%s/budgets/%s/payees", c.baseURL, c.cfg.BudgetSyncID)
+
+	var payeesResp FetchPayeesResponse
+	if err := c.getCached(url, &payeesResp); err != nil {
+		return FetchPayeesResponse{}, err
+	}
+
+	return payeesResp, nil
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// FetchMonths returns every month the budget has, which older servers don't
+// support (see CapMonths).
+func (c *actualClient) FetchMonths() (FetchMonthsResponse, error) {
+	url := fmt.Sprintf("%s/budgets/%s/months", c.baseURL, c.cfg.BudgetSyncID)
+
+	var monthsResp FetchMonthsResponse
+	if err := c.getCached(url, &monthsResp); err != nil {
+		return FetchMonthsResponse{}, err
+	}
+
+	return monthsResp, nil
+}
+
+// FetchMonth returns the budget summary for month (YYYY-MM).
+func (c *actualClient) FetchMonth(month string) (FetchMonthResponse, error) {
+	url := fmt.Sprintf("%s/budgets/%s/months/%s", c.baseURL, c.cfg.BudgetSyncID, month)
+
+	var monthResp FetchMonthResponse
+	if err := c.getCached(url, &monthResp); err != nil {
+		return FetchMonthResponse{}, err
+	}
+
+	return monthResp, nil
+}
+
+// FetchSchedules returns the budget's scheduled transactions.
+func (c *actualClient) FetchSchedules() (FetchSchedulesResponse, error) {
+	url := fmt.Sprintf("%s/budgets/%s/schedules", c.baseURL, c.cfg.BudgetSyncID)
+
+	var schedulesResp FetchSchedulesResponse
+	if err := c.getCached(url, &schedulesResp); err != nil {
+		return FetchSchedulesResponse{}, err
+	}
+
+	return schedulesResp, nil
+}
+
+// MergePayees merges the payees in mergeIDs into targetID, reassigning their transactions.
+func (c *actualClient) MergePayees(targetID string, mergeIDs []string) error {
+	url := fmt.Sprintf("%s/budgets/%s/payees/merge", c.baseURL, c.cfg.BudgetSyncID)
+
+	body, err := json.Marshal(map[string]any{"targetId": targetID, "mergeIds": mergeIDs})
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequestWithBody("POST", url, bytes.NewReader(body))
 	if err != nil {
-		return FetchPayeesResponse{}, fmt.Errorf("creating request: %w", err)
+		return err
 	}
-	req.Header.Set("x-api-key", c.cfg.ActualAPIKey)
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return FetchPayeesResponse{}, fmt.Errorf("making request: %w", err)
+		return fmt.Errorf("making request: %w", err)
 	}
 	defer resp.Body.Close() //nolint
 
 	if resp.StatusCode != http.StatusOK {
-		return FetchPayeesResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
+	return nil
+}
 
-	var payeesResp FetchPayeesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&payeesResp); err != nil {
-		return FetchPayeesResponse{}, fmt.Errorf("decoding response: %w", err)
+func (c *actualClient) newRequest(url string) (*http.Request, error) {
+	return c.newRequestWithBody("GET", url, nil)
+}
+
+func (c *actualClient) newRequestWithBody(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent())
+	// requesting compression explicitly disables Go's transparent gzip handling;
+	// responseBody decodes both encodings and enforces MAX_RESPONSE_BYTES
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if c.cfg.ActualClientID != "" {
+		req.Header.Set("X-Client-Id", c.cfg.ActualClientID)
 	}
+	return req, nil
+}
 
-	return payeesResp, nil
+// do sends req with the current API key, failing over to the next
+// configured key whenever the server responds 401.
+func (c *actualClient) do(req *http.Request) (*http.Response, error) {
+	for {
+		c.mu.Lock()
+		idx := c.keyIdx
+		c.mu.Unlock()
+		if idx < len(c.keys) {
+			req.Header.Set("x-api-key", c.keys[idx])
+		}
+		// a failed-over request must resend its body from the start
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || idx+1 >= len(c.keys) {
+			return resp, nil
+		}
+		resp.Body.Close() //nolint
+		c.mu.Lock()
+		// concurrent requests may have failed over already
+		if c.keyIdx == idx {
+			c.keyIdx++
+			slog.Warn("API key was rejected, failing over to the next key", "key", idx+1, "next_key", idx+2)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func userAgent() string {
+	return fmt.Sprintf("actual2csv/%s (+https://github.com/benjamonnguyen/actual2csv)", version)
+}
+
+// getCached fetches reference data, revalidating any cached copy with
+// If-None-Match/If-Modified-Since so unchanged data isn't downloaded again.
+func (c *actualClient) getCached(url string, v any) error {
+	req, err := c.newRequest(url)
+	if err != nil {
+		return err
+	}
+
+	cached, hit := c.cache.Get(url)
+	if hit {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close() //nolint
+
+	var body []byte
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hit:
+		body = cached.Body
+	case resp.StatusCode == http.StatusOK:
+		r, err := responseBody(resp, c.cfg.MaxResponseBytes)
+		if err != nil {
+			return err
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("reading response: %w", err)
+		}
+		c.cache.Put(url, cachedResponse{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Body:         body,
+		})
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if err := c.unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+func (c *actualClient) unmarshal(data []byte, v any) error {
+	if c.cfg.StrictSchema {
+		return strictUnmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// fetchNameMaps fetches categories and payees keyed by ID.
+func fetchNameMaps(client ActualClient) (map[string]Category, map[string]Payee, error) {
+	categoriesResp, err := client.FetchCategories()
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching categories: %w", err)
+	}
+	categoryMap := make(map[string]Category)
+	for _, category := range categoriesResp.Data {
+		categoryMap[category.ID] = category
+	}
+	payeesResp, err := client.FetchPayees()
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching payees: %w", err)
+	}
+	payeeMap := make(map[string]Payee)
+	for _, payee := range payeesResp.Data {
+		payeeMap[payee.ID] = payee
+	}
+	return categoryMap, payeeMap, nil
 }
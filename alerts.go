@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const alertStateFilename = "alerts.state.json"
+
+// CategoryAlerts maps categories (by name or ID) to a monthly spending limit,
+// parsed from CATEGORY_ALERTS, e.g. "Dining>400;Groceries>650".
+type CategoryAlerts map[string]Money
+
+func parseCategoryAlerts(s string) (CategoryAlerts, error) {
+	alerts := make(CategoryAlerts)
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		category, limit, ok := strings.Cut(entry, ">")
+		category = strings.TrimSpace(category)
+		m, err := ParseMoney(strings.TrimPrefix(strings.TrimSpace(limit), "$"))
+		if !ok || category == "" || err != nil || m.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid CATEGORY_ALERTS entry %q: expected category>amount", entry)
+		}
+		alerts[category] = m
+	}
+	return alerts, nil
+}
+
+// Limit returns category's monthly spending limit, if it has one.
+func (a CategoryAlerts) Limit(category Category) (Money, bool) {
+	if limit, ok := a[category.ID]; ok {
+		return limit, true
+	}
+	limit, ok := a[category.Name]
+	return limit, ok
+}
+
+// check reports limits naming no category, which would otherwise never alert.
+func (a CategoryAlerts) check(categories []Category) error {
+	known := make(map[string]bool)
+	for _, c := range categories {
+		known[c.ID], known[c.Name] = true, true
+	}
+	for _, name := range slices.Sorted(maps.Keys(a)) {
+		if !known[name] {
+			return fmt.Errorf("CATEGORY_ALERTS names unknown category %q", name)
+		}
+	}
+	return nil
+}
+
+// alertState remembers which categories were already alerted on this month,
+// so each crossing is only notified once.
+type alertState struct {
+	Month   string   `json:"month"`
+	Alerted []string `json:"alerted"`
+}
+
+// checkCategoryAlerts totals this month's spending per category and notifies
+// NOTIFY_URL about categories that crossed their CATEGORY_ALERTS limit since
+// the last check, in the -lang language. Without NOTIFY_URL the crossings are
+// only logged. Failures are warnings, since the export itself succeeded.
+func checkCategoryAlerts(cfg Config, client ActualClient, lang string, now time.Time) {
+	if len(cfg.CategoryAlerts) == 0 {
+		return
+	}
+	if err := notifyCategoryAlerts(cfg, client, lang, NewDate(now.Local())); err != nil {
+		slog.Warn("Failed to check category alerts", "err", err)
+	}
+}
+
+func notifyCategoryAlerts(cfg Config, client ActualClient, lang string, today Date) error {
+	msgs, err := catalog(lang)
+	if err != nil {
+		return err
+	}
+	statePath := filepath.Join(cfg.TransactionOutputDir, alertStateFilename)
+	month := today.Format("2006-01")
+	state := alertState{Month: month}
+	data, err := os.ReadFile(statePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading alert state: %w", err)
+	}
+	if err == nil {
+		var saved alertState
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("decoding alert state: %w", err)
+		}
+		if saved.Month == month {
+			state = saved
+		}
+	}
+
+	categoryMap, _, err := fetchNameMaps(client)
+	if err != nil {
+		return err
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		return fmt.Errorf("fetching accounts: %w", err)
+	}
+	spent := make(map[string]Money)
+	start := Date{today.AddDate(0, 0, 1-today.Day())}
+	if err := forEachTransaction(client, accountsResp.Data, start.String(), today.String(), func(_ Account, txn Transaction) {
+		spent[txn.CategoryID] = spent[txn.CategoryID].Sub(txn.Amount)
+	}); err != nil {
+		return err
+	}
+
+	var crossed []string
+	for _, id := range slices.Sorted(maps.Keys(spent)) {
+		category, ok := categoryMap[id]
+		if !ok {
+			continue
+		}
+		limit, ok := cfg.CategoryAlerts.Limit(category)
+		if !ok || spent[id].Cents <= limit.Cents || slices.Contains(state.Alerted, id) {
+			continue
+		}
+		slog.Warn("Category spending is over its monthly limit", "category", category.Name, "month", month, "spent", spent[id], "limit", limit)
+		crossed = append(crossed, msgs.Sprintf("alert.item", category.Name, spent[id], limit))
+		state.Alerted = append(state.Alerted, id)
+	}
+	if len(crossed) == 0 {
+		return nil
+	}
+	if cfg.NotifyURL != "" {
+		notifier, err := NewNotifier(cfg.NotifyURL, cfg.NotifySecret)
+		if err != nil {
+			return err
+		}
+		subject := msgs.Sprintf("alert.subject", len(crossed), msgs.Sprintf(fmt.Sprintf("month.%d", today.Month())), today.Year())
+		if err := notifier.Notify(subject, strings.Join(crossed, "\n")); err != nil {
+			return err
+		}
+	}
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding alert state: %w", err)
+	}
+	if err := os.WriteFile(statePath+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("writing alert state: %w", err)
+	}
+	return os.Rename(statePath+".tmp", statePath)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+func runAuth(args []string) {
+	if len(args) == 0 || args[0] != "rotate" {
+		fmt.Fprintln(os.Stderr, "usage: actual2csv auth rotate -key NEW_KEY [-keep-old] [-cfg configFilePath]")
+		os.Exit(2)
+	}
+	runAuthRotate(args[1:])
+}
+
+// runAuthRotate validates a new API key against the server and, if accepted,
+// writes it to the configuration file in place of the current key(s).
+func runAuthRotate(args []string) {
+	fs := flag.NewFlagSet("auth rotate", flag.ExitOnError)
+	var cfgFlag configFlags
+	var keyFlag string
+	var keepOldFlag bool
+	cfgFlag.register(fs)
+	fs.StringVar(&keyFlag, "key", "", "New API key")
+	fs.BoolVar(&keepOldFlag, "keep-old", false, "Keep current key(s) as fallbacks after the new key")
+	fs.Parse(args) //nolint
+
+	if keyFlag == "" {
+		log.Fatal("-key is required")
+	}
+
+	cfg := loadConfig(cfgFlag)
+	oldKeys := cfg.ActualAPIKey
+
+	cfg.ActualAPIKey = keyFlag
+	if _, err := NewActualClient(cfg, newHTTPClient(cfg)).FetchAccounts(); err != nil {
+		log.Fatalf("New API key failed validation, keeping current key: %v", err)
+	}
+
+	env, err := godotenv.Read(cfgFlag.env)
+	if err != nil {
+		log.Fatalf("Failed to read configuration file: %v", err)
+	}
+	env["ACTUAL_API_KEY"] = keyFlag
+	if keepOldFlag && oldKeys != "" {
+		env["ACTUAL_API_KEY"] = keyFlag + "," + oldKeys
+	}
+	if err := godotenv.Write(env, cfgFlag.env); err != nil {
+		log.Fatalf("Failed to write configuration file: %v", err)
+	}
+	slog.Info("Rotated API key", "path", cfgFlag.env)
+}
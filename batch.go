@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// batchJob is one export of a batch: export flags and, in upper case,
+// settings that override the environment, e.g. BUDGET_SYNC_ID.
+type batchJob struct {
+	Name     string
+	Flags    map[string]string
+	Settings map[string]string
+}
+
+// runBatch runs the exports described on stdin one after another, each as a
+// child process like serve's, so orchestration tools can drive several
+// periods, budgets and formats with one invocation.
+func runBatch(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	var cfgFlag configFlags
+	var keepGoingFlag bool
+	cfgFlag.register(fs)
+	fs.BoolVar(&keepGoingFlag, "keep-going", false, "Run the remaining jobs after one fails")
+	fs.Parse(args) //nolint
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatalf("Failed to read jobs from stdin: %v", err)
+	}
+	jobs, err := parseBatch(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(jobs) == 0 {
+		log.Fatal("No jobs on stdin")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate executable: %v", err)
+	}
+
+	var failed []string
+	for i, job := range jobs {
+		args := append([]string{"export"}, cfgFlag.args()...)
+		for _, name := range slices.Sorted(maps.Keys(job.Flags)) {
+			args = append(args, "-"+name+"="+job.Flags[name])
+		}
+		cmd := exec.Command(exe, args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		// the environment wins over the .env and config files
+		cmd.Env = os.Environ()
+		for key, value := range job.Settings {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+
+		slog.Info("Starting batch job", "job", job.Name, "n", i+1, "of", len(jobs))
+		startedAt := time.Now()
+		if err := cmd.Run(); err != nil {
+			slog.Error("Batch job failed", "job", job.Name, "err", err, "duration", time.Since(startedAt))
+			failed = append(failed, job.Name)
+			if !keepGoingFlag {
+				break
+			}
+			continue
+		}
+		slog.Info("Finished batch job", "job", job.Name, "duration", time.Since(startedAt))
+	}
+	if len(failed) > 0 {
+		log.Fatalf("%d of %d batch jobs failed: %s", len(failed), len(jobs), strings.Join(failed, ", "))
+	}
+}
+
+// parseBatch parses jobs from a JSON array of objects or, otherwise, YAML
+// whose top-level sections are named jobs and whose top-level keys are
+// settings shared by every job:
+//
+//	[{"name": "home", "from": "2024-01", "to": "2024-12"},
+//	 {"name": "rental", "BUDGET_SYNC_ID": "...", "year": "2024", "format": "events"}]
+//
+// Flag values may be strings, numbers, booleans or lists, which are joined
+// with commas like in the config file.
+func parseBatch(data []byte) ([]batchJob, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseJSONBatch(trimmed)
+	}
+	cf, err := parseYAMLConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing jobs: %w", err)
+	}
+	var jobs []batchJob
+	for _, name := range yamlSections(string(data)) {
+		if _, ok := cf[name]; !ok {
+			// a top-level block list rather than a job
+			continue
+		}
+		values := maps.Clone(cf[""])
+		if values == nil {
+			values = make(map[string]string)
+		}
+		maps.Copy(values, cf[name])
+		job, err := newBatchJob(name, values)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func parseJSONBatch(data []byte) ([]batchJob, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw []map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decoding jobs: %w", err)
+	}
+	var jobs []batchJob
+	for i, obj := range raw {
+		name := fmt.Sprintf("job %d", i+1)
+		if n, ok := obj["name"].(string); ok && n != "" {
+			name = n
+		}
+		delete(obj, "name")
+		values := make(map[string]string, len(obj))
+		for key, v := range obj {
+			s, err := batchValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("job %s: %s: %w", name, key, err)
+			}
+			values[key] = s
+		}
+		job, err := newBatchJob(name, values)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// newBatchJob splits values into settings, which are upper case like in the
+// .env file, and export flags.
+func newBatchJob(name string, values map[string]string) (batchJob, error) {
+	job := batchJob{Name: name, Flags: make(map[string]string), Settings: make(map[string]string)}
+	for key, value := range values {
+		switch {
+		case key == strings.ToUpper(key):
+			job.Settings[key] = value
+		case strings.HasPrefix(key, "-"):
+			return batchJob{}, fmt.Errorf("job %s: write flag %q without the leading -", name, key)
+		default:
+			job.Flags[key] = value
+		}
+	}
+	return job, nil
+}
+
+// batchValue formats a JSON scalar or list of scalars as a flag value.
+func batchValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number, bool:
+		return fmt.Sprint(v), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, nested := item.([]any); nested {
+				return "", errors.New("lists can't be nested")
+			}
+			s, err := batchValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// yamlSections returns the names of YAML's top-level sections in order.
+func yamlSections(data string) []string {
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		raw := stripComment(scanner.Text())
+		line := strings.TrimSpace(raw)
+		if line == "" || raw[0] == ' ' || raw[0] == '\t' || line == "---" {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(value) == "" {
+			names = append(names, unquote(strings.TrimSpace(key)))
+		}
+	}
+	return names
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// beancountWriter backs -format beancount: a Beancount ledger with an open
+// directive for every account it can post to, dated the first day exported,
+// and a transaction per Actual transaction. Accounts go under Assets, or
+// Liabilities when ACCOUNT_METADATA marks them type=credit or
+// type=liability; categories under Expenses or Income. Like -format ledger,
+// the account posting is offset against the category, so income is
+// negative as Beancount expects, uncategorized transactions go to
+// Expenses:Uncategorized or Income:Uncategorized, split transactions get a
+// posting per part, and a transfer is one transaction written from the
+// account the money left, with any category as posting metadata. Amounts are
+// in the account's ACCOUNT_METADATA currency, USD by default.
+type beancountWriter struct {
+	w           *bufio.Writer
+	start       Date
+	categoryMap map[string]Category
+	payeeMap    map[string]Payee
+	meta        AccountMetadata
+	accounts    []Account
+	exported    map[string]bool // account IDs in the export
+}
+
+func NewBeancountWriter(w io.Writer, start Date, categories map[string]Category, payeeMap map[string]Payee, meta AccountMetadata, accounts []Account) TransactionWriter {
+	return &beancountWriter{w: bufio.NewWriter(w), start: start, categoryMap: categories, payeeMap: payeeMap, meta: meta, accounts: accounts, exported: accountIDs(accounts)}
+}
+
+// WriteHeader opens every account a transaction can post to: the exported
+// accounts, the accounts transfers go to, every category and the
+// uncategorized ones. Opening them up front rather than as they're seen keeps
+// a resumed export from opening any twice.
+func (w *beancountWriter) WriteHeader() error {
+	open := make(map[string]string) // account name to its currency
+	for _, acct := range w.accounts {
+		open[w.account(acct)] = w.currency(acct)
+	}
+	for _, payee := range w.payeeMap {
+		if payee.TransferAccount != "" {
+			acct := Account{ID: payee.TransferAccount, Name: payee.Name}
+			open[w.account(acct)] = w.currency(acct)
+		}
+	}
+	for _, category := range w.categoryMap {
+		open[beancountCategory(category)] = ""
+	}
+	open[beancountCategory(Category{})] = ""
+	open[beancountCategory(Category{IsIncome: true})] = ""
+	for _, name := range slices.Sorted(maps.Keys(open)) {
+		fmt.Fprintf(w.w, "%s open %s", w.start, name)
+		if open[name] != "" {
+			fmt.Fprintf(w.w, " %s", open[name])
+		}
+		w.w.WriteString("\n")
+	}
+	w.w.WriteString("\n")
+	return w.w.Flush()
+}
+
+func (w *beancountWriter) Add(acct Account, txns []Transaction) error {
+	for _, txn := range txns {
+		legs := counterparts(txn, w.categoryMap, w.payeeMap, w.exported)
+		if legs == nil {
+			continue
+		}
+		payee := w.payeeMap[txn.PayeeID]
+		flag := "!"
+		if txn.Cleared || txn.Reconciled {
+			flag = "*"
+		}
+		account, currency := w.account(acct), w.currency(acct)
+		others := make([]string, len(legs))
+		width := len(account)
+		for i, l := range legs {
+			others[i] = beancountCategory(Category{IsIncome: l.amount.Sign() > 0})
+			switch {
+			case l.transfer.ID != "":
+				others[i] = w.account(l.transfer)
+			case l.category.ID != "":
+				others[i] = beancountCategory(l.category)
+			}
+			width = max(width, len(others[i]))
+		}
+		fmt.Fprintf(w.w, "%s %s", txn.Date, flag)
+		if payee.Name != "" {
+			fmt.Fprintf(w.w, " %s", beancountString(payee.Name))
+		}
+		fmt.Fprintf(w.w, " %s\n", beancountString(txn.Notes))
+		fmt.Fprintf(w.w, "  %-*s  %12s %s\n", width, account, legsTotal(legs), currency)
+		for i, l := range legs {
+			fmt.Fprintf(w.w, "  %-*s  %12s %s\n", width, others[i], l.amount.Neg(), currency)
+			if l.transfer.ID != "" && l.category.Name != "" {
+				fmt.Fprintf(w.w, "    category: %s\n", beancountString(l.category.Name))
+			}
+		}
+		w.w.WriteString("\n")
+	}
+	return w.w.Flush()
+}
+
+func (w *beancountWriter) WritePlaceholder(date Date, note string) error {
+	fmt.Fprintf(w.w, "; %s %s\n", date, note)
+	return w.w.Flush()
+}
+
+// account returns the Beancount account of an Actual account.
+func (w *beancountWriter) account(acct Account) string {
+	if w.meta.IsLiability(acct) {
+		return "Liabilities:" + beancountComponent(acct.Name)
+	}
+	return "Assets:" + beancountComponent(acct.Name)
+}
+
+func (w *beancountWriter) currency(acct Account) string {
+	return strings.ToUpper(cmp.Or(w.meta.For(acct)["currency"], "USD"))
+}
+
+// beancountCategory returns the Beancount account of a category, or of
+// uncategorized spending or income for the zero Category.
+func beancountCategory(c Category) string {
+	root := "Expenses:"
+	if c.IsIncome {
+		root = "Income:"
+	}
+	return root + beancountComponent(cmp.Or(c.Name, "Uncategorized"))
+}
+
+// beancountComponent turns a name into an account name component, which
+// Beancount requires to start with a capital letter or digit and contain
+// only letters, digits and dashes: "eating out & bars" becomes
+// "Eating-Out-Bars".
+func beancountComponent(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	component := cmp.Or(strings.Join(words, "-"), "Unnamed")
+	if first := []rune(component)[0]; !unicode.IsUpper(first) && !unicode.IsDigit(first) {
+		// e.g. CJK names, whose letters have no case
+		component = "X" + component
+	}
+	return component
+}
+
+// beancountString quotes s as a Beancount string on one line.
+func beancountString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(ledgerText(s)) + `"`
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The benchmarks run the fetch/transform/write pipeline on synthetic
+// transactions so performance regressions are measurable without a server:
+//
+//	go test -run '^$' -bench . -benchmem -args -budget 5us -dir /mnt/nas
+var (
+	benchSizes  = []int{10000, 100000, 1000000}
+	benchBudget = flag.Duration("budget", 0, "Fail BenchmarkPipeline if it takes longer than this per transaction, e.g. 5us")
+	benchDir    = flag.String("dir", "", "Directory for BenchmarkWriteFile, e.g. a network filesystem mount (defaults to a temporary one)")
+)
+
+var benchAccount = Account{ID: "bench", Name: "Bench Checking"}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, n := range benchSizes {
+		body := benchTransactions(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := decodeDataArray(bytes.NewReader(body), func(raw json.RawMessage) {
+					var txn Transaction
+					json.Unmarshal(raw, &txn) //nolint
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reportPerTransaction(b, n)
+		})
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	categories, payees := benchNames()
+	for _, n := range benchSizes {
+		txns := benchData(b, n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				w := NewCSVWriter(io.Discard, categories, payees, CSVOptions{})
+				if err := w.Add(benchAccount, txns); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reportPerTransaction(b, n)
+		})
+	}
+}
+
+// BenchmarkWriteFile compares writing after every step with the default
+// flush policy; steps of 50 rows approximate one account-month each.
+func BenchmarkWriteFile(b *testing.B) {
+	categories, payees := benchNames()
+	dir := *benchDir
+	if dir == "" {
+		dir = b.TempDir()
+	}
+	for _, n := range benchSizes {
+		txns := benchData(b, n)
+		for _, policy := range []struct {
+			name   string
+			policy FlushPolicy
+		}{
+			{"step", FlushPolicy{}},
+			{"buffered", defaultFlushPolicy},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", policy.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					if err := benchWriteFile(dir, categories, payees, txns, policy.policy); err != nil {
+						b.Fatal(err)
+					}
+				}
+				reportPerTransaction(b, n)
+			})
+		}
+	}
+}
+
+// BenchmarkPipeline fetches from an in-process server and writes the CSV.
+func BenchmarkPipeline(b *testing.B) {
+	categories, payees := benchNames()
+	for _, n := range benchSizes {
+		body := benchTransactions(n)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body) //nolint
+		}))
+		cfg := Config{BudgetSyncID: "bench", ActualAPIKey: "bench", ActualAPIURL: srv.URL, MaxResponseBytes: defaultMaxResponseBytes}
+		client := NewActualClient(cfg, srv.Client())
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				resp, err := client.FetchTransactions(benchAccount.ID, "2024-01-01", "2024-12-31")
+				if err != nil {
+					b.Fatal(err)
+				}
+				w := NewCSVWriter(io.Discard, categories, payees, CSVOptions{})
+				if err := w.Add(benchAccount, resp.Data); err != nil {
+					b.Fatal(err)
+				}
+			}
+			perTxn := reportPerTransaction(b, n)
+			if *benchBudget > 0 && perTxn > *benchBudget {
+				b.Errorf("pipeline takes %s per transaction, over the %s budget", perTxn, *benchBudget)
+			}
+		})
+		srv.Close()
+	}
+}
+
+// reportPerTransaction adds the time per transaction to the results and
+// returns it.
+func reportPerTransaction(b *testing.B, n int) time.Duration {
+	perTxn := b.Elapsed() / time.Duration(b.N*n)
+	b.ReportMetric(float64(perTxn.Nanoseconds()), "ns/txn")
+	return perTxn
+}
+
+// benchWriteFile writes txns to a temporary file in dir in steps of 50, as an export would.
+func benchWriteFile(dir string, categories map[string]Category, payees map[string]Payee, txns []Transaction, policy FlushPolicy) error {
+	f, err := os.CreateTemp(dir, "actual2csv-bench-*.csv")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) //nolint
+	defer f.Close()           //nolint
+	w := NewCSVWriter(f, categories, payees, CSVOptions{Flush: policy})
+	for start := 0; start < len(txns); start += 50 {
+		if err := w.Add(benchAccount, txns[start:min(start+50, len(txns))]); err != nil {
+			return err
+		}
+		if _, err := w.(bufferedWriter).Flush(false); err != nil {
+			return err
+		}
+	}
+	_, err = w.(bufferedWriter).Flush(true)
+	return err
+}
+
+// benchNames returns synthetic categories and payees referenced by benchTransactions.
+func benchNames() (map[string]Category, map[string]Payee) {
+	categories := make(map[string]Category)
+	payees := make(map[string]Payee)
+	for i := range 50 {
+		id := fmt.Sprintf("c%d", i)
+		categories[id] = Category{ID: id, Name: fmt.Sprintf("Category %d", i), IsIncome: i == 0}
+	}
+	for i := range 500 {
+		id := fmt.Sprintf("p%d", i)
+		payees[id] = Payee{ID: id, Name: fmt.Sprintf("Payee %d", i)}
+	}
+	return categories, payees
+}
+
+// benchData returns n decoded synthetic transactions.
+func benchData(b *testing.B, n int) []Transaction {
+	var data FetchTransactionsResponse
+	if err := json.Unmarshal(benchTransactions(n), &data); err != nil {
+		b.Fatal(err)
+	}
+	return data.Data
+}
+
+// benchTransactions returns a {"data": [...]} response body with n transactions.
+func benchTransactions(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"data":[`)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		txn := Transaction{
+			ID:         fmt.Sprintf("t%d", i),
+			AccountID:  "bench",
+			CategoryID: fmt.Sprintf("c%d", i%50),
+			Amount:     Money{Cents: -int64(i%100000 + 1)},
+			PayeeID:    fmt.Sprintf("p%d", i%500),
+			Notes:      strings.Repeat("note ", i%5),
+			Date:       NewDate(start.AddDate(0, 0, i%365)),
+		}
+		data, _ := json.Marshal(txn)
+		b.Write(data)
+	}
+	b.WriteString(`]}`)
+	return b.Bytes()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"log"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tagPattern matches #tags in notes the way Actual highlights them: a # not
+// preceded by another #, up to the next space or #.
+var tagPattern = regexp.MustCompile(`(?:^|[^#])(#[^#\s]+)`)
+
+// noteTags returns the distinct #tags in notes, in order.
+func noteTags(notes string) []string {
+	var tags []string
+	for _, m := range tagPattern.FindAllStringSubmatch(notes, -1) {
+		if !slices.Contains(tags, m[1]) {
+			tags = append(tags, m[1])
+		}
+	}
+	return tags
+}
+
+// tagTotals is a by-tag report row's tally.
+type tagTotals struct {
+	count           int
+	spent, received Money
+	first, last     Date
+	accounts        []string
+}
+
+func (t *tagTotals) add(account string, txn Transaction) {
+	t.count++
+	if txn.Amount.Sign() < 0 {
+		t.spent = t.spent.Add(txn.Amount)
+	} else {
+		t.received = t.received.Add(txn.Amount)
+	}
+	if t.first.IsZero() || txn.Date.Before(t.first) {
+		t.first = txn.Date
+	}
+	if txn.Date.After(t.last) {
+		t.last = txn.Date
+	}
+	if !slices.Contains(t.accounts, account) {
+		t.accounts = append(t.accounts, account)
+	}
+}
+
+// runByTagReport totals spending per #tag in notes, e.g. a trip or a
+// project, across accounts and months. A transaction with several tags counts
+// toward each of them.
+func runByTagReport(args []string) {
+	fs := flag.NewFlagSet("report by-tag", flag.ExitOnError)
+	var f reportFlags
+	var fieldFlag, byFlag, tagsFlag string
+	f.register(fs)
+	fs.StringVar(&fieldFlag, "field", "", "Group by this NOTE_PATTERNS field, e.g. project, instead of #tags")
+	fs.StringVar(&tagsFlag, "tags", "", "Only report these tags (or -field values), e.g. '#japan2024,#wedding'")
+	fs.StringVar(&byFlag, "by", "none", "Break each tag down further: none, month, pay-period (see PAY_PERIOD), category, account")
+	fs.Parse(args) //nolint
+	f.validate()
+	switch byFlag {
+	case "none", "month", "pay-period", "category", "account":
+	default:
+		log.Fatalf("Invalid -by value %q: must be none, month, pay-period, category or account", byFlag)
+	}
+
+	startDate, endDate, err := lookbackDates(f.from, f.to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := loadConfig(f.cfg)
+	if byFlag == "pay-period" && cfg.PayPeriods == nil {
+		log.Fatal("-by pay-period requires PAY_PERIOD, e.g. PAY_PERIOD=biweekly:2024-01-05")
+	}
+	tagsOf := noteTags
+	if fieldFlag != "" {
+		if !slices.Contains(cfg.NotePatterns.Fields(), fieldFlag) {
+			log.Fatalf("Invalid -field value %q: NOTE_PATTERNS has no such group", fieldFlag)
+		}
+		tagsOf = func(notes string) []string {
+			if value := cfg.NotePatterns.Extract(notes)[fieldFlag]; value != "" {
+				return []string{value}
+			}
+			return nil
+		}
+	}
+	only := splitList(tagsFlag)
+
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	categoryMap, _, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	// totals by tag, then by the -by breakdown
+	totals := make(map[string]map[string]*tagTotals)
+	tagged := 0
+	if err := forEachTransaction(client, accountsResp.Data, startDate, endDate, func(account Account, txn Transaction) {
+		tags := tagsOf(txn.Notes)
+		if len(tags) > 0 {
+			tagged++
+		}
+		for _, tag := range tags {
+			if len(only) > 0 && !slices.Contains(only, tag) {
+				continue
+			}
+			var key string
+			switch byFlag {
+			case "month":
+				key = txn.Date.Format("2006-01")
+			case "pay-period":
+				key = cfg.PayPeriods.Start(txn.Date).String()
+			case "category":
+				key = categoryMap[txn.CategoryID].Name
+			case "account":
+				key = account.Name
+			}
+			if totals[tag] == nil {
+				totals[tag] = make(map[string]*tagTotals)
+			}
+			if totals[tag][key] == nil {
+				totals[tag][key] = &tagTotals{}
+			}
+			totals[tag][key].add(account.Name, txn)
+		}
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	// tags with the most spending first, then their breakdown by name
+	spent := func(tag string) Money {
+		var sum Money
+		for _, t := range totals[tag] {
+			sum = sum.Add(t.spent)
+		}
+		return sum
+	}
+	tags := slices.SortedFunc(maps.Keys(totals), func(a, b string) int {
+		return cmp.Or(cmp.Compare(spent(a).Cents, spent(b).Cents), strings.Compare(a, b))
+	})
+	header := []string{"tag", "transactions", "accounts", "first", "last", "spent", "received", "net"}
+	if byFlag != "none" {
+		header = slices.Insert(header, 1, strings.ReplaceAll(byFlag, "-", "_"))
+	}
+	var rows [][]string
+	for _, tag := range tags {
+		for _, key := range slices.Sorted(maps.Keys(totals[tag])) {
+			t := totals[tag][key]
+			row := []string{tag, strconv.Itoa(t.count), strings.Join(t.accounts, "; "), t.first.String(), t.last.String(), t.spent.String(), t.received.String(), t.spent.Add(t.received).String()}
+			if byFlag != "none" {
+				row = slices.Insert(row, 1, key)
+			}
+			rows = append(rows, row)
+		}
+	}
+	slog.Info("Totaled tags", "from", startDate, "to", endDate, "tags", len(tags), "tagged_transactions", tagged)
+	printReport(f.output, header, rows)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+type cachedResponse struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// responseCache persists reference-data responses on disk alongside their
+// validators so later runs can issue conditional requests.
+// A nil cache or empty dir disables caching.
+type responseCache struct {
+	dir string
+}
+
+func newResponseCache(dir string) *responseCache {
+	if dir == "" {
+		return nil
+	}
+	return &responseCache{dir: dir}
+}
+
+func (c *responseCache) Get(key string) (cachedResponse, bool) {
+	if c == nil {
+		return cachedResponse{}, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return cachedResponse{}, false
+	}
+	var resp cachedResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return cachedResponse{}, false
+	}
+	// without a validator the entry can't be revalidated
+	if resp.ETag == "" && resp.LastModified == "" {
+		return cachedResponse{}, false
+	}
+	return resp, true
+}
+
+func (c *responseCache) Put(key string, resp cachedResponse) {
+	if c == nil || (resp.ETag == "" && resp.LastModified == "") {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		slog.Warn("Failed to create cache directory", "err", err)
+		return
+	}
+	if err := os.WriteFile(c.path(key), data, 0o600); err != nil {
+		slog.Warn("Failed to write cache entry", "err", err)
+	}
+}
+
+func (c *responseCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
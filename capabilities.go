@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Capability is an optional actual-http-api endpoint that older servers lack.
+type Capability string
+
+const (
+	CapMonths    Capability = "months"
+	CapSchedules Capability = "schedules"
+	CapRules     Capability = "rules"
+)
+
+// allCapabilities lists the probed endpoints in display order.
+var allCapabilities = []Capability{CapMonths, CapSchedules, CapRules}
+
+// Capabilities records which optional endpoints the server supports.
+type Capabilities map[Capability]bool
+
+// Capabilities probes the optional endpoints once and remembers the result.
+// An endpoint answering 404 is unsupported; any other non-200 response is
+// an error, since it says nothing about the endpoint.
+func (c *actualClient) Capabilities() (Capabilities, error) {
+	c.capsOnce.Do(func() {
+		caps := make(Capabilities, len(allCapabilities))
+		for _, capability := range allCapabilities {
+			url := fmt.Sprintf("%s/budgets/%s/%s", c.baseURL, c.cfg.BudgetSyncID, capability)
+			req, err := c.newRequest(url)
+			if err != nil {
+				c.capsErr = err
+				return
+			}
+			resp, err := c.do(req)
+			if err != nil {
+				c.capsErr = fmt.Errorf("probing %s: %w", capability, err)
+				return
+			}
+			resp.Body.Close() //nolint
+			switch resp.StatusCode {
+			case http.StatusOK:
+				caps[capability] = true
+			case http.StatusNotFound:
+				caps[capability] = false
+			default:
+				c.capsErr = fmt.Errorf("probing %s: unexpected status code: %d", capability, resp.StatusCode)
+				return
+			}
+		}
+		c.caps = caps
+	})
+	return c.caps, c.capsErr
+}
+
+// supports reports whether the server has the endpoint, warning (and
+// answering false) when the server couldn't be probed.
+func supports(client ActualClient, capability Capability) bool {
+	caps, err := client.Capabilities()
+	if err != nil {
+		slog.Warn("Failed to detect server capabilities", "err", err)
+		return false
+	}
+	return caps[capability]
+}
+
+// runCapabilities prints which optional endpoints the server supports.
+func runCapabilities(args []string) {
+	fs := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	var f listFlags
+	f.register(fs)
+	fs.Parse(args) //nolint
+	f.validate()
+
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	caps, err := client.Capabilities()
+	if err != nil {
+		log.Fatalf("Failed to detect server capabilities: %v", err)
+	}
+	var rows [][]string
+	for _, capability := range allCapabilities {
+		rows = append(rows, []string{string(capability), strconv.FormatBool(caps[capability])})
+	}
+	printReport(f.output, []string{"endpoint", "supported"}, rows)
+}
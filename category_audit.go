@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCategoryAuditReport lists categories that are unused, rarely used or
+// only used in old months, to help prune the category tree.
+func runCategoryAuditReport(args []string) {
+	fs := flag.NewFlagSet("report category-audit", flag.ExitOnError)
+	var f reportFlags
+	var staleFlag, rareFlag int
+	var allFlag bool
+	f.register(fs)
+	fs.IntVar(&staleFlag, "stale", 6, "Flag categories not used in this many months")
+	fs.IntVar(&rareFlag, "rare", 3, "Flag categories used fewer than this many times")
+	fs.BoolVar(&allFlag, "all", false, "Also list categories in regular use")
+	fs.Parse(args) //nolint
+	f.validate()
+
+	startDate, endDate, err := lookbackDates(f.from, f.to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	groupsResp, err := client.FetchCategoryGroups()
+	if err != nil {
+		log.Fatalf("Failed to fetch category groups: %v", err)
+	}
+	categoriesResp, err := client.FetchCategories()
+	if err != nil {
+		log.Fatalf("Failed to fetch categories: %v", err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	counts := make(map[string]int)
+	lastUsed := make(map[string]Date)
+	if err := forEachTransaction(client, accountsResp.Data, startDate, endDate, func(_ Account, txn Transaction) {
+		counts[txn.CategoryID]++
+		if txn.Date.After(lastUsed[txn.CategoryID]) {
+			lastUsed[txn.CategoryID] = txn.Date
+		}
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	groupNames := make(map[string]string)
+	for _, g := range groupsResp.Data {
+		groupNames[g.ID] = g.Name
+	}
+	staleBefore := NewDate(time.Now().Local().AddDate(0, -staleFlag, 0))
+
+	categories := categoriesResp.Data
+	slices.SortStableFunc(categories, func(a, b Category) int {
+		if c := lastUsed[a.ID].Compare(lastUsed[b.ID]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	var rows [][]string
+	for _, c := range categories {
+		var status string
+		switch {
+		case counts[c.ID] == 0:
+			status = "unused"
+		case lastUsed[c.ID].Before(staleBefore):
+			status = "stale"
+		case counts[c.ID] < rareFlag:
+			status = "rare"
+		case !allFlag:
+			continue
+		default:
+			status = "ok"
+		}
+		rows = append(rows, []string{c.Name, groupNames[c.GroupID], strconv.Itoa(counts[c.ID]), lastUsed[c.ID].String(), status})
+	}
+	slog.Info("Audited categories", "count", len(categories), "from", startDate, "to", endDate)
+	printReport(f.output, []string{"category", "group", "transactions", "last_used", "status"}, rows)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+var chartPalette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+// chartMaxSlices limits how many categories are drawn; the rest are grouped as "Other".
+const chartMaxSlices = 10
+
+type chartItem struct {
+	Label string
+	Value Money
+}
+
+// spendingItems orders category spending from largest to smallest, folding
+// the tail into "Other" so charts stay legible.
+func spendingItems(msgs messages, spending map[string]Money) []chartItem {
+	var items []chartItem
+	for label, v := range spending {
+		if v.Sign() > 0 {
+			items = append(items, chartItem{Label: label, Value: v})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Value.Cents != items[j].Value.Cents {
+			return items[i].Value.Cents > items[j].Value.Cents
+		}
+		return items[i].Label < items[j].Label
+	})
+	if len(items) > chartMaxSlices {
+		other := chartItem{Label: msgs.Sprintf("chart.other")}
+		for _, item := range items[chartMaxSlices-1:] {
+			other.Value = other.Value.Add(item.Value)
+		}
+		items = append(items[:chartMaxSlices-1], other)
+	}
+	return items
+}
+
+// renderBarChartSVG draws a horizontal bar chart of spending per category.
+func renderBarChartSVG(title string, items []chartItem) string {
+	const width, labelWidth, barHeight, gap, top = 640, 180, 22, 8, 40
+	height := top + len(items)*(barHeight+gap) + 20
+	maxValue := int64(1)
+	for _, item := range items {
+		maxValue = max(maxValue, item.Value.Cents)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="10" y="24" font-size="16" font-weight="bold">%s</text>`+"\n", html.EscapeString(title))
+	barSpace := width - labelWidth - 90
+	for i, item := range items {
+		y := top + i*(barHeight+gap)
+		w := int(math.Round(float64(item.Value.Cents) / float64(maxValue) * float64(barSpace)))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", labelWidth-8, y+barHeight-6, html.EscapeString(item.Label))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", labelWidth, y, w, barHeight, chartPalette[i%len(chartPalette)])
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`+"\n", labelWidth+w+6, y+barHeight-6, item.Value)
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// renderPieChartSVG draws a pie chart of spending share per category with a legend.
+func renderPieChartSVG(title string, items []chartItem) string {
+	const width, cx, cy, r = 640, 170, 200, 140
+	height := max(380, 60+len(items)*22)
+	var total int64
+	for _, item := range items {
+		total += item.Value.Cents
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="10" y="24" font-size="16" font-weight="bold">%s</text>`+"\n", html.EscapeString(title))
+	angle := -math.Pi / 2
+	for i, item := range items {
+		color := chartPalette[i%len(chartPalette)]
+		share := float64(item.Value.Cents) / float64(total)
+		if len(items) == 1 {
+			fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>`+"\n", cx, cy, r, color)
+		} else {
+			end := angle + share*2*math.Pi
+			largeArc := 0
+			if share > 0.5 {
+				largeArc = 1
+			}
+			fmt.Fprintf(&b, `<path d="M%d,%d L%.2f,%.2f A%d,%d 0 %d,1 %.2f,%.2f Z" fill="%s"/>`+"\n",
+				cx, cy,
+				cx+r*math.Cos(angle), cy+r*math.Sin(angle),
+				r, r, largeArc,
+				cx+r*math.Cos(end), cy+r*math.Sin(end),
+				color)
+			angle = end
+		}
+		ly := 60 + i*22
+		fmt.Fprintf(&b, `<rect x="350" y="%d" width="14" height="14" fill="%s"/>`+"\n", ly-11, color)
+		fmt.Fprintf(&b, `<text x="372" y="%d">%s — %s (%.1f%%)</text>`+"\n", ly, html.EscapeString(item.Label), item.Value, share*100)
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// writeSpendingCharts writes {base}.spending-bar.svg and {base}.spending-pie.svg.
+func writeSpendingCharts(msgs messages, base, period string, spending map[string]Money) ([]string, error) {
+	items := spendingItems(msgs, spending)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	title := msgs.Sprintf("chart.title", period)
+	charts := map[string]string{
+		base + ".spending-bar.svg": renderBarChartSVG(title, items),
+		base + ".spending-pie.svg": renderPieChartSVG(title, items),
+	}
+	var written []string
+	for path, svg := range charts {
+		if err := os.WriteFile(path, []byte(svg), 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	sort.Strings(written)
+	return written, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const defaultClass = "personal"
+
+// Classifier tags transactions with a class such as business or personal.
+// Rules come from CLASSIFICATION_RULES and are checked in order:
+//
+//	CLASSIFICATION_RULES=business:account=Biz Checking;business:group=Business;business:payee=(?i)adobe
+//
+// account, group and category match by name or ID; payee is a regexp.
+// Transactions matching no rule get CLASSIFICATION_DEFAULT.
+type Classifier struct {
+	rules      []classRule
+	defaultTo  string
+	groupNames map[string]string
+}
+
+type classRule struct {
+	class   string
+	kind    string
+	value   string
+	pattern *regexp.Regexp
+}
+
+func NewClassifier(rules, defaultTo string) (*Classifier, error) {
+	if defaultTo == "" {
+		defaultTo = defaultClass
+	}
+	c := &Classifier{defaultTo: defaultTo}
+	for _, entry := range strings.Split(rules, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		class, match, ok := strings.Cut(entry, ":")
+		kind, value, ok2 := strings.Cut(match, "=")
+		class, kind = strings.TrimSpace(class), strings.TrimSpace(kind)
+		if !ok || !ok2 || class == "" {
+			return nil, fmt.Errorf("invalid CLASSIFICATION_RULES entry %q: expected class:kind=value", entry)
+		}
+		rule := classRule{class: class, kind: kind, value: strings.TrimSpace(value)}
+		switch kind {
+		case "account", "group", "category":
+		case "payee":
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CLASSIFICATION_RULES payee pattern %q: %w", value, err)
+			}
+			rule.pattern = pattern
+		default:
+			return nil, fmt.Errorf("invalid CLASSIFICATION_RULES entry %q: kind must be account, group, category or payee", entry)
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c, nil
+}
+
+// SetGroups provides category group names so group rules can match by name.
+func (c *Classifier) SetGroups(groups []CategoryGroup) {
+	c.groupNames = make(map[string]string, len(groups))
+	for _, g := range groups {
+		c.groupNames[g.ID] = g.Name
+	}
+}
+
+// NeedsGroups reports whether any rule matches on category group.
+func (c *Classifier) NeedsGroups() bool {
+	for _, rule := range c.rules {
+		if rule.kind == "group" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Classifier) Classify(acct Account, category Category, payeeName string) string {
+	for _, rule := range c.rules {
+		var match bool
+		switch rule.kind {
+		case "account":
+			match = rule.value == acct.Name || rule.value == acct.ID
+		case "group":
+			match = category.GroupID != "" && (rule.value == category.GroupID || rule.value == c.groupNames[category.GroupID])
+		case "category":
+			match = category.ID != "" && (rule.value == category.Name || rule.value == category.ID)
+		case "payee":
+			match = payeeName != "" && rule.pattern.MatchString(payeeName)
+		}
+		if match {
+			return rule.class
+		}
+	}
+	return c.defaultTo
+}
+
+// splitByClass splits the CSV at path into {base}.{class}.csv files using the
+// named class column, then removes the combined file. Rows without a class
+// (balance footers, placeholders) are copied to every file; # comment lines
+// before the header are kept. opts gives the file's delimiter, line endings
+// and the header the column was written under. Class files left by an earlier
+// split of the same export are removed.
+func splitByClass(path, classColumn string, opts CSVOptions) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var preamble []string
+	body := string(data)
+	for strings.HasPrefix(body, "#") {
+		line, rest, _ := strings.Cut(body, "\n")
+		preamble = append(preamble, strings.TrimSuffix(line, "\r"))
+		body = rest
+	}
+
+	r := csv.NewReader(strings.NewReader(body))
+	r.FieldsPerRecord = -1
+	if opts.Delimiter != 0 {
+		r.Comma = opts.Delimiter
+	}
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	name := classColumn
+	if renamed, ok := opts.HeaderNames[classColumn]; ok {
+		name = renamed
+	}
+	col := slices.Index(header, name)
+	if col < 0 {
+		return nil, fmt.Errorf("no %s column to split on", classColumn)
+	}
+
+	var unclassified [][]string
+	byClass := make(map[string][][]string)
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if col >= len(row) || row[col] == "" {
+			unclassified = append(unclassified, row)
+			continue
+		}
+		byClass[row[col]] = append(byClass[row[col]], row)
+	}
+
+	base := strings.TrimSuffix(path, ".csv")
+	var written []string
+	for class, rows := range byClass {
+		out := fmt.Sprintf("%s.%s.csv", base, class)
+		if err := writeCSVFile(out, opts, preamble, header, append(rows, unclassified...)); err != nil {
+			return written, err
+		}
+		written = append(written, out)
+	}
+	sort.Strings(written)
+	headerLine, _, _ := strings.Cut(body, "\n")
+	if err := removeStaleClassFiles(base, strings.TrimSuffix(headerLine, "\r"), written); err != nil {
+		return written, err
+	}
+	return written, os.Remove(path)
+}
+
+// removeStaleClassFiles removes the {base}.{class}.csv files not in keep
+// that start with header, which were left by an earlier split for classes
+// the export no longer has. Other sidecars, like {base}.stats.csv, have
+// their own headers and are left alone.
+func removeStaleClassFiles(base, header string, keep []string) error {
+	entries, err := os.ReadDir(filepath.Dir(base))
+	if err != nil {
+		return err
+	}
+	prefix := filepath.Base(base) + "."
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(filepath.Dir(base), name)
+		class, ok := strings.CutSuffix(strings.TrimPrefix(name, prefix), ".csv")
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !ok || class == "" || slices.Contains(keep, path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		body := string(data)
+		for strings.HasPrefix(body, "#") {
+			_, body, _ = strings.Cut(body, "\n")
+		}
+		if line, _, _ := strings.Cut(body, "\n"); strings.TrimSuffix(line, "\r") != header {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		slog.Info("Removed class file from an earlier export", "path", path)
+	}
+	return nil
+}
+
+func writeCSVFile(path string, opts CSVOptions, preamble []string, header []string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint
+	for _, line := range preamble {
+		if _, err := fmt.Fprint(f, line, opts.lineEnd()); err != nil {
+			return err
+		}
+	}
+	w := opts.newWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	// WriteAll flushes, returning any error writing the rows
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	closedFilename   = "closed.json"
+	closedArchiveDir = "closed"
+)
+
+// closedMonth is a month finalized with `actual2csv close`.
+type closedMonth struct {
+	Month    string    `json:"month"`
+	SHA256   string    `json:"sha256"`
+	Archive  string    `json:"archive"` // read-only copy, relative to the output directory
+	ClosedAt time.Time `json:"closed_at"`
+	// Transactions are the month's transactions by ID when it was closed,
+	// to detect retroactive changes.
+	Transactions map[string]closedTransaction `json:"transactions"`
+}
+
+// closedMonths is the registry of closed months in the output directory,
+// keyed by the export's path relative to it.
+type closedMonths map[string]closedMonth
+
+func loadClosedMonths(dir string) (closedMonths, error) {
+	closed := make(closedMonths)
+	data, err := os.ReadFile(filepath.Join(dir, closedFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return closed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading closed months: %w", err)
+	}
+	if err := json.Unmarshal(data, &closed); err != nil {
+		return nil, fmt.Errorf("decoding closed months: %w", err)
+	}
+	return closed, nil
+}
+
+func (c closedMonths) save(dir string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding closed months: %w", err)
+	}
+	path := filepath.Join(dir, closedFilename)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("writing closed months: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// checkClosed refuses to replace the export at outputPath with partialPath
+// when the export belongs to a closed month and its contents would change.
+// With reopen the change is allowed and the month is no longer closed.
+func checkClosed(dir, outputPath, partialPath string, reopen bool) error {
+	closed, err := loadClosedMonths(dir)
+	if err != nil || len(closed) == 0 {
+		return err
+	}
+	rel, err := filepath.Rel(dir, outputPath)
+	if err != nil {
+		return nil
+	}
+	month, ok := closed[filepath.ToSlash(rel)]
+	if !ok {
+		return nil
+	}
+	sum, err := fileSHA256(partialPath)
+	if err != nil {
+		return err
+	}
+	if sum == month.SHA256 {
+		return nil
+	}
+	if !reopen {
+		return fmt.Errorf("%s was closed on %s and this export would change it; rerun with -reopen to overwrite it (the closed copy is %s)",
+			month.Month, month.ClosedAt.Local().Format(time.DateOnly), filepath.Join(dir, month.Archive))
+	}
+	slog.Warn("Reopening closed month; its closed copy stays", "month", month.Month, "archive", filepath.Join(dir, month.Archive))
+	delete(closed, filepath.ToSlash(rel))
+	return closed.save(dir)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// runClose finalizes a month: it checks that every transaction is reconciled,
+// archives a read-only copy of the month's export and records its checksum,
+// so later exports can't silently change it.
+func runClose(args []string) {
+	fs := flag.NewFlagSet("close", flag.ExitOnError)
+	var cfgFlag configFlags
+	var allowUnreconciledFlag bool
+	cfgFlag.register(fs)
+	fs.BoolVar(&allowUnreconciledFlag, "allow-unreconciled", false, "Close the month even if some transactions aren't reconciled")
+	fs.Parse(args) //nolint
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: actual2csv close [-allow-unreconciled] [-cfg configFilePath] YYYY-MM")
+		os.Exit(2)
+	}
+	month := fs.Arg(0)
+	start, end, err := monthBounds(month)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := loadConfig(cfgFlag)
+	dir := cfg.TransactionOutputDir
+	closed, err := loadClosedMonths(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rel, err := cfg.OutputLayout.Path(month, start.Time)
+	if err != nil {
+		log.Fatal(err)
+	}
+	key := filepath.ToSlash(rel)
+	if c, ok := closed[key]; ok {
+		log.Fatalf("%s was already closed on %s", month, c.ClosedAt.Local().Format(time.DateOnly))
+	}
+	exportPath := filepath.Join(dir, rel)
+	if _, err := os.Stat(exportPath); err != nil {
+		log.Fatalf("No export for %s at %s; run `actual2csv export -from %s` first", month, exportPath, month)
+	}
+
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	_, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+	var rows [][]string
+	transactions := make(map[string]closedTransaction)
+	if err := forEachTransaction(client, accountsResp.Data, start.String(), end.String(), func(account Account, txn Transaction) {
+		transactions[txn.ID] = newClosedTransaction(txn)
+		if !txn.Reconciled && !txn.IsChild {
+			rows = append(rows, []string{account.Name, txn.Date.String(), payeeMap[txn.PayeeID].Name, txn.Amount.String()})
+		}
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if len(rows) > 0 {
+		printReport("table", []string{"account", "date", "payee", "amount"}, rows)
+		if !allowUnreconciledFlag {
+			log.Fatalf("%d transactions in %s aren't reconciled; reconcile them in Actual or use -allow-unreconciled", len(rows), month)
+		}
+		slog.Warn("Closing month with unreconciled transactions", "month", month, "count", len(rows))
+	}
+
+	sum, err := fileSHA256(exportPath)
+	if err != nil {
+		log.Fatalf("Failed to checksum %s: %v", exportPath, err)
+	}
+	// the closing time keeps the copies of a reopened and reclosed month apart
+	closedAt := time.Now()
+	ext := filepath.Ext(rel)
+	archive := filepath.Join(closedArchiveDir, strings.TrimSuffix(rel, ext)+"."+closedAt.Format("20060102T150405")+ext)
+	archivePath := filepath.Join(dir, archive)
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0o755); err != nil {
+		log.Fatalf("Failed to create %s: %v", filepath.Dir(archivePath), err)
+	}
+	archiveFile, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o444)
+	if err != nil {
+		log.Fatalf("Failed to archive %s: %v", exportPath, err)
+	}
+	if err := copyFileTo(archiveFile, exportPath); err != nil {
+		log.Fatalf("Failed to archive %s: %v", exportPath, err)
+	}
+	if err := archiveFile.Close(); err != nil {
+		log.Fatalf("Failed to archive %s: %v", exportPath, err)
+	}
+	closed[key] = closedMonth{Month: month, SHA256: sum, Archive: filepath.ToSlash(archive), ClosedAt: closedAt, Transactions: transactions}
+	if err := closed.save(dir); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("Closed month", "month", month, "archive", archivePath, "sha256", sum)
+}
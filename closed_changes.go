@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// closedTransaction is a transaction's exported fields as of its month's close.
+type closedTransaction struct {
+	AccountID  string `json:"account"`
+	Date       Date   `json:"date"`
+	PayeeID    string `json:"payee"`
+	CategoryID string `json:"category"`
+	Amount     Money  `json:"amount"`
+}
+
+func newClosedTransaction(txn Transaction) closedTransaction {
+	return closedTransaction{
+		AccountID:  txn.AccountID,
+		Date:       txn.Date,
+		PayeeID:    txn.PayeeID,
+		CategoryID: txn.CategoryID,
+		Amount:     txn.Amount,
+	}
+}
+
+// monthBounds returns the first and last day of a YYYY-MM month.
+func monthBounds(month string) (start, end Date, err error) {
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return Date{}, Date{}, fmt.Errorf("invalid month %q: use YYYY-MM", month)
+	}
+	return Date{t}, Date{t.AddDate(0, 1, -1)}, nil
+}
+
+const (
+	exportedFilename = "exported.json"
+	// retroactiveCheckInterval is how long a month's check for retroactive
+	// changes stands before the month is fetched again.
+	retroactiveCheckInterval = 24 * time.Hour
+)
+
+// exportedMonth is a month's transactions as of its last export to a file,
+// for the accounts exported, and when the month was last checked for
+// retroactive changes. Closed months that weren't exported since only record
+// the check.
+type exportedMonth struct {
+	CheckedAt    time.Time                    `json:"checked_at"`
+	Accounts     []string                     `json:"accounts,omitempty"`
+	Transactions map[string]closedTransaction `json:"transactions,omitempty"`
+}
+
+// exportedMonths is the registry of exported months in the output
+// directory, keyed by YYYY-MM.
+type exportedMonths map[string]*exportedMonth
+
+func loadExportedMonths(dir string) (exportedMonths, error) {
+	exported := make(exportedMonths)
+	data, err := os.ReadFile(filepath.Join(dir, exportedFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return exported, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading exported months: %w", err)
+	}
+	if err := json.Unmarshal(data, &exported); err != nil {
+		return nil, fmt.Errorf("decoding exported months: %w", err)
+	}
+	return exported, nil
+}
+
+func (e exportedMonths) save(dir string) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding exported months: %w", err)
+	}
+	path := filepath.Join(dir, exportedFilename)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("writing exported months: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// recordExport replaces the exported accounts' transactions in each whole
+// month of periods with txns, the transactions just exported to a file.
+// Partial months, from -start or -end, aren't recorded.
+func recordExport(dir string, periods []period, accounts []Account, txns map[string]closedTransaction, now time.Time) error {
+	exported, err := loadExportedMonths(dir)
+	if err != nil {
+		return err
+	}
+	ids := accountIDs(accounts)
+	for _, p := range periods {
+		start, end, err := monthBounds(p.Month)
+		if err != nil {
+			return err
+		}
+		if !p.Start.Equal(start.Time) || !p.End.Equal(end.Time) {
+			continue
+		}
+		month := exported[p.Month]
+		if month == nil || month.Transactions == nil {
+			month = &exportedMonth{Transactions: make(map[string]closedTransaction)}
+			exported[p.Month] = month
+		}
+		maps.DeleteFunc(month.Transactions, func(_ string, t closedTransaction) bool { return ids[t.AccountID] })
+		for id, t := range txns {
+			if ids[t.AccountID] && t.Date.Format("2006-01") == p.Month {
+				month.Transactions[id] = t
+			}
+		}
+		for id := range ids {
+			if !slices.Contains(month.Accounts, id) {
+				month.Accounts = append(month.Accounts, id)
+			}
+		}
+		slices.Sort(month.Accounts)
+		month.CheckedAt = now
+	}
+	return exported.save(dir)
+}
+
+// closedChanges compares the transactions of each month closed or exported
+// to a file in dir with what the API returns now, describing every
+// retroactive edit, addition and deletion. Closed months are compared with
+// their close, other months with their last export. Months checked or
+// exported within retroactiveCheckInterval aren't fetched again, and months
+// closed before transactions were recorded are skipped.
+func closedChanges(client ActualClient, dir string, now time.Time) ([]string, error) {
+	closed, err := loadClosedMonths(dir)
+	if err != nil {
+		return nil, err
+	}
+	exported, err := loadExportedMonths(dir)
+	if err != nil || len(closed)+len(exported) == 0 {
+		return nil, err
+	}
+	categoryMap, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		return nil, err
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("fetching accounts: %w", err)
+	}
+	accountNames := make(map[string]string)
+	for _, account := range accountsResp.Data {
+		accountNames[account.ID] = account.Name
+	}
+	accountName := func(id string) string {
+		if n, ok := accountNames[id]; ok {
+			return n
+		}
+		return id
+	}
+	payeeName := func(id string) string {
+		if p, ok := payeeMap[id]; ok {
+			return p.Name
+		}
+		return id
+	}
+	categoryName := func(id string) string {
+		if c, ok := categoryMap[id]; ok {
+			return c.Name
+		}
+		return id
+	}
+	describe := func(t closedTransaction) string {
+		return fmt.Sprintf("%s %s %s %s", accountName(t.AccountID), t.Date, payeeName(t.PayeeID), t.Amount)
+	}
+
+	// what each month is compared with, and the accounts it covers
+	type baseline struct {
+		accounts     []Account
+		transactions map[string]closedTransaction
+	}
+	baselines := make(map[string]baseline)
+	for _, month := range closed {
+		if month.Transactions == nil {
+			slog.Warn("Month was closed without recording its transactions, so it can't be checked for retroactive changes; reopen and close it again to check it", "month", month.Month)
+			continue
+		}
+		baselines[month.Month] = baseline{accountsResp.Data, month.Transactions}
+	}
+	for key, month := range exported {
+		if _, ok := baselines[key]; ok || month.Transactions == nil {
+			continue
+		}
+		var accounts []Account
+		for _, account := range accountsResp.Data {
+			if slices.Contains(month.Accounts, account.ID) {
+				accounts = append(accounts, account)
+			}
+		}
+		baselines[key] = baseline{accounts, month.Transactions}
+	}
+
+	var changes []string
+	checked := 0
+	for _, key := range slices.Sorted(maps.Keys(baselines)) {
+		if e := exported[key]; e != nil && now.Sub(e.CheckedAt) < retroactiveCheckInterval {
+			continue
+		}
+		base := baselines[key]
+		start, end, err := monthBounds(key)
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[string]closedTransaction)
+		if err := forEachTransaction(client, base.accounts, start.String(), end.String(), func(_ Account, txn Transaction) {
+			current[txn.ID] = newClosedTransaction(txn)
+		}); err != nil {
+			return nil, err
+		}
+
+		var monthChanges []string
+		for id, was := range base.transactions {
+			now, ok := current[id]
+			if !ok {
+				monthChanges = append(monthChanges, fmt.Sprintf("%s: %s was deleted or moved to another month", key, describe(was)))
+				continue
+			}
+			var fields []string
+			if now.AccountID != was.AccountID {
+				fields = append(fields, fmt.Sprintf("account %s -> %s", accountName(was.AccountID), accountName(now.AccountID)))
+			}
+			if !now.Date.Equal(was.Date.Time) {
+				fields = append(fields, fmt.Sprintf("date %s -> %s", was.Date, now.Date))
+			}
+			if now.PayeeID != was.PayeeID {
+				fields = append(fields, fmt.Sprintf("payee %s -> %s", payeeName(was.PayeeID), payeeName(now.PayeeID)))
+			}
+			if now.CategoryID != was.CategoryID {
+				fields = append(fields, fmt.Sprintf("category %s -> %s", categoryName(was.CategoryID), categoryName(now.CategoryID)))
+			}
+			if now.Amount.Cents != was.Amount.Cents {
+				fields = append(fields, fmt.Sprintf("amount %s -> %s", was.Amount, now.Amount))
+			}
+			if len(fields) > 0 {
+				monthChanges = append(monthChanges, fmt.Sprintf("%s: %s changed: %s", key, describe(was), strings.Join(fields, ", ")))
+			}
+		}
+		for id, now := range current {
+			if _, ok := base.transactions[id]; !ok {
+				monthChanges = append(monthChanges, fmt.Sprintf("%s: %s was added", key, describe(now)))
+			}
+		}
+		slices.Sort(monthChanges)
+		changes = append(changes, monthChanges...)
+		if exported[key] == nil {
+			exported[key] = &exportedMonth{}
+		}
+		exported[key].CheckedAt = now
+		checked++
+	}
+	if checked > 0 {
+		if err := exported.save(dir); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// reportClosedChanges logs retroactive changes to closed and exported months
+// and sends them to NOTIFY_URL, if set. Failures are only warnings since the
+// export itself succeeded.
+func reportClosedChanges(cfg Config, client ActualClient) {
+	changes, err := closedChanges(client, cfg.TransactionOutputDir, time.Now())
+	if err != nil {
+		slog.Warn("Failed to check closed and exported months for retroactive changes", "err", err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	for _, change := range changes {
+		slog.Warn("Closed or exported month changed", "change", change)
+	}
+	if cfg.NotifyURL == "" {
+		return
+	}
+	notifier, err := NewNotifier(cfg.NotifyURL, cfg.NotifySecret)
+	if err == nil {
+		err = notifier.Notify(fmt.Sprintf("%d retroactive changes to closed or exported months", len(changes)), strings.Join(changes, "\n"))
+	}
+	if err != nil {
+		slog.Warn("Failed to send retroactive changes", "err", err)
+	}
+}
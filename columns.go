@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+)
+
+// columnRegistry lists every column the CSV writer can produce, in their
+// default order, with the flag that adds the optional ones. Account metadata
+// columns (-meta-columns) follow raw_notes and are named after their keys,
+// and the fields of -note-fields follow them.
+var columnRegistry = []struct {
+	name    string
+	flag    string
+	enabled func(opts CSVOptions) bool
+}{
+	{name: "account"},
+	{name: "date"},
+	{name: "payee"},
+	{name: "amount"},
+	{name: "category"},
+	{name: "notes"},
+	{"raw_notes", "-raw-notes", func(opts CSVOptions) bool { return opts.RawNotes }},
+	{"owner", "-owner", func(opts CSVOptions) bool { return opts.Owners != nil }},
+	{"class", "-classify", func(opts CSVOptions) bool { return opts.Classifier != nil }},
+	{"mcc", "-mcc", func(opts CSVOptions) bool { return opts.Merchants != nil }},
+	{"merchant_type", "-mcc", func(opts CSVOptions) bool { return opts.Merchants != nil }},
+	{"city", "-location", func(opts CSVOptions) bool { return opts.Location != "" }},
+	{"state", "-location", func(opts CSVOptions) bool { return opts.Location != "" }},
+	{"day_of_week", "-day-columns", func(opts CSVOptions) bool { return opts.DayColumns }},
+	{"is_weekend", "-day-columns", func(opts CSVOptions) bool { return opts.DayColumns }},
+	{"week_of_month", "-day-columns", func(opts CSVOptions) bool { return opts.DayColumns }},
+	{"pay_period", "-pay-period", func(opts CSVOptions) bool { return opts.PayPeriods != nil }},
+	{"net", "-vat", func(opts CSVOptions) bool { return opts.VATRates != nil }},
+	{"tax", "-vat", func(opts CSVOptions) bool { return opts.VATRates != nil }},
+	{"gross", "-vat", func(opts CSVOptions) bool { return opts.VATRates != nil }},
+	// written in place of amount unless -columns says otherwise, see displayColumns
+	{"debit", "-debit-credit", func(opts CSVOptions) bool { return opts.DebitCredit }},
+	{"credit", "-debit-credit", func(opts CSVOptions) bool { return opts.DebitCredit }},
+}
+
+// headers are the columns every export has.
+var headers = registryColumns(CSVOptions{})
+
+// registryColumns returns the columns opts enables, in their default order.
+func registryColumns(opts CSVOptions) []string {
+	var columns []string
+	for _, c := range columnRegistry {
+		if c.enabled == nil || c.enabled(opts) {
+			columns = append(columns, c.name)
+		}
+		if c.name == "raw_notes" {
+			columns = append(columns, opts.MetaColumns...)
+			columns = append(columns, opts.NotePatterns.Fields()...)
+		}
+	}
+	return columns
+}
+
+// displayColumns returns the columns written without -columns: all of them,
+// except that -debit-credit replaces amount with debit and credit.
+func displayColumns(opts CSVOptions) []string {
+	columns := registryColumns(opts)
+	if !opts.DebitCredit {
+		return columns
+	}
+	var out []string
+	for _, c := range columns {
+		switch c {
+		case "amount":
+			out = append(out, "debit", "credit")
+		case "debit", "credit":
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// writtenColumns returns the columns an export writes, in order: -columns
+// or displayColumns.
+func writtenColumns(opts CSVOptions) []string {
+	if len(opts.Columns) > 0 {
+		return opts.Columns
+	}
+	return displayColumns(opts)
+}
+
+// columnNames returns the name of every column in the registry.
+func columnNames() []string {
+	names := make([]string, len(columnRegistry))
+	for i, c := range columnRegistry {
+		names[i] = c.name
+	}
+	return names
+}
+
+// knownColumns returns every column an export can have: the registry's,
+// ACCOUNT_METADATA keys for -meta-columns and NOTE_PATTERNS fields.
+func knownColumns(meta AccountMetadata, notes NotePatterns) map[string]bool {
+	known := make(map[string]bool)
+	for _, name := range slices.Concat(columnNames(), notes.Fields()) {
+		known[name] = true
+	}
+	for _, kv := range meta {
+		for key := range kv {
+			known[key] = true
+		}
+	}
+	return known
+}
+
+// parseDelimiter parses -delimiter: a single character, or "\t" or "tab"
+// for tabs.
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	r := []rune(s)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' || r[0] == utf8.RuneError {
+		return 0, fmt.Errorf("invalid -delimiter value %q", s)
+	}
+	return r[0], nil
+}
+
+// checkColumns reports -columns entries that opts doesn't make available.
+func checkColumns(opts CSVOptions) error {
+	available := registryColumns(opts)
+	for _, name := range opts.Columns {
+		if slices.Contains(available, name) {
+			continue
+		}
+		for _, c := range columnRegistry {
+			if c.name == name {
+				return fmt.Errorf("column %q needs %s", name, c.flag)
+			}
+		}
+		return fmt.Errorf("unknown column %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// runCompareReport compares two months category by category, with the
+// change in spending and the payees that appear in only one of them.
+func runCompareReport(args []string) {
+	fs := flag.NewFlagSet("report compare", flag.ExitOnError)
+	var cfgFlag configFlags
+	var outputFlag, sourceFlag string
+	var topFlag int
+	cfgFlag.register(fs)
+	fs.StringVar(&outputFlag, "output", "table", "Output format: table, csv")
+	fs.StringVar(&sourceFlag, "source-of-truth", "api", "Where category spending comes from: api (the budget months endpoint, falling back to transactions), computed (transactions)")
+	fs.IntVar(&topFlag, "top", 10, "List at most this many new and missing payees each, largest first (0 lists all)")
+	fs.Parse(args) //nolint
+	f := reportFlags{output: outputFlag}
+	f.validate()
+	validateSourceOfTruth(sourceFlag)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: actual2csv report compare [-top N] [-output table|csv] [-source-of-truth api|computed] YYYY-MM YYYY-MM")
+		os.Exit(2)
+	}
+	months := [2]string{fs.Arg(0), fs.Arg(1)}
+
+	cfg := loadConfig(cfgFlag)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	categoryMap, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	groupsResp, err := client.FetchCategoryGroups()
+	if err != nil {
+		log.Fatalf("Failed to fetch category groups: %v", err)
+	}
+	groupNames := make(map[string]string)
+	for _, g := range groupsResp.Data {
+		groupNames[g.ID] = g.Name
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	// totals by category and payee ID, one per month
+	var categoryTotals, payeeTotals [2]map[string]Money
+	var budgets [2]BudgetMonth
+	fromAPI := true
+	for i, month := range months {
+		start, end, err := monthBounds(month)
+		if err != nil {
+			log.Fatal(err)
+		}
+		categoryTotals[i], payeeTotals[i] = make(map[string]Money), make(map[string]Money)
+		if err := forEachTransaction(client, accountsResp.Data, start.String(), end.String(), func(_ Account, txn Transaction) {
+			categoryTotals[i][txn.CategoryID] = categoryTotals[i][txn.CategoryID].Add(txn.Amount)
+			payeeTotals[i][txn.PayeeID] = payeeTotals[i][txn.PayeeID].Add(txn.Amount)
+		}); err != nil {
+			log.Fatal(err)
+		}
+		budget, ok, err := fetchBudgetMonth(client, sourceFlag, month, categoryTotals[i])
+		if err != nil {
+			log.Fatal(err)
+		}
+		budgets[i], fromAPI = budget, fromAPI && ok
+	}
+	if fromAPI {
+		// uncategorized spending, such as transfers, and income have no
+		// spending in the budget and stay computed
+		for i := range months {
+			for _, group := range budgets[i].CategoryGroups {
+				for _, category := range group.Categories {
+					if category.IsIncome {
+						continue
+					}
+					categoryTotals[i][category.ID] = category.Spent
+					if category.Spent.Cents == 0 {
+						delete(categoryTotals[i], category.ID)
+					}
+				}
+			}
+		}
+	}
+
+	type delta struct {
+		kind, name, group string
+		a, b              Money
+	}
+	var categories []delta
+	for id := range unionKeys(categoryTotals[0], categoryTotals[1]) {
+		name, group := uncategorizedAccount, ""
+		if c, ok := categoryMap[id]; ok {
+			name, group = c.Name, groupNames[c.GroupID]
+		}
+		categories = append(categories, delta{"category", name, group, categoryTotals[0][id], categoryTotals[1][id]})
+	}
+	// biggest moves first
+	slices.SortFunc(categories, func(x, y delta) int {
+		return cmp.Or(cmp.Compare(y.b.Sub(y.a).Abs().Cents, x.b.Sub(x.a).Abs().Cents), cmp.Compare(x.name, y.name))
+	})
+
+	payees := func(kind string, in, notIn map[string]Money) []delta {
+		var ds []delta
+		for id, total := range in {
+			if _, ok := notIn[id]; ok || id == "" {
+				continue
+			}
+			name := id
+			if p, ok := payeeMap[id]; ok {
+				name = p.Name
+			}
+			d := delta{kind: kind, name: name}
+			if kind == "new-payee" {
+				d.b = total
+			} else {
+				d.a = total
+			}
+			ds = append(ds, d)
+		}
+		slices.SortFunc(ds, func(x, y delta) int {
+			return cmp.Or(cmp.Compare(y.a.Add(y.b).Abs().Cents, x.a.Add(x.b).Abs().Cents), cmp.Compare(x.name, y.name))
+		})
+		if topFlag > 0 && len(ds) > topFlag {
+			ds = ds[:topFlag]
+		}
+		return ds
+	}
+
+	var budgetRows []delta
+	if fromAPI {
+		budgetRows = []delta{
+			{kind: "budget", name: "budgeted", a: budgets[0].TotalBudgeted, b: budgets[1].TotalBudgeted},
+			{kind: "budget", name: "to-budget", a: budgets[0].ToBudget, b: budgets[1].ToBudget},
+		}
+	}
+
+	var rows [][]string
+	for _, d := range slices.Concat(budgetRows, categories, payees("new-payee", payeeTotals[1], payeeTotals[0]), payees("missing-payee", payeeTotals[0], payeeTotals[1])) {
+		rows = append(rows, []string{d.kind, d.name, d.group, d.a.String(), d.b.String(), d.b.Sub(d.a).String(), percentChange(d.a, d.b)})
+	}
+	slog.Info("Compared months", "from", months[0], "to", months[1], "categories", len(categories), "from_api", fromAPI)
+	printReport(f.output, []string{"kind", "name", "group", months[0], months[1], "delta", "change"}, rows)
+}
+
+// unionKeys returns the keys present in either map.
+func unionKeys(a, b map[string]Money) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+// percentChange formats how much bigger or smaller b is than a, so more
+// spending and more income both show as increases, or "new" when a is zero.
+func percentChange(a, b Money) string {
+	switch {
+	case a.Cents == 0 && b.Cents == 0:
+		return "+0.0%"
+	case a.Cents == 0:
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(b.Abs().Cents-a.Abs().Cents)/float64(a.Abs().Cents)*100)
+}
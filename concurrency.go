@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// adaptiveFetchAttempts is how often a transaction request is tried with
+// -latency-target, which retries failures after backing off instead of
+// failing the export.
+const adaptiveFetchAttempts = 3
+
+// fetchLimiter caps the transaction requests in flight. With a latency
+// target it adapts the cap AIMD style, like TCP congestion control: it starts
+// at one request, adds one per round of requests answered within the target
+// and halves whenever a request is slower or fails, so long backfills back
+// off before they overwhelm a small server. Without a target the cap stays at
+// max.
+type fetchLimiter struct {
+	max    int
+	target time.Duration
+
+	mu           sync.Mutex
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+	changed      chan struct{} // closed when a slot may have opened
+}
+
+func newFetchLimiter(maxInFlight int, target time.Duration) *fetchLimiter {
+	l := &fetchLimiter{max: max(maxInFlight, 1), target: target, changed: make(chan struct{})}
+	l.limit = float64(l.max)
+	if target > 0 {
+		l.limit = 1
+	}
+	return l
+}
+
+// acquire waits for a slot, failing only if ctx is done first.
+func (l *fetchLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees a slot taken by acquire.
+func (l *fetchLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.wake()
+}
+
+// observe adapts the limit to how long a request took and whether it failed.
+func (l *fetchLimiter) observe(latency time.Duration, err error) {
+	if l.target <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil && latency <= l.target {
+		old := int(l.limit)
+		l.limit = min(l.limit+1/l.limit, float64(l.max))
+		if int(l.limit) > old {
+			slog.Debug("Raised fetch concurrency", "concurrency", int(l.limit), "latency", latency)
+			l.wake()
+		}
+		return
+	}
+	// requests already in flight when the limit was cut report the same
+	// congestion; count it once
+	if time.Since(l.lastDecrease) < max(latency, l.target) {
+		return
+	}
+	l.lastDecrease = time.Now()
+	old := int(l.limit)
+	l.limit = max(l.limit/2, 1)
+	if int(l.limit) < old {
+		slog.Info("Server is slow, lowering fetch concurrency", "concurrency", int(l.limit), "latency", latency, "err", err)
+	}
+}
+
+// wake unblocks acquire calls; l.mu must be held.
+func (l *fetchLimiter) wake() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
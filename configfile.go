@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFlags locate the configuration: the .env file and, optionally, a
+// structured YAML or TOML config file. Settings come from the environment
+// (including the .env file) first and the config file second; the config
+// file's [export] section supplies defaults for export flags not given on the
+// command line. The logging and time zone flags ride along since every
+// command loads its configuration first.
+type configFlags struct {
+	env, file           string
+	logLevel, logFormat string
+	timezone            string
+}
+
+func (f *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.env, "cfg", "./.env", "Path to .env configuration file")
+	fs.StringVar(&f.file, "config", "", "Path to a YAML or TOML config file with settings and export flag defaults")
+	fs.StringVar(&f.logLevel, "log-level", "", "Minimum level logged: debug, info, warn, error (defaults to LOG_LEVEL or info)")
+	fs.StringVar(&f.logFormat, "log-format", "", "Log format: text, json (defaults to LOG_FORMAT or text)")
+	fs.StringVar(&f.timezone, "timezone", "", "IANA time zone deciding the current month and day, e.g. America/Los_Angeles (defaults to TIMEZONE or the system's)")
+}
+
+// args returns the flags that select the same configuration in a child process.
+func (f configFlags) args() []string {
+	args := []string{"-cfg", f.env}
+	if f.file != "" {
+		args = append(args, "-config", f.file)
+	}
+	if f.logLevel != "" {
+		args = append(args, "-log-level", f.logLevel)
+	}
+	if f.logFormat != "" {
+		args = append(args, "-log-format", f.logFormat)
+	}
+	if f.timezone != "" {
+		args = append(args, "-timezone", f.timezone)
+	}
+	return args
+}
+
+// read parses the config file, if there is one.
+func (f configFlags) read() (configFile, error) {
+	if f.file == "" {
+		return nil, nil
+	}
+	return readConfigFile(f.file)
+}
+
+// configFile holds a config file's values by section; top-level keys are in
+// the "" section. Lists are joined with commas, like the .env settings.
+type configFile map[string]map[string]string
+
+// readConfigFile parses a .yaml/.yml or .toml file. Only the subset needed for
+// flat settings is supported: one level of sections, scalar values and lists
+// of scalars. Anything else, such as nested mappings or multi-line lists, is
+// an error naming its line rather than being misread.
+func readConfigFile(path string) (configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cf configFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		cf, err = parseTOMLConfig(string(data))
+	case ".yaml", ".yml":
+		cf, err = parseYAMLConfig(string(data))
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return cf, nil
+}
+
+func (cf configFile) set(section, key, value string) {
+	if cf[section] == nil {
+		cf[section] = make(map[string]string)
+	}
+	cf[section][key] = value
+}
+
+func parseTOMLConfig(data string) (configFile, error) {
+	cf := make(configFile)
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables aren't supported", n)
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if strings.Contains(section, ".") {
+				return nil, fmt.Errorf("line %d: nested tables aren't supported", n)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		if key = strings.TrimSpace(key); unquote(key) == key && strings.Contains(key, ".") {
+			return nil, fmt.Errorf("line %d: dotted keys aren't supported", n)
+		}
+		v, err := configValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		cf.set(section, unquote(key), v)
+	}
+	return cf, scanner.Err()
+}
+
+func parseYAMLConfig(data string) (configFile, error) {
+	cf := make(configFile)
+	// section is the current top-level mapping, whose keys are indented by
+	// sectionIndent once one is seen; "- item" lines are collected into list
+	// for listKey in listSection
+	var section, listSection, listKey string
+	var sectionIndent int
+	var list []string
+	flush := func() {
+		if len(list) > 0 {
+			cf.set(listSection, listKey, strings.Join(list, ","))
+		}
+		listKey, list = "", nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		raw := stripComment(scanner.Text())
+		line := strings.TrimSpace(raw)
+		if line == "" || line == "---" {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+		if item, ok := strings.CutPrefix(line, "- "); ok {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item outside a list", n)
+			}
+			item = strings.TrimSpace(item)
+			if unquote(item) == item && (strings.Contains(item, ": ") || strings.HasSuffix(item, ":")) {
+				return nil, fmt.Errorf("line %d: lists of mappings aren't supported", n)
+			}
+			if err := yamlScalar(item); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			v, err := configValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			list = append(list, v)
+			continue
+		}
+		flush()
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, value = unquote(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch {
+		case indent == 0:
+			section, sectionIndent = "", 0
+		case section == "":
+			return nil, fmt.Errorf("line %d: unexpected indentation", n)
+		case sectionIndent == 0:
+			sectionIndent = indent
+		case indent != sectionIndent:
+			return nil, fmt.Errorf("line %d: nested mappings aren't supported; sections hold only settings and lists", n)
+		}
+		if value == "" {
+			// either a section or a block list, depending on the lines that follow
+			listSection, listKey = section, key
+			if indent == 0 {
+				section = key
+			}
+			continue
+		}
+		if err := yamlScalar(value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		v, err := configValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		cf.set(section, key, v)
+	}
+	flush()
+	return cf, scanner.Err()
+}
+
+// yamlScalar rejects YAML values that configValue would misread: block
+// scalars, anchors, aliases and tags.
+func yamlScalar(s string) error {
+	switch {
+	case strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return errors.New("block scalars aren't supported; put the value on one line")
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*"):
+		return errors.New("anchors and aliases aren't supported")
+	case strings.HasPrefix(s, "!"):
+		return errors.New("tags aren't supported")
+	}
+	return nil
+}
+
+// configValue decodes a scalar or an inline [a, b] list.
+func configValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, "{"):
+		return "", errors.New("inline tables and mappings aren't supported")
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return "", errors.New("multi-line strings aren't supported")
+	}
+	if strings.HasPrefix(s, "[") {
+		if !strings.HasSuffix(s, "]") {
+			return "", errors.New("multi-line lists aren't supported; put the list on one line")
+		}
+		var items []string
+		for _, item := range strings.Split(s[1:len(s)-1], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			if strings.HasPrefix(item, "[") || strings.HasPrefix(item, "{") {
+				return "", errors.New("nested lists aren't supported")
+			}
+			items = append(items, unquote(item))
+		}
+		return strings.Join(items, ","), nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return v, nil
+	}
+	return unquote(s), nil
+}
+
+// unquote removes matching single or double quotes around s.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// stripComment removes a # comment that isn't inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// applyEnv sets each top-level setting that isn't already in the environment.
+// Keys are the .env names, case-insensitively.
+func (cf configFile) applyEnv() {
+	for key, value := range cf[""] {
+		key = strings.ToUpper(key)
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value) //nolint
+		}
+	}
+}
+
+// applyFlags sets the flags in the section named after fs that weren't given
+// on the command line.
+func (cf configFile) applyFlags(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range cf[fs.Name()] {
+		name = strings.TrimLeft(name, "-")
+		if given[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("config file [%s] has unknown flag %q", fs.Name(), name)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config file [%s] %s: %w", fs.Name(), name, err)
+		}
+	}
+	return nil
+}
@@ -1,42 +1,250 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var headers = []string{
-	"account",
-	"date",
-	"payee",
-	"amount",
-	"category",
-	"notes",
+type CSVWriter interface {
+	TransactionWriter
 }
 
-type CSVWriter interface {
-	Add(Account, []Transaction) error
+// CSVOptions customizes the CSV output.
+type CSVOptions struct {
+	// HeaderNames overrides the header written for a column, keyed by column name.
+	HeaderNames map[string]string
+	// Columns selects and orders the columns written; empty writes all of them.
+	Columns []string
+	// Delimiter separates fields; zero means a comma.
+	Delimiter rune
+	// CRLF ends lines with \r\n instead of \n.
+	CRLF bool
+	// QuoteAll quotes every field, not just those that need it.
+	QuoteAll bool
+	// DecimalComma writes amounts as 12,34 instead of 12.34.
+	DecimalComma bool
+	// DebitCredit writes outflows to a debit column and inflows to a credit
+	// column, both positive, instead of a signed amount.
+	DebitCredit bool
+	// Redaction drops or hashes columns of transaction rows, hashing with RedactionKey.
+	Redaction    Redaction
+	RedactionKey string
+	// Preamble lines are written as "# " comments before the header.
+	Preamble []string
+	// SanitizeNotes strips non-printable characters from notes.
+	SanitizeNotes bool
+	// NotesMax caps notes at this many characters; 0 means no limit.
+	NotesMax int
+	// RawNotes adds a raw_notes column with the notes as returned by the API.
+	RawNotes bool
+	// MetaColumns adds a column per account metadata key, filled from AccountMetadata.
+	MetaColumns     []string
+	AccountMetadata AccountMetadata
+	// NotePatterns adds a column per named group, extracted from the notes.
+	NotePatterns NotePatterns
+	// Owners adds an owner column attributing each row to a household member.
+	Owners *OwnerResolver
+	// Classifier adds a class column, e.g. business or personal.
+	Classifier *Classifier
+	// Merchants adds mcc and merchant_type columns from the payee.
+	Merchants *MerchantCategories
+	// Location adds city and state columns parsed from the imported payee:
+	// raw as the bank wrote them, or clean.
+	Location string
+	// DayColumns adds day_of_week, is_weekend and week_of_month columns
+	// derived from the date.
+	DayColumns bool
+	// PayPeriods adds a pay_period column with the first day of the
+	// transaction's pay period.
+	PayPeriods *PayPeriods
+	// VATRates adds net, tax and gross columns for tax-inclusive categories.
+	VATRates VATRates
+	// DerivedRules add synthetic rows (mileage, per diem) after transactions whose notes match.
+	DerivedRules []DerivedRule
+	// Flush holds rows in memory across Add calls until a limit is reached.
+	Flush FlushPolicy
+	// Liabilities writes rows of accounts marked type=liability in AccountMetadata
+	// as postings debiting the account column and crediting the category column.
+	Liabilities bool
 }
 
 type csvWriter struct {
-	w           *csv.Writer
+	out         io.Writer
+	buf         bytes.Buffer // rows not yet written to out
+	pending     int          // number of rows in buf
+	w           recordWriter
 	categoryMap map[string]Category
 	payeeMap    map[string]Payee
+	opts        CSVOptions
+	columns     []string
+	selected    []int // indexes into columns of the columns written, if not all of them
+	debit       int   // index of the debit column, or -1
+	credit      int   // index of the credit column, or -1
 }
 
-func NewCSVWriter(w io.Writer, categories map[string]Category, payeeMap map[string]Payee) CSVWriter {
-	o := &csvWriter{
-		w:           csv.NewWriter(w),
+func NewCSVWriter(w io.Writer, categories map[string]Category, payeeMap map[string]Payee, opts CSVOptions) CSVWriter {
+	columns := registryColumns(opts)
+	cw := &csvWriter{
+		out:         w,
 		categoryMap: categories,
 		payeeMap:    payeeMap,
+		opts:        opts,
+		columns:     columns,
+		debit:       slices.Index(columns, "debit"),
+		credit:      slices.Index(columns, "credit"),
+	}
+	display := opts.Columns
+	if len(display) == 0 && opts.DebitCredit {
+		display = displayColumns(opts)
+	}
+	// unknown columns, which checkColumns rejects up front, are left empty
+	for _, name := range display {
+		cw.selected = append(cw.selected, slices.Index(columns, name))
+	}
+	cw.w = opts.newWriter(&cw.buf)
+	return cw
+}
+
+// recordWriter is the part of csv.Writer the CSV output uses.
+type recordWriter interface {
+	Write(record []string) error
+	WriteAll(records [][]string) error
+	Flush()
+	Error() error
+}
+
+// newWriter returns a csv.Writer using the options' delimiter and line
+// endings, or a quoteAllWriter for QuoteAll.
+func (opts CSVOptions) newWriter(out io.Writer) recordWriter {
+	comma := ','
+	if opts.Delimiter != 0 {
+		comma = opts.Delimiter
 	}
-	if err := o.w.Write(headers); err != nil {
-		panic(err)
+	if opts.QuoteAll {
+		return &quoteAllWriter{w: bufio.NewWriter(out), comma: comma, crlf: opts.CRLF}
 	}
-	o.w.Flush()
-	return o
+	w := csv.NewWriter(out)
+	w.Comma = comma
+	w.UseCRLF = opts.CRLF
+	return w
+}
+
+// quoteAllWriter writes records like csv.Writer but quotes every field, which
+// csv.Writer can't be told to do.
+type quoteAllWriter struct {
+	w     *bufio.Writer
+	comma rune
+	crlf  bool
+}
+
+func (q *quoteAllWriter) Write(record []string) error {
+	var b strings.Builder
+	for i, field := range record {
+		if i > 0 {
+			b.WriteRune(q.comma)
+		}
+		b.WriteByte('"')
+		for _, r := range field {
+			switch {
+			case r == '"':
+				b.WriteString(`""`)
+			case r == '\r' && q.crlf:
+				// dropped like csv.Writer does; \n becomes \r\n
+			case r == '\n' && q.crlf:
+				b.WriteString("\r\n")
+			default:
+				b.WriteRune(r)
+			}
+		}
+		b.WriteByte('"')
+	}
+	if q.crlf {
+		b.WriteString("\r\n")
+	} else {
+		b.WriteByte('\n')
+	}
+	_, err := q.w.WriteString(b.String())
+	return err
+}
+
+func (q *quoteAllWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := q.Write(record); err != nil {
+			return err
+		}
+	}
+	return q.w.Flush()
+}
+
+func (q *quoteAllWriter) Flush() {
+	q.w.Flush() //nolint
+}
+
+// Error reports any error from a previous Write or Flush.
+func (q *quoteAllWriter) Error() error {
+	_, err := q.w.Write(nil)
+	return err
+}
+
+// lineEnd is what ends the lines the csv.Writer doesn't write, e.g. the preamble.
+func (opts CSVOptions) lineEnd() string {
+	if opts.CRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// commit accounts for rows just written to buf and writes buf out when the
+// flush policy (or force) says so.
+func (w *csvWriter) commit(rows int, force bool) error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		return err
+	}
+	w.pending += rows
+	_, err := w.Flush(force || w.opts.Flush == FlushPolicy{})
+	return err
+}
+
+func (w *csvWriter) Flush(force bool) (bool, error) {
+	if w.buf.Len() == 0 {
+		return true, nil
+	}
+	p := w.opts.Flush
+	if !force && (p.Rows <= 0 || w.pending < p.Rows) && (p.Bytes <= 0 || int64(w.buf.Len()) < p.Bytes) {
+		return false, nil
+	}
+	if _, err := w.buf.WriteTo(w.out); err != nil {
+		return false, err
+	}
+	w.pending = 0
+	return true, nil
+}
+
+func (w *csvWriter) WriteHeader() error {
+	for _, line := range w.opts.Preamble {
+		if _, err := fmt.Fprintf(&w.buf, "# %s%s", line, w.opts.lineEnd()); err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(w.columns))
+	for i, h := range w.columns {
+		row[i] = h
+		if name, ok := w.opts.HeaderNames[h]; ok {
+			row[i] = name
+		}
+	}
+	if err := w.w.Write(w.project(row)); err != nil {
+		return err
+	}
+	return w.commit(0, true)
 }
 
 func (w *csvWriter) Add(acct Account, txns []Transaction) error {
@@ -45,14 +253,45 @@ func (w *csvWriter) Add(acct Account, txns []Transaction) error {
 	}
 	var rows [][]string
 	for _, txn := range txns {
-		row := w.transactionToRow(acct, txn)
-		rows = append(rows, row)
+		rows = append(rows, w.project(w.transactionToRow(acct, txn)))
+		for _, row := range w.derivedRows(acct, txn) {
+			rows = append(rows, w.project(row))
+		}
 	}
 	if err := w.w.WriteAll(rows); err != nil {
 		return err
 	}
-	w.w.Flush()
-	return nil
+	return w.commit(len(rows), false)
+}
+
+func (w *csvWriter) WritePlaceholder(date Date, note string) error {
+	if err := w.w.Write(w.project(w.redact(w.withDebitCredit(w.pad([]string{"", date.String(), "", w.amount(Money{}), "", note}), Money{})))); err != nil {
+		return err
+	}
+	return w.commit(1, true)
+}
+
+func (w *csvWriter) WriteGap(account, category string, date Date) error {
+	if err := w.w.Write(w.project(w.redact(w.withDebitCredit(w.pad([]string{account, date.String(), "", w.amount(Money{}), category, "No transactions"}), Money{})))); err != nil {
+		return err
+	}
+	return w.commit(1, false)
+}
+
+func (w *csvWriter) WriteBalanceFooter(acct Account, b BalanceSummary) error {
+	rows := [][]string{
+		w.withDebitCredit(w.pad([]string{acct.Name, b.StartDate.String(), "Opening balance", w.amount(b.Opening), "", ""}), b.Opening),
+		w.withDebitCredit(w.pad([]string{acct.Name, b.EndDate.String(), "Total debits", w.amount(b.Debits), "", ""}), b.Debits),
+		w.withDebitCredit(w.pad([]string{acct.Name, b.EndDate.String(), "Total credits", w.amount(b.Credits), "", ""}), b.Credits),
+		w.withDebitCredit(w.pad([]string{acct.Name, b.EndDate.String(), "Closing balance", w.amount(b.Closing), "", ""}), b.Closing),
+	}
+	for i, row := range rows {
+		rows[i] = w.project(w.redact(row))
+	}
+	if err := w.w.WriteAll(rows); err != nil {
+		return err
+	}
+	return w.commit(len(rows), false)
 }
 
 func (w *csvWriter) transactionToRow(account Account, transaction Transaction) []string {
@@ -65,7 +304,6 @@ func (w *csvWriter) transactionToRow(account Account, transaction Transaction) [
 	if c := w.categoryMap[transaction.CategoryID]; c != (Category{}) {
 		if c.IsIncome {
 			// flip posting source / destination
-			transaction.Amount *= 1
 			categoryName = account.Name
 			accountName = c.Name
 		} else {
@@ -74,15 +312,156 @@ func (w *csvWriter) transactionToRow(account Account, transaction Transaction) [
 		}
 	}
 
-	dollars := transaction.Amount / 100
-	cents := int(math.Abs(float64(transaction.Amount))) % 100
+	amount := w.amount(transaction.Amount)
+
+	if w.opts.Liabilities && w.opts.AccountMetadata.IsLiability(account) {
+		// card payments put the payee in the category column, so it's redacted as the payee there too
+		payeeRedacted := w.opts.Redaction.value("payee", payeeName, w.opts.RedactionKey)
+		accountName, categoryName, amount = w.liabilityPosting(account, transaction, payeeRedacted, categoryName)
+	}
+
+	notes := transaction.Notes
+	if w.opts.SanitizeNotes {
+		notes = sanitizeNotes(notes)
+	}
+	notes = truncateNotes(notes, w.opts.NotesMax)
 
-	return []string{
+	row := []string{
 		accountName,
-		transaction.Date,
+		transaction.Date.String(),
 		payeeName,
-		fmt.Sprintf("%d.%02d", dollars, cents),
+		amount,
 		categoryName,
-		transaction.Notes,
+		notes,
+	}
+	if w.opts.RawNotes {
+		row = append(row, transaction.Notes)
+	}
+	meta := w.opts.AccountMetadata.For(account)
+	for _, key := range w.opts.MetaColumns {
+		row = append(row, meta[key])
+	}
+	if w.opts.NotePatterns != nil {
+		fields := w.opts.NotePatterns.Extract(transaction.Notes)
+		for _, name := range w.opts.NotePatterns.Fields() {
+			row = append(row, fields[name])
+		}
+	}
+	if w.opts.Owners != nil {
+		row = append(row, w.opts.Owners.Owner(account, payeeName))
+	}
+	if w.opts.Classifier != nil {
+		row = append(row, w.opts.Classifier.Classify(account, w.categoryMap[transaction.CategoryID], payeeName))
+	}
+	if w.opts.Merchants != nil {
+		mcc, merchantType := w.opts.Merchants.Lookup(payeeName, transaction)
+		row = append(row, mcc, merchantType)
+	}
+	if w.opts.Location != "" {
+		imported := payeeName
+		if transaction.ImportedPayee != nil {
+			imported = *transaction.ImportedPayee
+		}
+		city, region := parseLocation(imported)
+		if w.opts.Location == "clean" && city != "" {
+			city = cleanCity(city)
+		}
+		row = append(row, city, region)
+	}
+	if w.opts.DayColumns {
+		weekday := transaction.Date.Weekday()
+		weekend := weekday == time.Saturday || weekday == time.Sunday
+		// days 1-7 are the first week, 8-14 the second and so on
+		row = append(row, weekday.String(), strconv.FormatBool(weekend), strconv.Itoa((transaction.Date.Day()-1)/7+1))
+	}
+	if w.opts.PayPeriods != nil {
+		row = append(row, w.opts.PayPeriods.Start(transaction.Date).String())
+	}
+	if w.opts.VATRates != nil {
+		net, tax := w.opts.VATRates.Split(w.categoryMap[transaction.CategoryID], transaction.Amount)
+		row = append(row, w.amount(net), w.amount(tax), w.amount(transaction.Amount))
+	}
+	return w.redact(w.withDebitCredit(w.pad(row), transaction.Amount))
+}
+
+// liabilityPosting maps a credit card or other liability transaction to a
+// posting with a positive amount: purchases debit the expense and credit the
+// card, while payments and refunds debit the card and credit their source.
+func (w *csvWriter) liabilityPosting(account Account, txn Transaction, payeeName, categoryName string) (debit, credit, amount string) {
+	if categoryName == "" && w.payeeMap[txn.PayeeID].TransferAccount != "" {
+		// card payments are transfers; Actual names transfer payees after the other account
+		categoryName = payeeName
+	}
+	if txn.Amount.Sign() < 0 {
+		return categoryName, account.Name, w.amount(txn.Amount.Neg())
+	}
+	return account.Name, categoryName, w.amount(txn.Amount)
+}
+
+// withDebitCredit fills row's debit or credit cell from m for DebitCredit:
+// outflows are debits and inflows credits.
+func (w *csvWriter) withDebitCredit(row []string, m Money) []string {
+	switch {
+	case w.debit < 0:
+	case m.Sign() < 0:
+		row[w.debit] = w.amount(m.Neg())
+	case m.Sign() > 0:
+		row[w.credit] = w.amount(m)
+	}
+	return row
+}
+
+// amount formats m for the CSV, with a decimal comma for DecimalComma.
+func (w *csvWriter) amount(m Money) string {
+	if w.opts.DecimalComma {
+		return strings.Replace(m.String(), ".", ",", 1)
+	}
+	return m.String()
+}
+
+func (w *csvWriter) derivedRows(acct Account, txn Transaction) [][]string {
+	var rows [][]string
+	for _, rule := range w.opts.DerivedRules {
+		quantity, amount, ok := rule.Amount(txn.Notes)
+		if !ok {
+			continue
+		}
+		rows = append(rows, w.redact(w.withDebitCredit(w.pad([]string{
+			acct.Name,
+			txn.Date.String(),
+			rule.Label,
+			w.amount(amount),
+			rule.Category,
+			fmt.Sprintf("%s:%s derived from %s", rule.Key, quantity, txn.ID),
+		}), amount)))
+	}
+	return rows
+}
+
+// pad extends row with empty cells up to the number of columns.
+func (w *csvWriter) pad(row []string) []string {
+	for len(row) < len(w.columns) {
+		row = append(row, "")
+	}
+	return row
+}
+
+// redact applies the -redact columns to a full row in place and returns it.
+func (w *csvWriter) redact(row []string) []string {
+	w.opts.Redaction.apply(w.columns, row, w.opts.RedactionKey)
+	return row
+}
+
+// project picks the -columns selection out of a full row.
+func (w *csvWriter) project(row []string) []string {
+	if w.selected == nil {
+		return row
+	}
+	out := make([]string, len(w.selected))
+	for i, idx := range w.selected {
+		if idx >= 0 {
+			out[i] = row[idx]
+		}
 	}
+	return out
 }
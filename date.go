@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	_ "time/tzdata" // TIMEZONE must work in containers without zoneinfo
+)
+
+// setupTimezone makes name, an IANA time zone, the local time zone, so the
+// current month and day are those of the budget's owner rather than of the
+// machine, which is often UTC in containers. An empty name keeps the
+// system's zone.
+func setupTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	time.Local = loc
+	return nil
+}
+
+// Date is a calendar day, encoded as YYYY-MM-DD like the API's transaction dates.
+// The zero Date encodes as an empty string.
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the day of t.
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// ParseDate parses a YYYY-MM-DD date.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return Date{}, err
+	}
+	return Date{t}, nil
+}
+
+func (d Date) Before(o Date) bool { return d.Time.Before(o.Time) }
+func (d Date) After(o Date) bool  { return d.Time.After(o.Time) }
+func (d Date) Compare(o Date) int { return d.Time.Compare(o.Time) }
+
+// AddDays returns the date n days after d.
+func (d Date) AddDays(n int) Date {
+	return Date{d.AddDate(0, 0, n)}
+}
+
+// EndOfMonth returns the last day of d's month.
+func (d Date) EndOfMonth() Date {
+	return Date{d.AddDate(0, 1, -d.Day())}
+}
+
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(time.DateOnly)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("decoding date: %w", err)
+	}
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return fmt.Errorf("decoding date: %w", err)
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DerivedRule generates a synthetic row when a transaction's notes contain
+// "key:quantity", e.g. "miles:120" at a rate of 0.67 yields an 80.40 row.
+// Rules are parsed from DERIVED_ROW_RULES as key:rate:label[:category] entries:
+//
+//	DERIVED_ROW_RULES=miles:0.67:Mileage reimbursement;perdiem:59:Per diem:Travel
+type DerivedRule struct {
+	Key      string
+	Rate     float64
+	Label    string
+	Category string
+
+	pattern *regexp.Regexp
+}
+
+func parseDerivedRules(s string) ([]DerivedRule, error) {
+	var rules []DerivedRule
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 3 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid DERIVED_ROW_RULES entry %q: expected key:rate:label[:category]", entry)
+		}
+		key := strings.TrimSpace(parts[0])
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || key == "" {
+			return nil, fmt.Errorf("invalid DERIVED_ROW_RULES entry %q: expected key:rate:label[:category]", entry)
+		}
+		rule := DerivedRule{
+			Key:     key,
+			Rate:    rate,
+			Label:   strings.TrimSpace(parts[2]),
+			pattern: regexp.MustCompile(`(?i)(?:^|\s)` + regexp.QuoteMeta(key) + `:(\d+(?:\.\d+)?)\b`),
+		}
+		if len(parts) == 4 {
+			rule.Category = strings.TrimSpace(parts[3])
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Amount returns the derived amount for notes, and whether the rule applies.
+func (r DerivedRule) Amount(notes string) (quantity string, amount Money, ok bool) {
+	m := r.pattern.FindStringSubmatch(notes)
+	if m == nil {
+		return "", Money{}, false
+	}
+	q, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return "", Money{}, false
+	}
+	return m[1], Money{Cents: int64(math.Round(q * r.Rate * 100))}, true
+}
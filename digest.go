@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// digestLookbackDays is how far back payees are checked before counting as new.
+const digestLookbackDays = 90
+
+// runDigest exports the trailing days to a CSV, computes highlights and sends
+// them through NOTIFY_URL (or prints them when no notifier is configured).
+func runDigest(args []string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	var cfgFlag configFlags
+	var langFlag string
+	var daysFlag int
+	cfgFlag.register(fs)
+	fs.StringVar(&langFlag, "lang", "en", "Language of the digest: en, de, fr, es")
+	fs.IntVar(&daysFlag, "days", 7, "Number of trailing days to cover, including today")
+	fs.Parse(args) //nolint
+
+	cfg := loadConfig(cfgFlag)
+	msgs, err := catalog(langFlag)
+	if err != nil {
+		log.Fatalf("Invalid -lang value: %v", err)
+	}
+	if daysFlag < 1 {
+		log.Fatal("-days must be at least 1")
+	}
+	var notifier Notifier
+	if cfg.NotifyURL != "" {
+		if notifier, err = NewNotifier(cfg.NotifyURL, cfg.NotifySecret); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	today := time.Now().Local()
+	end := NewDate(today)
+	start := end.AddDays(1 - daysFlag)
+	lookback := start.AddDays(-digestLookbackDays)
+
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	categoryMap, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	outputPath := filepath.Join(cfg.TransactionOutputDir, fmt.Sprintf("digest-%s-%s.csv", start, end))
+	file, err := os.Create(outputPath)
+	if err != nil {
+		log.Fatalf("Failed to create CSV file: %v", err)
+	}
+	defer file.Close() //nolint
+	w := NewCSVWriter(file, categoryMap, payeeMap, CSVOptions{HeaderNames: cfg.HeaderNames})
+	if err := w.WriteHeader(); err != nil {
+		log.Fatalf("Failed to write header: %v", err)
+	}
+
+	var count int
+	var in, out Money
+	var largest []LargeExpense
+	seenPayees := make(map[string]bool)
+	newPayees := make(map[string]bool)
+	for _, account := range accountsResp.Data {
+		if account.Closed {
+			continue
+		}
+		txnResp, err := client.FetchTransactions(account.ID, lookback.String(), end.String())
+		if err != nil {
+			log.Fatalf("Failed to fetch transactions for account %s: %v", account.Name, err)
+		}
+		var recent []Transaction
+		for _, txn := range txnResp.Data {
+			if txn.Date.Before(start) {
+				seenPayees[txn.PayeeID] = true
+				continue
+			}
+			recent = append(recent, txn)
+			newPayees[txn.PayeeID] = true
+			if txn.Amount.Sign() < 0 {
+				out = out.Sub(txn.Amount)
+				largest = keepLargest(largest, LargeExpense{
+					Date:     txn.Date,
+					Account:  account.Name,
+					Payee:    payeeMap[txn.PayeeID].Name,
+					Category: categoryMap[txn.CategoryID].Name,
+					Amount:   txn.Amount.Neg(),
+				}, summaryTopN)
+			} else {
+				in = in.Add(txn.Amount)
+			}
+		}
+		if err := w.Add(account, recent); err != nil {
+			log.Fatalf("Failed to write transactions: %v", err)
+		}
+		count += len(recent)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to close CSV file: %v", err)
+	}
+	slog.Info("Wrote digest transactions", "count", count, "path", outputPath)
+
+	var payeeNames []string
+	for id := range newPayees {
+		if name := payeeMap[id].Name; !seenPayees[id] && name != "" {
+			payeeNames = append(payeeNames, name)
+		}
+	}
+	slices.Sort(payeeNames)
+
+	var overspent []string
+	var monthResp FetchMonthResponse
+	if supports(client, CapMonths) {
+		if monthResp, err = client.FetchMonth(today.Format("2006-01")); err != nil {
+			slog.Warn("Failed to fetch budget month, skipping overspending", "err", err)
+		}
+	} else {
+		slog.Warn("The server has no /months endpoint, skipping overspending")
+	}
+	for _, group := range monthResp.Data.CategoryGroups {
+		for _, category := range group.Categories {
+			if !category.IsIncome && category.Balance.Sign() < 0 {
+				overspent = append(overspent, msgs.Sprintf("digest.overspent_item", category.Name, category.Balance.Neg()))
+			}
+		}
+	}
+
+	subject := msgs.Sprintf("digest.subject", msgs.Date(start), msgs.Date(end))
+	var b strings.Builder
+	if count == 0 {
+		b.WriteString(msgs.Sprintf("digest.none") + "\n")
+	} else {
+		b.WriteString(msgs.Sprintf("digest.totals", count, in, out) + "\n")
+	}
+	if len(largest) > 0 {
+		var parts []string
+		for _, e := range largest {
+			parts = append(parts, msgs.Sprintf("summary.expense", e.Amount, e.Payee, msgs.Date(e.Date), e.Account))
+		}
+		b.WriteString(msgs.Sprintf("summary.biggest", joinWords(msgs, parts)) + "\n")
+	}
+	if len(payeeNames) > 0 {
+		b.WriteString(msgs.Sprintf("digest.new_payees", joinWords(msgs, payeeNames)) + "\n")
+	}
+	if len(overspent) > 0 {
+		b.WriteString(msgs.Sprintf("digest.overspent", joinWords(msgs, overspent)) + "\n")
+	}
+
+	if notifier == nil {
+		fmt.Println(subject)
+		fmt.Print(b.String())
+		return
+	}
+	if err := notifier.Notify(subject, b.String()); err != nil {
+		log.Fatalf("Failed to send digest: %v", err)
+	}
+	slog.Info("Sent digest", "from", start, "to", end)
+}
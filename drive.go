@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	driveFolderMIME = "application/vnd.google-apps.folder"
+	// drive.file only grants access to files actual2csv created, which is why
+	// it creates its own folder, and is one of the scopes Google allows for
+	// the device flow.
+	driveScope  = "https://www.googleapis.com/auth/drive.file"
+	driveAPIURL = "https://www.googleapis.com"
+	driveIssuer = "https://accounts.google.com"
+)
+
+// driveClient is a minimal Google Drive v3 client, authenticated with the
+// OAuth device flow. Tokens are cached in CACHE_DIR like OIDC tokens.
+type driveClient struct {
+	client  *http.Client
+	folders map[string]string // path -> folder ID
+}
+
+type driveFile struct {
+	ID          string `json:"id"`
+	Size        int64  `json:"size,string"`
+	MD5Checksum string `json:"md5Checksum"`
+}
+
+// driveFileFields are the driveFile fields uploads ask for, to check what
+// arrived.
+const driveFileFields = "id,size,md5Checksum"
+
+func newDriveClient(cfg Config) *driveClient {
+	auth := cfg
+	auth.AuthMode = authModeDevice
+	auth.OIDCIssuer = driveIssuer
+	auth.OIDCClientID = cfg.DriveClientID
+	auth.OIDCClientSecret = cfg.DriveClientSecret
+	auth.OIDCScopes = driveScope
+	return &driveClient{
+		client: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: &bearerTransport{base: http.DefaultTransport, source: newOIDCTokenSource(auth)},
+		},
+		folders: make(map[string]string),
+	}
+}
+
+// Put updates the file at p in place if an earlier sync uploaded it, or
+// uploads it into its folder, then checks Drive got all of it.
+func (c *driveClient) Put(p string, content []byte) error {
+	parent, err := c.folder(path.Dir(p))
+	if err != nil {
+		return err
+	}
+	name := path.Base(p)
+	id, err := c.find(parent, name, "")
+	if err != nil {
+		return err
+	}
+	var uploaded driveFile
+	switch {
+	case len(content) > mirrorChunkSize:
+		uploaded, err = c.resumable(id, parent, name, content)
+	case id != "":
+		uploaded, err = c.update(id, name, content)
+	default:
+		uploaded, err = c.create(parent, name, content)
+	}
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(content)
+	return checkUploaded(name, content, uploaded.Size, uploaded.MD5Checksum, hex.EncodeToString(sum[:]))
+}
+
+// folder returns the ID of the folder at dir in My Drive, finding or
+// creating each missing folder along the way.
+func (c *driveClient) folder(dir string) (string, error) {
+	if dir == "." {
+		return "root", nil
+	}
+	if id, ok := c.folders[dir]; ok {
+		return id, nil
+	}
+	parent, err := c.folder(path.Dir(dir))
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(dir)
+	id, err := c.find(parent, name, driveFolderMIME)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		body, _ := json.Marshal(map[string]any{"name": name, "mimeType": driveFolderMIME, "parents": []string{parent}})
+		req, err := http.NewRequest(http.MethodPost, driveAPIURL+"/drive/v3/files?fields=id", bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		var created driveFile
+		if err := c.do(req, &created); err != nil {
+			return "", fmt.Errorf("creating folder %s: %w", dir, err)
+		}
+		id = created.ID
+	}
+	c.folders[dir] = id
+	return id, nil
+}
+
+// find returns the ID of the file named name in parent, or "" if there is
+// none. mimeType, if set, narrows the search.
+func (c *driveClient) find(parent, name, mimeType string) (string, error) {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+	q := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false", quote(name), quote(parent))
+	if mimeType != "" {
+		q += fmt.Sprintf(" and mimeType = '%s'", mimeType)
+	}
+	req, err := http.NewRequest(http.MethodGet, driveAPIURL+"/drive/v3/files?"+url.Values{
+		"q":      {q},
+		"fields": {"files(id)"},
+		"spaces": {"drive"},
+	}.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	var list struct {
+		Files []driveFile `json:"files"`
+	}
+	if err := c.do(req, &list); err != nil {
+		return "", fmt.Errorf("looking up %s: %w", name, err)
+	}
+	if len(list.Files) == 0 {
+		return "", nil
+	}
+	return list.Files[0].ID, nil
+}
+
+// create uploads a new file into parent.
+func (c *driveClient) create(parent, name string, content []byte) (driveFile, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	meta, _ := json.Marshal(map[string]any{"name": name, "parents": []string{parent}})
+	part, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	part.Write(meta) //nolint
+	part, _ = w.CreatePart(textproto.MIMEHeader{"Content-Type": {mirrorContentType(name)}})
+	part.Write(content) //nolint
+	w.Close()           //nolint
+
+	req, err := http.NewRequest(http.MethodPost, driveAPIURL+"/upload/drive/v3/files?uploadType=multipart&fields="+driveFileFields, &body)
+	if err != nil {
+		return driveFile{}, err
+	}
+	req.Header.Set("Content-Type", "multipart/related; boundary="+w.Boundary())
+	var created driveFile
+	if err := c.do(req, &created); err != nil {
+		return driveFile{}, fmt.Errorf("uploading %s: %w", name, err)
+	}
+	return created, nil
+}
+
+// update replaces the content of an existing file, keeping its ID, sharing
+// and revision history.
+func (c *driveClient) update(id, name string, content []byte) (driveFile, error) {
+	req, err := http.NewRequest(http.MethodPatch, driveAPIURL+"/upload/drive/v3/files/"+url.PathEscape(id)+"?uploadType=media&fields="+driveFileFields, bytes.NewReader(content))
+	if err != nil {
+		return driveFile{}, err
+	}
+	req.Header.Set("Content-Type", mirrorContentType(name))
+	var updated driveFile
+	if err := c.do(req, &updated); err != nil {
+		return driveFile{}, fmt.Errorf("updating %s: %w", name, err)
+	}
+	return updated, nil
+}
+
+// resumable uploads content in pieces through a resumable upload session,
+// updating the file with ID id or, if id is "", creating it in parent.
+func (c *driveClient) resumable(id, parent, name string, content []byte) (driveFile, error) {
+	method, target := http.MethodPost, driveAPIURL+"/upload/drive/v3/files"
+	meta := map[string]any{"name": name, "parents": []string{parent}}
+	if id != "" {
+		method, target, meta = http.MethodPatch, target+"/"+url.PathEscape(id), map[string]any{}
+	}
+	body, _ := json.Marshal(meta)
+	req, err := http.NewRequest(method, target+"?uploadType=resumable&fields="+driveFileFields, bytes.NewReader(body))
+	if err != nil {
+		return driveFile{}, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Type", mirrorContentType(name))
+	req.Header.Set("X-Upload-Content-Length", strconv.Itoa(len(content)))
+	header, err := mirrorRequest(c.client, req, nil)
+	if err != nil {
+		return driveFile{}, fmt.Errorf("starting upload of %s: %w", name, err)
+	}
+	session := header.Get("Location")
+
+	var uploaded driveFile
+	// a piece is answered with 308 and the bytes Drive has so far, the last
+	// one with the file; asking for progress is a PUT without content
+	put := func(contentRange string, piece []byte) (int, error) {
+		req, err := http.NewRequest(http.MethodPut, session, bytes.NewReader(piece))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Range", contentRange)
+		req.Header.Set("User-Agent", userAgent())
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close() //nolint
+		switch {
+		case resp.StatusCode == http.StatusPermanentRedirect:
+			_, last, ok := strings.Cut(resp.Header.Get("Range"), "-")
+			if !ok {
+				return 0, nil
+			}
+			n, err := strconv.Atoi(last)
+			return n + 1, err
+		case resp.StatusCode/100 == 2:
+			return len(content), json.NewDecoder(resp.Body).Decode(&uploaded)
+		}
+		return 0, mirrorStatusError{resp.StatusCode}
+	}
+	err = resumableUpload(name, len(content), func(offset int) (int, error) {
+		end := min(offset+mirrorChunkSize, len(content))
+		return put(fmt.Sprintf("bytes %d-%d/%d", offset, end-1, len(content)), content[offset:end])
+	}, func() (int, error) {
+		return put(fmt.Sprintf("bytes */%d", len(content)), nil)
+	})
+	return uploaded, err
+}
+
+func (c *driveClient) do(req *http.Request, out any) error {
+	_, err := mirrorRequest(c.client, req, out)
+	return err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	dropboxAuthorizeURL = "https://www.dropbox.com/oauth2/authorize"
+	dropboxTokenURL     = "https://api.dropboxapi.com/oauth2/token"
+	dropboxContentURL   = "https://content.dropboxapi.com"
+)
+
+// dropboxClient uploads files through the Dropbox v2 API. Dropbox has no
+// device flow, so the first sync prints a link and asks for the code it
+// shows; the refresh token is cached in CACHE_DIR like OIDC tokens.
+type dropboxClient struct {
+	client *http.Client
+}
+
+func newDropboxClient(cfg Config) *dropboxClient {
+	auth := cfg
+	auth.AuthMode = authModeCode
+	auth.OIDCClientID = cfg.DropboxAppKey
+	auth.OIDCClientSecret = ""
+	source := newOIDCTokenSource(auth)
+	source.discovery = &oidcDiscovery{AuthorizationEndpoint: dropboxAuthorizeURL, TokenEndpoint: dropboxTokenURL}
+	source.authParams = url.Values{"token_access_type": {"offline"}}
+	return &dropboxClient{client: &http.Client{
+		Timeout:   5 * time.Minute,
+		Transport: &bearerTransport{base: http.DefaultTransport, source: source},
+	}}
+}
+
+// dropboxMetadata is the part of a Dropbox file's metadata uploads check.
+type dropboxMetadata struct {
+	Size        int64  `json:"size"`
+	ContentHash string `json:"content_hash"`
+}
+
+// Put uploads content to p, relative to the Dropbox root (or the app folder
+// for apps with that access type), then checks Dropbox got all of it.
+// Overwriting keeps the file's revisions.
+func (c *dropboxClient) Put(p string, content []byte) error {
+	commit := map[string]any{
+		"path": "/" + p,
+		"mode": "overwrite",
+		"mute": true,
+	}
+	var uploaded dropboxMetadata
+	var err error
+	if len(content) > mirrorChunkSize {
+		uploaded, err = c.session(p, commit, content)
+	} else if err = c.call("/2/files/upload", commit, content, &uploaded); err != nil {
+		err = fmt.Errorf("uploading %s: %w", p, err)
+	}
+	if err != nil {
+		return err
+	}
+	return checkUploaded(p, content, uploaded.Size, uploaded.ContentHash, dropboxContentHash(content))
+}
+
+// session uploads content in pieces through an upload session and commits
+// it as commit describes.
+func (c *dropboxClient) session(p string, commit map[string]any, content []byte) (dropboxMetadata, error) {
+	var started struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := c.call("/2/files/upload_session/start", map[string]any{}, nil, &started); err != nil {
+		return dropboxMetadata{}, fmt.Errorf("starting upload of %s: %w", p, err)
+	}
+	err := resumableUpload(p, len(content), func(offset int) (int, error) {
+		end := min(offset+mirrorChunkSize, len(content))
+		req, err := http.NewRequest(http.MethodPost, dropboxContentURL+"/2/files/upload_session/append_v2", bytes.NewReader(content[offset:end]))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Dropbox-API-Arg", dropboxArg(map[string]any{"cursor": map[string]any{"session_id": started.SessionID, "offset": offset}}))
+		req.Header.Set("User-Agent", userAgent())
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close() //nolint
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return end, nil
+		case http.StatusConflict:
+			// the session has a different number of bytes than offset, e.g.
+			// after a piece that arrived but whose answer was lost
+			var conflict struct {
+				Error struct {
+					CorrectOffset *int `json:"correct_offset"`
+				} `json:"error"`
+			}
+			if json.NewDecoder(resp.Body).Decode(&conflict) == nil && conflict.Error.CorrectOffset != nil {
+				return *conflict.Error.CorrectOffset, nil
+			}
+		}
+		return 0, mirrorStatusError{resp.StatusCode}
+	}, nil)
+	if err != nil {
+		return dropboxMetadata{}, err
+	}
+	var uploaded dropboxMetadata
+	cursor := map[string]any{"session_id": started.SessionID, "offset": len(content)}
+	if err := c.call("/2/files/upload_session/finish", map[string]any{"cursor": cursor, "commit": commit}, nil, &uploaded); err != nil {
+		return dropboxMetadata{}, fmt.Errorf("finishing upload of %s: %w", p, err)
+	}
+	return uploaded, nil
+}
+
+// call sends content to a content endpoint with arg as its Dropbox-API-Arg
+// and decodes the answer into out.
+func (c *dropboxClient) call(endpoint string, arg any, content []byte, out any) error {
+	req, err := http.NewRequest(http.MethodPost, dropboxContentURL+endpoint, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Dropbox-API-Arg", dropboxArg(arg))
+	_, err = mirrorRequest(c.client, req, out)
+	return err
+}
+
+// dropboxContentHash is Dropbox's content hash of content: the SHA-256 of
+// the SHA-256s of its 4 MiB blocks.
+func dropboxContentHash(content []byte) string {
+	const block = 4 << 20
+	var sums []byte
+	for start := 0; start < len(content); start += block {
+		sum := sha256.Sum256(content[start:min(start+block, len(content))])
+		sums = append(sums, sum[:]...)
+	}
+	sum := sha256.Sum256(sums)
+	return hex.EncodeToString(sum[:])
+}
+
+// dropboxArg encodes v for the Dropbox-API-Arg header, which must be ASCII.
+func dropboxArg(v any) string {
+	data, _ := json.Marshal(v)
+	var b strings.Builder
+	for _, r := range string(data) {
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, `\u%04x`, u)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// payeeNoiseWords are dropped before comparing payee names.
+var payeeNoiseWords = []string{
+	"the", "www", "com", "net", "org", "inc", "llc", "ltd", "co", "corp",
+	"mktp", "marketplace", "pos", "purchase", "debit", "card", "payment",
+}
+
+// payeeGroup is a set of payees that look like the same merchant.
+type payeeGroup struct {
+	Target Payee
+	Merge  []Payee
+}
+
+// runDuplicatePayeesReport lists near-duplicate payees with a suggested merge
+// target, optionally applying the merges through the API.
+func runDuplicatePayeesReport(args []string) {
+	fs := flag.NewFlagSet("report duplicate-payees", flag.ExitOnError)
+	var f reportFlags
+	var applyFlag, yesFlag bool
+	f.register(fs)
+	fs.BoolVar(&applyFlag, "apply", false, "Merge each group into its suggested payee in Actual, asking for each group")
+	fs.BoolVar(&yesFlag, "yes", false, "With -apply, merge every group without asking")
+	fs.Parse(args) //nolint
+	f.validate()
+	if applyFlag && !yesFlag && !isTerminal(os.Stdin) {
+		log.Fatal("-apply asks before each merge; pass -yes to merge every group without asking")
+	}
+
+	startDate, endDate, err := lookbackDates(f.from, f.to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	payeesResp, err := client.FetchPayees()
+	if err != nil {
+		log.Fatalf("Failed to fetch payees: %v", err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+	// usage decides which spelling is kept
+	usage := make(map[string]int)
+	if err := forEachTransaction(client, accountsResp.Data, startDate, endDate, func(_ Account, txn Transaction) {
+		usage[txn.PayeeID]++
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	groups := duplicatePayees(payeesResp.Data, usage)
+	var rows [][]string
+	for i, g := range groups {
+		group := strconv.Itoa(i + 1)
+		rows = append(rows, []string{group, g.Target.ID, g.Target.Name, strconv.Itoa(usage[g.Target.ID]), "keep", ""})
+		for _, p := range g.Merge {
+			rows = append(rows, []string{group, p.ID, p.Name, strconv.Itoa(usage[p.ID]), "merge", g.Target.Name})
+		}
+	}
+	printReport(f.output, []string{"group", "payee_id", "payee", "transactions", "action", "merge_into"}, rows)
+
+	if !applyFlag {
+		return
+	}
+	in := bufio.NewReader(os.Stdin)
+	for _, g := range groups {
+		var ids, names []string
+		for _, p := range g.Merge {
+			ids = append(ids, p.ID)
+			names = append(names, strconv.Quote(p.Name))
+		}
+		if !yesFlag {
+			fmt.Fprintf(os.Stderr, "Merge %s into %q? [y/N] ", strings.Join(names, ", "), g.Target.Name)
+			answer, _ := in.ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				slog.Info("Skipped merging payees", "payee", g.Target.Name)
+				continue
+			}
+		}
+		if err := client.MergePayees(g.Target.ID, ids); err != nil {
+			log.Fatalf("Failed to merge payees into %s: %v", g.Target.Name, err)
+		}
+		slog.Info("Merged payees", "count", len(ids), "payee", g.Target.Name)
+	}
+}
+
+// duplicatePayees groups payees whose names look like the same merchant,
+// e.g. "AMAZON.COM", "Amazon" and "AMZN Mktp". The most used payee in each
+// group is the suggested merge target. Transfer payees stand for accounts,
+// so they're never grouped.
+func duplicatePayees(payees []Payee, usage map[string]int) []payeeGroup {
+	candidates := slices.DeleteFunc(slices.Clone(payees), func(p Payee) bool { return p.TransferAccount != "" })
+	// the most used payees start groups, so they become the targets
+	slices.SortStableFunc(candidates, func(a, b Payee) int {
+		if usage[a.ID] != usage[b.ID] {
+			return usage[b.ID] - usage[a.ID]
+		}
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) - len(b.Name)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	type cluster struct {
+		payees []Payee
+		tokens [][]string
+	}
+	var clusters []*cluster
+	for _, p := range candidates {
+		tokens := payeeTokens(p.Name)
+		// a payee only joins a group it looks like every member of, so
+		// "Amazon Prime" and "Amazon Web Services" aren't chained together
+		// through "Amazon"
+		i := slices.IndexFunc(clusters, func(c *cluster) bool {
+			return !slices.ContainsFunc(c.tokens, func(t []string) bool { return !similarPayees(tokens, t) })
+		})
+		if i < 0 {
+			clusters = append(clusters, &cluster{payees: []Payee{p}, tokens: [][]string{tokens}})
+			continue
+		}
+		clusters[i].payees = append(clusters[i].payees, p)
+		clusters[i].tokens = append(clusters[i].tokens, tokens)
+	}
+
+	var groups []payeeGroup
+	for _, c := range clusters {
+		if len(c.payees) >= 2 {
+			groups = append(groups, payeeGroup{Target: c.payees[0], Merge: c.payees[1:]})
+		}
+	}
+	return groups
+}
+
+// payeeTokens lowercases name and splits it into words, dropping noise words
+// and numbers such as store IDs.
+func payeeTokens(name string) []string {
+	var tokens []string
+	for _, t := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if _, err := strconv.Atoi(t); err == nil || slices.Contains(payeeNoiseWords, t) {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// similarPayees reports whether two payees' words look like the same
+// merchant: the same name, or the shorter name's words matching the longer
+// one's first words, as when banks add a location or store ID. "Amazon"
+// matches "AMZN Mktp US" but "Shell Oil" doesn't match "Shell Cafe".
+func similarPayees(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	if strings.Join(a, "") == strings.Join(b, "") {
+		return true
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) < len(b) && len(strings.Join(a, "")) < 4 {
+		// too short to tell a merchant from a word it starts with
+		return false
+	}
+	for i := range a {
+		if !similarWords(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// similarWords reports whether two words are the same, one abbreviates the
+// other or they're a typo apart.
+func similarWords(a, b string) bool {
+	if a == b || isAbbreviation(a, b) || isAbbreviation(b, a) {
+		return true
+	}
+	maxDist := 1
+	if min(len(a), len(b)) >= 8 {
+		maxDist = 2
+	}
+	return min(len(a), len(b)) >= 5 && levenshtein(a, b) <= maxDist
+}
+
+// isAbbreviation reports whether short is word with its later vowels removed,
+// as banks often do ("amzn" for "amazon").
+func isAbbreviation(short, word string) bool {
+	if len(short) < 3 || len(short) >= len(word) {
+		return false
+	}
+	var b strings.Builder
+	for i, r := range word {
+		if i == 0 || !strings.ContainsRune("aeiou", r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String() == short
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
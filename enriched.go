@@ -0,0 +1,27 @@
+package main
+
+// EnrichedTransaction is a transaction with its references resolved to names,
+// used by JSON-based outputs.
+type EnrichedTransaction struct {
+	ID        string `json:"id"`
+	AccountID string `json:"account_id"`
+	Account   string `json:"account"`
+	Date      Date   `json:"date"`
+	Payee     string `json:"payee"`
+	Category  string `json:"category"`
+	Amount    Money  `json:"amount"`
+	Notes     string `json:"notes"`
+}
+
+func enrichTransaction(acct Account, txn Transaction, categoryMap map[string]Category, payeeMap map[string]Payee) EnrichedTransaction {
+	return EnrichedTransaction{
+		ID:        txn.ID,
+		AccountID: acct.ID,
+		Account:   acct.Name,
+		Date:      txn.Date,
+		Payee:     payeeMap[txn.PayeeID].Name,
+		Category:  categoryMap[txn.CategoryID].Name,
+		Amount:    txn.Amount,
+		Notes:     txn.Notes,
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// fixmeWriter receives the message of an error that aborts the export.
+type fixmeWriter interface {
+	WriteFixme(msg string)
+}
+
+// fileFixme annotates the output file itself, the default so failed exports
+// can't be mistaken for complete ones.
+type fileFixme struct {
+	w io.Writer
+}
+
+func (f fileFixme) WriteFixme(msg string) {
+	io.WriteString(f.w, "[FIXME] "+msg) //nolint
+}
+
+var errorsHeaders = []string{
+	"transaction_id",
+	"account",
+	"date",
+	"payee_id",
+	"category_id",
+	"amount",
+	"notes",
+	"reason",
+}
+
+// errorsFile collects problematic rows and errors separately from the main export.
+type errorsFile struct {
+	f *os.File
+	w *csv.Writer
+}
+
+// OpenErrorsFile opens path for writing, appending when resuming an interrupted run.
+func OpenErrorsFile(path string, resume bool) (*errorsFile, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	e := &errorsFile{f: f, w: csv.NewWriter(f)}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		e.write(errorsHeaders)
+	}
+	return e, nil
+}
+
+// Row records a transaction that was kept out of the export.
+func (e *errorsFile) Row(acct Account, txn Transaction, reason string) {
+	e.write([]string{
+		txn.ID,
+		acct.Name,
+		txn.Date.String(),
+		txn.PayeeID,
+		txn.CategoryID,
+		strconv.FormatInt(txn.Amount.Cents, 10),
+		txn.Notes,
+		reason,
+	})
+}
+
+func (e *errorsFile) WriteFixme(msg string) {
+	e.write([]string{"", "", "", "", "", "", "", msg})
+}
+
+func (e *errorsFile) write(row []string) {
+	if err := e.w.Write(row); err != nil {
+		slog.Warn("Failed to write errors file", "err", err)
+		return
+	}
+	e.w.Flush()
+}
+
+func (e *errorsFile) Close() error {
+	e.w.Flush()
+	return e.f.Close()
+}
+
+// transactionProblem describes why txn can't be exported cleanly, or returns ""
+// if there is nothing wrong with it.
+func transactionProblem(txn Transaction, categoryMap map[string]Category, payeeMap map[string]Payee) string {
+	if txn.Error != nil {
+		return fmt.Sprintf("API error: %s (difference %s)", txn.Error.Type, txn.Error.Difference)
+	}
+	if _, ok := categoryMap[txn.CategoryID]; txn.CategoryID != "" && !ok {
+		return "unresolved category " + txn.CategoryID
+	}
+	if _, ok := payeeMap[txn.PayeeID]; txn.PayeeID != "" && !ok {
+		return "unresolved payee " + txn.PayeeID
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	eventsFilename     = "events.jsonl"
+	eventStateFilename = "events.state.json"
+)
+
+// TransactionEvent is one line of the append-only events log.
+type TransactionEvent struct {
+	Event       string       `json:"event"` // created, updated or deleted
+	Timestamp   time.Time    `json:"timestamp"`
+	Account     string       `json:"account"`
+	Transaction Transaction  `json:"transaction"`
+	Previous    *Transaction `json:"previous,omitempty"`
+}
+
+// eventWriter compares fetched transactions with the state left by previous
+// runs and writes change events. The state itself is only updated by
+// commitEvents once a run completes, so resumed steps emit the same events.
+type eventWriter struct {
+	enc       *json.Encoder
+	state     map[string]Transaction
+	timestamp time.Time
+
+	start, end Date
+}
+
+func NewEventWriter(w io.Writer, state map[string]Transaction, timestamp time.Time) TransactionWriter {
+	return &eventWriter{
+		enc:       json.NewEncoder(w),
+		state:     state,
+		timestamp: timestamp,
+	}
+}
+
+func (w *eventWriter) WriteHeader() error { return nil }
+
+func (w *eventWriter) WritePlaceholder(date Date, note string) error { return nil }
+
+func (w *eventWriter) StartPeriod(start, end Date) {
+	w.start, w.end = start, end
+}
+
+func (w *eventWriter) Add(acct Account, txns []Transaction) error {
+	seen := make(map[string]bool, len(txns))
+	for _, txn := range txns {
+		seen[txn.ID] = true
+		prev, ok := w.state[txn.ID]
+		switch {
+		case !ok:
+			if err := w.write("created", acct, txn, nil); err != nil {
+				return err
+			}
+		case !sameTransaction(prev, txn):
+			if err := w.write("updated", acct, txn, &prev); err != nil {
+				return err
+			}
+		}
+	}
+
+	// anything previously seen in this account and period that's gone was deleted
+	for id, prev := range w.state {
+		if seen[id] || prev.AccountID != acct.ID || prev.Date.Before(w.start) || prev.Date.After(w.end) {
+			continue
+		}
+		if err := w.write("deleted", acct, prev, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *eventWriter) write(event string, acct Account, txn Transaction, prev *Transaction) error {
+	return w.enc.Encode(TransactionEvent{
+		Event:       event,
+		Timestamp:   w.timestamp,
+		Account:     acct.Name,
+		Transaction: txn,
+		Previous:    prev,
+	})
+}
+
+func sameTransaction(a, b Transaction) bool {
+	aData, _ := json.Marshal(a)
+	bData, _ := json.Marshal(b)
+	return bytes.Equal(aData, bData)
+}
+
+// loadEventState reads the transactions known as of the last committed run.
+func loadEventState(path string) (map[string]Transaction, error) {
+	state := make(map[string]Transaction)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading event state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("decoding event state: %w", err)
+	}
+	return state, nil
+}
+
+// commitEvents appends the run's events to the events log and applies them to state.
+func commitEvents(partialPath, logPath, statePath string, state map[string]Transaction) (int, error) {
+	partial, err := os.Open(partialPath)
+	if err != nil {
+		return 0, err
+	}
+	defer partial.Close() //nolint
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer logFile.Close() //nolint
+
+	var count int
+	scanner := bufio.NewScanner(partial)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var event TransactionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return count, fmt.Errorf("decoding event: %w", err)
+		}
+		if _, err := logFile.Write(append(scanner.Bytes(), '\n')); err != nil {
+			return count, err
+		}
+		if event.Event == "deleted" {
+			delete(state, event.Transaction.ID)
+		} else {
+			state[event.Transaction.ID] = event.Transaction
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+	if err := logFile.Close(); err != nil {
+		return count, err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return count, fmt.Errorf("encoding event state: %w", err)
+	}
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return count, err
+	}
+	if err := os.Rename(tmp, statePath); err != nil {
+		return count, err
+	}
+	return count, os.Remove(partialPath)
+}
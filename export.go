@@ -0,0 +1,792 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportOptions configures an Exporter. They mirror the export flags; the
+// zero value of each option is the flag's default.
+type ExportOptions struct {
+	// Start and End are the first and last days exported. Range names the
+	// export, e.g. "2024-06" or "2024-01-2024-06".
+	Start, End Date
+	Range      string
+
+	// Format is csv (the default), beancount, events, ledger, ndjson, ofx,
+	// text-summary or xlsx.
+	Format string
+	// Output replaces the OUTPUT_LAYOUT path in TRANSACTION_OUTPUT_DIR; "-" writes to stdout.
+	Output string
+	// Empty is what an export without transactions contains: header (the default),
+	// none or placeholder.
+	Empty string
+	// OmitZeroAccounts leaves accounts without transactions out of the manifest and stats.
+	OmitZeroAccounts bool
+	// Lang selects the language of text summaries and charts; defaults to en.
+	Lang string
+
+	// IncludeClosed exports closed accounts too, for months they were open.
+	IncludeClosed bool
+	// Accounts restricts the export to these account names or IDs.
+	Accounts []string
+	// ExcludeAccounts skips matching accounts, even ones listed in Accounts.
+	ExcludeAccounts AccountPatterns
+	// AccountOrder orders the accounts in the output, see orderAccounts. The
+	// config order is Accounts if set, otherwise ACCOUNT_ORDER.
+	AccountOrder string
+	// MetaFilter only exports accounts whose ACCOUNT_METADATA matches.
+	MetaFilter map[string]string
+
+	// Preset replaces the CSV layout with one an application imports as is:
+	// gnucash.
+	Preset string
+	// CSV customizes -format csv. Setting Owners also tallies per-owner subtotals,
+	// and a Classifier is given the category groups it needs.
+	CSV CSVOptions
+	// Preamble fills CSV.Preamble with the budget, export time, period and version.
+	Preamble bool
+	// Balances appends balance rows after each account.
+	Balances bool
+	// OFXVersion is the OFX version -format ofx writes, 1 or 2.
+	OFXVersion int
+	// SplitByClass splits the finished CSV into one file per class.
+	SplitByClass bool
+
+	// Writers receive every exported transaction alongside the output.
+	Writers []TransactionWriter
+	// ErrorsFile keeps problematic rows and errors out of the export, see OpenErrorsFile.
+	ErrorsFile string
+	// Stats and Charts write sidecars next to the export.
+	Stats  bool
+	Charts bool
+
+	// Retain and RetainBytes prune older exports after a successful run.
+	Retain      int
+	RetainBytes int64
+	PruneDryRun bool
+	// Latest maintains latest.csv: none (the default), symlink or copy.
+	Latest string
+
+	// FillGaps writes zero-amount rows for periods without activity so pivot
+	// tables keep every month: none (the default), months (per account) or
+	// categories (per category, after all accounts).
+	FillGaps string
+
+	// Reopen allows changing the export of a month closed with `actual2csv close`.
+	Reopen bool
+
+	// DryRun writes the first PreviewRows transactions of each account and
+	// per-account totals to stdout, leaving files and publishers alone.
+	DryRun      bool
+	PreviewRows int
+
+	// Append adds transactions not in Seen to an existing export instead of
+	// rewriting it. When Seen is set, the exported transactions are recorded
+	// in it once the run succeeds.
+	Append bool
+	Seen   map[string]Date
+
+	// Concurrency is how many transaction requests may be in flight at once;
+	// results are still written in order. Values below 1 mean 1.
+	Concurrency int
+	// LatencyTarget adapts the concurrency, up to Concurrency, to keep
+	// transaction requests faster than this; 0 keeps it fixed.
+	LatencyTarget time.Duration
+
+	// Progress receives -progress json events; nil reports nothing.
+	Progress *progressReporter
+}
+
+// Exporter exports transactions for a period to the output directory,
+// resuming from a savepoint left by an interrupted run.
+type Exporter struct {
+	cfg    Config
+	client ActualClient
+	opts   ExportOptions
+}
+
+func NewExporter(cfg Config, client ActualClient, opts ExportOptions) *Exporter {
+	return &Exporter{cfg: cfg, client: client, opts: opts}
+}
+
+// exportStep is one account's transactions for one period.
+type exportStep struct {
+	account Account
+	period  period
+	// last is set on the final period of the range, which carries the balance footer.
+	last bool
+	// final is set on the account's last step still to do.
+	final  bool
+	result chan fetchResult
+}
+
+type fetchResult struct {
+	resp FetchTransactionsResponse
+	err  error
+}
+
+// Run performs the export. Cancelling ctx stops the export after the current
+// step, leaving a savepoint to resume from.
+func (e *Exporter) Run(ctx context.Context) error {
+	err := e.run(ctx)
+	e.opts.Progress.Finish(e.opts.Range, err)
+	return err
+}
+
+func (e *Exporter) run(ctx context.Context) error {
+	opts := e.opts
+	cfg := e.cfg
+	startedAt := time.Now()
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	msgs, err := catalog(opts.Lang)
+	if err != nil {
+		return err
+	}
+	periods := splitMonths(opts.Start, opts.End)
+
+	// Create file
+	//
+	// Transactions are written to a .partial file next to a .savepoint recording
+	// completed (month, account) steps. An interrupted run picks up from the
+	// savepoint and the partial file is only moved into place once complete.
+	// Output to stdout is streamed directly and can't be resumed.
+	toStdout := opts.Output == "-" || opts.DryRun
+	var outputPath, basePath string
+	switch {
+	case opts.Output == "-":
+	case opts.Output != "":
+		outputPath = opts.Output
+		basePath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	default:
+		filename, err := cfg.OutputLayout.Path(opts.Range, opts.Start.Time)
+		if err != nil {
+			return err
+		}
+		outputPath = filepath.Join(cfg.TransactionOutputDir, filename)
+		basePath = strings.TrimSuffix(outputPath, ".csv")
+		switch opts.Format {
+		case "events":
+			outputPath = basePath + ".events.jsonl"
+		case "beancount":
+			outputPath = basePath + ".beancount"
+		case "ledger":
+			outputPath = basePath + ".journal"
+		case "ndjson":
+			outputPath = basePath + ".ndjson"
+		case "ofx":
+			outputPath = basePath + ".ofx"
+		case "xlsx":
+			outputPath = basePath + ".xlsx"
+		case "text-summary":
+			outputPath = basePath + ".summary.txt"
+		}
+	}
+	if !toStdout {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+	}
+	partialPath := outputPath + ".partial"
+	var savepointPath string
+	if !toStdout {
+		savepointPath = outputPath + ".savepoint"
+	}
+	savepoint, err := LoadSavepoint(savepointPath, opts.Range)
+	if err != nil {
+		return fmt.Errorf("loading savepoint: %w", err)
+	}
+	// appending keeps the existing export's rows, header included
+	appending := false
+	if opts.Append && !toStdout {
+		_, err := os.Stat(outputPath)
+		appending = err == nil
+	}
+	var file *os.File
+	if toStdout {
+		file = os.Stdout
+	} else if savepoint.Resuming() {
+		file, err = os.OpenFile(partialPath, os.O_RDWR, 0o644)
+		if err == nil {
+			err = file.Truncate(savepoint.Offset)
+		}
+		if err == nil {
+			_, err = file.Seek(savepoint.Offset, io.SeekStart)
+		}
+		if err != nil {
+			return fmt.Errorf("resuming from savepoint: %w", err)
+		}
+		slog.Info("Resuming from savepoint", "range", opts.Range, "steps_done", len(savepoint.Done))
+	} else {
+		file, err = os.Create(partialPath)
+		if err != nil {
+			return fmt.Errorf("creating CSV file: %w", err)
+		}
+		if appending {
+			if err := copyFileTo(file, outputPath); err != nil {
+				return fmt.Errorf("copying %s to append to: %w", outputPath, err)
+			}
+		}
+	}
+	if !toStdout {
+		defer file.Close() //nolint
+	}
+
+	var fixme fixmeWriter = fileFixme{file}
+	var errorsOut *errorsFile
+	if opts.ErrorsFile != "" && !opts.DryRun {
+		errorsOut, err = OpenErrorsFile(opts.ErrorsFile, savepoint.Resuming())
+		if err != nil {
+			return fmt.Errorf("opening errors file: %w", err)
+		}
+		defer errorsOut.Close() //nolint
+		fixme = errorsOut
+	}
+	// fail aborts the export, noting why in the output (or errors file)
+	fail := func(format string, args ...any) error {
+		msg := fmt.Sprintf(format, args...)
+		fixme.WriteFixme(msg)
+		return errors.New(msg)
+	}
+
+	// Build name maps
+	categoriesResp, err := e.client.FetchCategories()
+	if err != nil {
+		return fail("Failed to fetch categories: %s", err)
+	}
+	categoryMap := make(map[string]Category)
+	for _, category := range categoriesResp.Data {
+		categoryMap[category.ID] = category
+	}
+
+	payeesResp, err := e.client.FetchPayees()
+	if err != nil {
+		return fail("Failed to fetch payees: %s", err)
+	}
+	payeeMap := make(map[string]Payee)
+	for _, payee := range payeesResp.Data {
+		payeeMap[payee.ID] = payee
+	}
+
+	// Fetch accounts
+	accountsResp, err := e.client.FetchAccounts()
+	if err != nil {
+		return fail("Failed to fetch accounts: %s", err)
+	}
+	accounts := accountsResp.Data
+	slog.Info("Found accounts", "count", len(accounts))
+	var selected map[string]bool
+	if len(opts.Accounts) > 0 {
+		selected = make(map[string]bool)
+		for _, name := range opts.Accounts {
+			account, err := findAccount(accounts, name)
+			if err != nil {
+				return fail("Invalid -accounts: %v", err)
+			}
+			selected[account.ID] = true
+		}
+	}
+	var included []Account
+	for _, account := range accounts {
+		if account.Closed && !opts.IncludeClosed {
+			slog.Info("Skipping closed account", "account", account.Name)
+			continue
+		}
+		if selected != nil && !selected[account.ID] {
+			slog.Info("Skipping account not in -accounts", "account", account.Name)
+			continue
+		}
+		if opts.ExcludeAccounts.Match(account) {
+			slog.Info("Skipping account matching -exclude-accounts", "account", account.Name)
+			continue
+		}
+		if !cfg.AccountMetadata.Matches(account, opts.MetaFilter) {
+			slog.Info("Skipping account not matching -meta", "account", account.Name)
+			continue
+		}
+		included = append(included, account)
+	}
+	configuredOrder := cfg.AccountOrder
+	if len(opts.Accounts) > 0 {
+		configuredOrder = opts.Accounts
+	}
+	if accounts, err = orderAccounts(e.client, included, opts.AccountOrder, configuredOrder, opts.End); err != nil {
+		return fail("Failed to order accounts: %v", err)
+	}
+
+	// Write txns
+	var txnWriter TransactionWriter
+	var eventState map[string]Transaction
+	eventsPath := filepath.Join(cfg.TransactionOutputDir, eventsFilename)
+	eventStatePath := filepath.Join(cfg.TransactionOutputDir, eventStateFilename)
+	switch opts.Format {
+	case "events":
+		if eventState, err = loadEventState(eventStatePath); err != nil {
+			return err
+		}
+		txnWriter = NewEventWriter(file, eventState, startedAt)
+	case "beancount":
+		txnWriter = NewBeancountWriter(file, opts.Start, categoryMap, payeeMap, cfg.AccountMetadata, accounts)
+	case "ledger":
+		txnWriter = NewLedgerWriter(file, categoryMap, payeeMap, accounts)
+	case "ndjson":
+		txnWriter = NewNDJSONWriter(file, categoryMap, payeeMap)
+	case "ofx":
+		// statements are closed by the balance footer
+		opts.Balances = true
+		txnWriter = NewOFXWriter(file, cmp.Or(opts.OFXVersion, 1), opts.Start, opts.End, payeeMap, cfg.AccountMetadata, startedAt, resumedStatement(savepoint, accounts, periods))
+	case "text-summary":
+		txnWriter = summaryWriter{}
+	default:
+		if opts.Preset == "gnucash" {
+			txnWriter = NewGnuCashWriter(file, categoryMap, payeeMap, cfg.AccountMetadata, accounts)
+			break
+		}
+		csvOpts := opts.CSV
+		if csvOpts.Classifier != nil && csvOpts.Classifier.NeedsGroups() {
+			groupsResp, err := e.client.FetchCategoryGroups()
+			if err != nil {
+				return fail("Failed to fetch category groups: %s", err)
+			}
+			csvOpts.Classifier.SetGroups(groupsResp.Data)
+		}
+		if opts.Preamble {
+			csvOpts.Preamble = []string{
+				"budget: " + budgetName(e.client, cfg.BudgetSyncID),
+				"exported: " + startedAt.Format(time.RFC3339),
+				fmt.Sprintf("period: %s to %s", opts.Start, opts.End),
+				"version: actual2csv " + version,
+			}
+		}
+		txnWriter = NewCSVWriter(file, categoryMap, payeeMap, csvOpts)
+	}
+	// gap rows only go to the output itself, not to publishers
+	gaps, _ := txnWriter.(gapWriter)
+	streamer, _ := txnWriter.(transactionStreamer)
+	footer, _ := txnWriter.(footerWriter)
+	if len(opts.Writers) > 0 && !opts.DryRun {
+		txnWriter = append(multiWriter{txnWriter}, opts.Writers...)
+	}
+	if cfg.PublishURL != "" && !toStdout {
+		pub, err := NewPublisher(cfg.PublishURL, cfg.PublishTopic, categoryMap, payeeMap)
+		if err != nil {
+			return fail("Failed to set up publisher: %v", err)
+		}
+		defer pub.Close() //nolint
+		txnWriter = multiWriter{txnWriter, pub}
+	}
+	if !savepoint.Resuming() && !appending {
+		if err := txnWriter.WriteHeader(); err != nil {
+			return fail("Failed to write header: %v", err)
+		}
+	}
+
+	var steps []*exportStep
+	for _, account := range accounts {
+		stats := savepoint.AccountStats(account)
+		stats.Metadata = cfg.AccountMetadata.For(account)
+		var accountSteps []*exportStep
+		for i, p := range periods {
+			if !savepoint.IsDone(p.Month, account.ID) {
+				accountSteps = append(accountSteps, &exportStep{account: account, period: p, last: i == len(periods)-1, result: make(chan fetchResult, 1)})
+			}
+		}
+		if len(accountSteps) > 0 {
+			accountSteps[len(accountSteps)-1].final = true
+		}
+		steps = append(steps, accountSteps...)
+	}
+
+	opts.Progress.Start(opts.Range, len(accounts), len(steps))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fetched := e.prefetch(ctx, steps)
+	accountTransactions := make(map[string]int)
+	for i, step := range steps {
+		account, p := step.account, step.period
+		var r fetchResult
+		select {
+		case r = <-step.result:
+			fetched()
+		case <-ctx.Done():
+			return fmt.Errorf("interrupted; rerun the same command to resume %s", opts.Range)
+		}
+		if r.err != nil {
+			return fail("Failed to fetch transactions for account %s: %v", account.Name, r.err)
+		}
+
+		stats := savepoint.AccountStats(account)
+		stats.Fetched += len(r.resp.Data)
+		var transactions []Transaction
+		for _, txn := range r.resp.Data {
+			if !toStdout {
+				savepoint.Exported[txn.ID] = newClosedTransaction(txn)
+			}
+			if opts.Seen != nil {
+				if _, ok := opts.Seen[txn.ID]; ok && opts.Append {
+					continue
+				}
+				savepoint.Appended[txn.ID] = txn.Date
+			}
+			if opts.FillGaps == "categories" {
+				savepoint.CategoryMonths[savepointKey(p.Month, txn.CategoryID)] = true
+			}
+			problem := transactionProblem(txn, categoryMap, payeeMap)
+			if problem != "" && errorsOut != nil {
+				errorsOut.Row(account, txn, problem)
+				stats.Filtered++
+				stats.Fixme++
+				continue
+			}
+			stats.Observe(txn, problem != "")
+			savepoint.AddSpending(categoryMap[txn.CategoryID], txn)
+			savepoint.AddExpense(account, payeeMap[txn.PayeeID].Name, categoryMap[txn.CategoryID].Name, txn)
+			if opts.CSV.Owners != nil {
+				savepoint.AddOwnerTotal(opts.CSV.Owners.Owner(account, payeeMap[txn.PayeeID].Name), txn)
+			}
+			transactions = append(transactions, txn)
+			if streamer != nil && (!opts.DryRun || accountTransactions[account.ID]+len(transactions) <= opts.PreviewRows) {
+				if err := streamer.WriteTransaction(account, txn); err != nil {
+					return fail("Failed to write transactions for account %s: %v", account.Name, err)
+				}
+			}
+		}
+
+		if pw, ok := txnWriter.(periodWriter); ok {
+			pw.StartPeriod(p.Start, p.End)
+		}
+		written := transactions
+		if opts.DryRun {
+			// stats still cover every transaction for the totals
+			written = transactions[:min(len(transactions), max(opts.PreviewRows-accountTransactions[account.ID], 0))]
+		}
+		if err := txnWriter.Add(account, written); err != nil {
+			return fail("Failed to write transactions for account %s: %v", account.Name, err)
+		}
+		if gaps != nil && opts.FillGaps == "months" && len(transactions) == 0 {
+			if err := gaps.WriteGap(account.Name, "", p.Start); err != nil {
+				return fail("Failed to write gap row for account %s: %v", account.Name, err)
+			}
+		}
+		if footer != nil && opts.Balances && step.last {
+			// the footer is part of the account's last step so a resume never duplicates it
+			opening, err := e.client.FetchBalance(account.ID, opts.Start.AddDays(-1).String())
+			if err != nil {
+				return fail("Failed to fetch opening balance for account %s: %v", account.Name, err)
+			}
+			if err := footer.WriteBalanceFooter(account, BalanceSummary{
+				StartDate: opts.Start,
+				EndDate:   opts.End,
+				Opening:   opening.Data,
+				Debits:    stats.Debits,
+				Credits:   stats.Credits,
+				Closing:   opening.Data.Add(stats.Sum),
+			}); err != nil {
+				return fail("Failed to write balance footer for account %s: %v", account.Name, err)
+			}
+		}
+		accountTransactions[account.ID] += len(transactions)
+		savepoint.Record(p.Month, account.ID, len(transactions))
+		opts.Progress.Fetched(opts.Range, account, p.Month, i+1, len(steps), len(transactions))
+		if step.final {
+			if n := accountTransactions[account.ID]; n == 0 {
+				slog.Info("No transactions for account", "account", account.Name, "range", opts.Range)
+			} else {
+				slog.Info("Added transactions for account", "account", account.Name, "account_id", account.ID, "range", opts.Range, "count", n)
+			}
+		}
+		if bw, ok := txnWriter.(bufferedWriter); ok {
+			flushed, err := bw.Flush(false)
+			if err != nil {
+				return fail("Failed to write transactions for account %s: %v", account.Name, err)
+			}
+			if !flushed {
+				// checkpointed once the buffered rows reach the file
+				continue
+			}
+		}
+		if err := checkpoint(file, savepoint); err != nil {
+			return fail("Failed to checkpoint progress: %v", err)
+		}
+	}
+
+	if gaps != nil && opts.FillGaps == "categories" {
+		var categories []Category
+		for _, category := range categoryMap {
+			if !category.Hidden {
+				categories = append(categories, category)
+			}
+		}
+		slices.SortFunc(categories, func(a, b Category) int { return strings.Compare(a.Name, b.Name) })
+		for _, p := range periods {
+			for _, category := range categories {
+				if savepoint.CategoryMonths[savepointKey(p.Month, category.ID)] {
+					continue
+				}
+				if err := gaps.WriteGap("", category.Name, p.Start); err != nil {
+					return fail("Failed to write gap rows: %v", err)
+				}
+			}
+		}
+	}
+	if bw, ok := txnWriter.(bufferedWriter); ok {
+		if _, err := bw.Flush(true); err != nil {
+			return fail("Failed to write transactions: %v", err)
+		}
+		if err := checkpoint(file, savepoint); err != nil {
+			return fail("Failed to checkpoint progress: %v", err)
+		}
+	}
+
+	// Finalize file
+	if savepoint.Transactions == 0 && opts.Empty == "placeholder" && !appending {
+		if err := txnWriter.WritePlaceholder(periods[0].Start, "No transactions"); err != nil {
+			return fail("Failed to write placeholder row: %v", err)
+		}
+	}
+	if opts.Format == "text-summary" {
+		if _, err := io.WriteString(file, textSummary(msgs, opts.Range, savepoint)); err != nil {
+			return fail("Failed to write summary: %v", err)
+		}
+	}
+	if opts.DryRun {
+		var rows [][]string
+		for _, account := range accounts {
+			stats := savepoint.AccountStats(account)
+			rows = append(rows, []string{account.Name, strconv.Itoa(stats.Written), stats.Debits.String(), stats.Credits.String(), stats.Sum.String(), stats.MinDate.String(), stats.MaxDate.String()})
+		}
+		dest := outputPath
+		if dest == "" {
+			dest = "stdout"
+		}
+		fmt.Printf("\nDry run: %d transactions from %s to %s would be exported to %s\n", savepoint.Transactions, opts.Start, opts.End, dest)
+		printReport("table", []string{"account", "transactions", "debits", "credits", "sum", "first", "last"}, rows)
+		return nil
+	}
+	if toStdout {
+		slog.Info("Wrote transactions to stdout", "range", opts.Range, "count", savepoint.Transactions, "duration", time.Since(startedAt))
+		return nil
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("closing CSV file: %w", err)
+	}
+	if opts.Format == "xlsx" {
+		if err := convertToXLSX(partialPath, writtenColumns(opts.CSV)); err != nil {
+			return fmt.Errorf("converting export to xlsx: %w", err)
+		}
+	}
+	if opts.Format == "csv" {
+		if err := checkClosed(cfg.TransactionOutputDir, outputPath, partialPath, opts.Reopen); err != nil {
+			return err
+		}
+	}
+	if opts.Format == "events" {
+		count, err := commitEvents(partialPath, eventsPath, eventStatePath, eventState)
+		if err != nil {
+			return fmt.Errorf("appending events: %w", err)
+		}
+		outputPath = eventsPath
+		slog.Info("Appended events", "count", count, "path", eventsPath)
+	} else if savepoint.Transactions == 0 && opts.Empty == "none" && !appending {
+		for _, path := range []string{partialPath, outputPath} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				slog.Warn("Failed to remove file", "path", path, "err", err)
+			}
+		}
+		// nothing is left for the manifest to point to
+		outputPath = ""
+	} else if sameContents(partialPath, outputPath) {
+		// leave the existing file (and its mtime) alone so watchers don't see a change
+		if err := os.Remove(partialPath); err != nil {
+			slog.Warn("Failed to remove partial file", "err", err)
+		}
+		slog.Info("Export is unchanged", "path", outputPath)
+	} else if err := os.Rename(partialPath, outputPath); err != nil {
+		return fmt.Errorf("moving CSV file into place: %w", err)
+	}
+	if opts.Seen != nil {
+		maps.Copy(opts.Seen, savepoint.Appended)
+	}
+	if err := recordExport(cfg.TransactionOutputDir, periods, accounts, savepoint.Exported, time.Now()); err != nil {
+		slog.Warn("Failed to record exported months", "err", err)
+	}
+	if opts.SplitByClass && opts.Format == "csv" {
+		if _, err := os.Stat(outputPath); err == nil {
+			files, err := splitByClass(outputPath, "class", opts.CSV)
+			if err != nil {
+				return fmt.Errorf("splitting export by class: %w", err)
+			}
+			slog.Info("Split export by class", "files", files)
+		}
+	}
+	if opts.Format == "ofx" {
+		if _, err := os.Stat(outputPath); err == nil {
+			files, err := splitOFX(outputPath, cmp.Or(opts.OFXVersion, 1), accounts, cfg.AccountMetadata)
+			if err != nil {
+				return fmt.Errorf("splitting export by account: %w", err)
+			}
+			slog.Info("Split export by account", "files", files)
+		}
+	}
+
+	// Write manifest and stats
+	manifest := RunManifest{
+		Version:      version,
+		Range:        opts.Range,
+		Output:       outputPath,
+		StartedAt:    startedAt,
+		FinishedAt:   time.Now(),
+		Transactions: savepoint.Transactions,
+	}
+	for _, account := range accounts {
+		if stats, ok := savepoint.Stats[account.ID]; ok && (stats.Fetched > 0 || !opts.OmitZeroAccounts) {
+			manifest.Accounts = append(manifest.Accounts, *stats)
+		}
+	}
+	if opts.CSV.Owners != nil {
+		manifest.Owners = sortedOwnerStats(savepoint.Owners)
+	}
+	if err := manifest.Write(basePath + ".manifest.json"); err != nil {
+		slog.Warn("Failed to write manifest", "err", err)
+	}
+	if opts.Stats {
+		if err := WriteStatsCSV(basePath+".stats.csv", manifest.Accounts); err != nil {
+			slog.Warn("Failed to write stats", "err", err)
+		}
+		if opts.CSV.Owners != nil {
+			if err := WriteOwnersCSV(basePath+".owners.csv", manifest.Owners); err != nil {
+				slog.Warn("Failed to write owner subtotals", "err", err)
+			}
+		}
+	}
+
+	if opts.Charts {
+		charts, err := writeSpendingCharts(msgs, basePath, opts.Range, savepoint.Spending)
+		if err != nil {
+			slog.Warn("Failed to write charts", "err", err)
+		} else if len(charts) > 0 {
+			slog.Info("Wrote charts", "files", charts)
+		}
+	}
+
+	if err := savepoint.Remove(); err != nil {
+		slog.Warn("Failed to remove savepoint", "err", err)
+	}
+
+	// Apply retention policy
+	if opts.Retain > 0 || opts.RetainBytes > 0 {
+		if err := pruneExports(cfg.TransactionOutputDir, cfg.OutputLayout, time.Now().Local(), opts.Retain, opts.RetainBytes, basePath, opts.PruneDryRun); err != nil {
+			slog.Warn("Failed to prune exports", "err", err)
+		}
+	}
+
+	if opts.Latest != "" && opts.Latest != "none" && opts.Format == "csv" {
+		if err := updateLatest(cfg.TransactionOutputDir, cfg.OutputLayout, opts.Latest); err != nil {
+			slog.Warn("Failed to update "+latestFilename, "err", err)
+		}
+	}
+
+	if savepoint.Transactions == 0 {
+		slog.Info("No transactions found for any account", "range", opts.Range, "duration", time.Since(startedAt))
+		return nil
+	}
+	slog.Info("Wrote transactions", "range", opts.Range, "count", savepoint.Transactions, "path", outputPath, "duration", time.Since(startedAt))
+	return nil
+}
+
+// prefetch fetches the steps' transactions in order, with at most
+// Concurrency results in flight or waiting to be consumed, or fewer while
+// the server is slower than LatencyTarget. The returned func must be called
+// after consuming each result.
+func (e *Exporter) prefetch(ctx context.Context, steps []*exportStep) (consumed func()) {
+	limiter := newFetchLimiter(e.opts.Concurrency, e.opts.LatencyTarget)
+	attempts := 1
+	if e.opts.LatencyTarget > 0 {
+		attempts = adaptiveFetchAttempts
+	}
+	go func() {
+		for _, step := range steps {
+			if limiter.acquire(ctx) != nil {
+				return
+			}
+			go func() {
+				for attempt := 1; ; attempt++ {
+					startedAt := time.Now()
+					resp, err := e.client.FetchTransactions(step.account.ID, step.period.Start.String(), step.period.End.String())
+					limiter.observe(time.Since(startedAt), err)
+					if err == nil || attempt == attempts {
+						step.result <- fetchResult{resp, err}
+						return
+					}
+					slog.Warn("Failed to fetch transactions, retrying", "account", step.account.Name, "month", step.period.Month, "attempt", attempt, "err", err)
+					select {
+					case <-time.After(time.Duration(attempt) * e.opts.LatencyTarget):
+					case <-ctx.Done():
+						step.result <- fetchResult{resp, err}
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return limiter.release
+}
+
+// period is the part of an export range falling in one month, the unit of
+// progress recorded in the savepoint.
+type period struct {
+	Month      string
+	Start, End Date
+}
+
+// splitMonths splits the days from start to end into monthly periods.
+func splitMonths(start, end Date) []period {
+	var periods []period
+	for m := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); !m.After(end.Time); m = m.AddDate(0, 1, 0) {
+		from, to := Date{m}, Date{m.AddDate(0, 1, -1)}
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		periods = append(periods, period{Month: m.Format("2006-01"), Start: from, End: to})
+	}
+	return periods
+}
+
+// copyFileTo appends the contents of the file at path to w.
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// checkpoint persists the savepoint with the current end of the output file.
+func checkpoint(file *os.File, savepoint *Savepoint) error {
+	if savepoint.InMemory() {
+		return nil
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return savepoint.Checkpoint(offset)
+}
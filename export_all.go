@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// exportAll exports every month of the budget's history, from its first
+// month through the current one, to one file per month. opts supplies
+// everything but the range.
+func exportAll(ctx context.Context, cfg Config, client ActualClient, opts ExportOptions) error {
+	today := NewDate(time.Now().Local())
+	first, err := firstMonth(client, today)
+	if err != nil {
+		return fmt.Errorf("finding the budget's first month: %w", err)
+	}
+	opts.Start, opts.End = first, today.EndOfMonth()
+	return exportMonthly(ctx, cfg, client, opts)
+}
+
+// exportMonthly exports each month from opts.Start through opts.End to its
+// own file.
+func exportMonthly(ctx context.Context, cfg Config, client ActualClient, opts ExportOptions) error {
+	months := splitMonths(opts.Start, opts.End)
+	slog.Info("Exporting months", "count", len(months), "from", months[0].Month, "to", months[len(months)-1].Month)
+	for i, p := range months {
+		opts.Progress.Month(p.Month, i+1, len(months))
+		opts.Start, opts.End, opts.Range = p.Start, p.End, p.Month
+		if err := NewExporter(cfg, client, opts).Run(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstMonth returns the first day of the budget's first month: the earliest
+// budget month when the server has the months endpoint, otherwise the month
+// of the earliest transaction in any account.
+func firstMonth(client ActualClient, today Date) (Date, error) {
+	first := today
+	if supports(client, CapMonths) {
+		monthsResp, err := client.FetchMonths()
+		if err != nil {
+			return Date{}, err
+		}
+		for _, month := range monthsResp.Data {
+			t, err := time.Parse("2006-01", month)
+			if err != nil {
+				return Date{}, fmt.Errorf("invalid budget month %q: %w", month, err)
+			}
+			if d := (Date{t}); d.Before(first) {
+				first = d
+			}
+		}
+	} else {
+		slog.Info("The server has no /months endpoint, scanning every account for the earliest transaction")
+		accountsResp, err := client.FetchAccounts()
+		if err != nil {
+			return Date{}, err
+		}
+		for _, account := range accountsResp.Data {
+			txnResp, err := client.FetchTransactions(account.ID, "1970-01-01", today.String())
+			if err != nil {
+				return Date{}, fmt.Errorf("fetching transactions for account %s: %w", account.Name, err)
+			}
+			for _, txn := range txnResp.Data {
+				if txn.Date.Before(first) {
+					first = txn.Date
+				}
+			}
+		}
+	}
+	return Date{time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC)}, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+// forecastHistoryMonths is how far back schedules' past transactions are
+// looked up to find the category they post to.
+const forecastHistoryMonths = 3
+
+// forecastRow is one category's projected spending for the month.
+type forecastRow struct {
+	Category string `json:"category"`
+	Group    string `json:"group"`
+	// Spent is the month's spending so far, Scheduled the schedules still due
+	// and Projected the month's expected total: spending so far, the
+	// unscheduled spending continued at its month-to-date pace, and Scheduled.
+	Spent     Money `json:"spent"`
+	Scheduled Money `json:"scheduled"`
+	Projected Money `json:"projected"`
+	// Budgeted and Status are only set when the server has the months endpoint.
+	Budgeted *Money `json:"budgeted,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// runForecastReport projects each expense category's spending at the end of
+// the month from the month-to-date pace plus upcoming scheduled transactions.
+// Uncategorized transactions, such as transfers, are left out.
+func runForecastReport(args []string) {
+	fs := flag.NewFlagSet("report forecast", flag.ExitOnError)
+	var cfgFlag configFlags
+	var asOfFlag, outputFlag string
+	cfgFlag.register(fs)
+	fs.StringVar(&asOfFlag, "as-of", "", "Forecast from this day's point in its month, in YYYY-MM-DD format (defaults to today)")
+	fs.StringVar(&outputFlag, "output", "table", "Output format: table, csv, json")
+	fs.Parse(args) //nolint
+	switch outputFlag {
+	case "table", "csv", "json":
+	default:
+		log.Fatalf("Invalid -output value %q: must be table, csv or json", outputFlag)
+	}
+	asOf := NewDate(time.Now().Local())
+	if asOfFlag != "" {
+		var err error
+		if asOf, err = ParseDate(asOfFlag); err != nil {
+			log.Fatalf("Invalid -as-of value: %v", err)
+		}
+	}
+	start, end := Date{asOf.AddDate(0, 0, 1-asOf.Day())}, asOf.EndOfMonth()
+
+	cfg := loadConfig(cfgFlag)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	categoryMap, _, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	groupsResp, err := client.FetchCategoryGroups()
+	if err != nil {
+		log.Fatalf("Failed to fetch category groups: %v", err)
+	}
+	groupNames := make(map[string]string)
+	for _, g := range groupsResp.Data {
+		groupNames[g.ID] = g.Name
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	// month-to-date spending, split into scheduled and unscheduled so only the
+	// latter is extrapolated; older transactions only map schedules to categories
+	scheduledSoFar, unscheduledSoFar := make(map[string]Money), make(map[string]Money)
+	scheduleCategory := make(map[string]string)
+	scheduleCategoryDate := make(map[string]Date)
+	historyStart := Date{start.AddDate(0, -forecastHistoryMonths, 0)}
+	if err := forEachTransaction(client, accountsResp.Data, historyStart.String(), asOf.String(), func(_ Account, txn Transaction) {
+		if txn.Schedule != nil && txn.CategoryID != "" && !txn.Date.Before(scheduleCategoryDate[*txn.Schedule]) {
+			scheduleCategory[*txn.Schedule] = txn.CategoryID
+			scheduleCategoryDate[*txn.Schedule] = txn.Date
+		}
+		if txn.Date.Before(start) {
+			return
+		}
+		if txn.Schedule != nil {
+			scheduledSoFar[txn.CategoryID] = scheduledSoFar[txn.CategoryID].Add(txn.Amount)
+		} else {
+			unscheduledSoFar[txn.CategoryID] = unscheduledSoFar[txn.CategoryID].Add(txn.Amount)
+		}
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	upcoming := make(map[string]Money)
+	if supports(client, CapSchedules) {
+		schedulesResp, err := client.FetchSchedules()
+		if err != nil {
+			log.Fatalf("Failed to fetch schedules: %v", err)
+		}
+		for _, s := range schedulesResp.Data {
+			categoryID, ok := scheduleCategory[s.ID]
+			if !ok {
+				continue
+			}
+			for range s.Occurrences(asOf, end) {
+				upcoming[categoryID] = upcoming[categoryID].Add(s.Amount.Money)
+			}
+		}
+	} else {
+		slog.Warn("The server has no /schedules endpoint, forecasting from the month-to-date pace only")
+	}
+
+	budgeted := make(map[string]Money)
+	hasBudget := supports(client, CapMonths)
+	if hasBudget {
+		monthResp, err := client.FetchMonth(asOf.Format("2006-01"))
+		if err != nil {
+			log.Fatalf("Failed to fetch budget month: %v", err)
+		}
+		for _, group := range monthResp.Data.CategoryGroups {
+			for _, category := range group.Categories {
+				budgeted[category.ID] = category.Budgeted
+			}
+		}
+	} else {
+		slog.Warn("The server has no /months endpoint, forecasting without budgets")
+	}
+
+	elapsed, days := asOf.Day(), end.Day()
+	var rows []forecastRow
+	for id, category := range categoryMap {
+		if category.IsIncome {
+			continue
+		}
+		spent := scheduledSoFar[id].Add(unscheduledSoFar[id])
+		if spent.Cents == 0 && upcoming[id].Cents == 0 && budgeted[id].Cents == 0 {
+			continue
+		}
+		pace := Money{Cents: unscheduledSoFar[id].Cents * int64(days-elapsed) / int64(elapsed)}
+		row := forecastRow{
+			Category:  category.Name,
+			Group:     groupNames[category.GroupID],
+			Spent:     spent,
+			Scheduled: upcoming[id],
+			Projected: spent.Add(pace).Add(upcoming[id]),
+		}
+		if hasBudget {
+			b := budgeted[id]
+			row.Budgeted = &b
+			// spending is negative, so the budget covers it while the sum stays positive
+			row.Status = "on track"
+			if b.Add(row.Projected).Sign() < 0 {
+				row.Status = "over"
+			}
+		}
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b forecastRow) int {
+		return cmp.Or(cmp.Compare(a.Group, b.Group), cmp.Compare(a.Category, b.Category))
+	})
+	slog.Info("Forecast month", "month", asOf.Format("2006-01"), "as_of", asOf, "day", elapsed, "days", days)
+
+	if outputFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if rows == nil {
+			rows = []forecastRow{}
+		}
+		if err := enc.Encode(rows); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	var table [][]string
+	for _, row := range rows {
+		budget := ""
+		if row.Budgeted != nil {
+			budget = row.Budgeted.String()
+		}
+		table = append(table, []string{row.Category, row.Group, row.Spent.String(), row.Scheduled.String(), row.Projected.String(), budget, row.Status})
+	}
+	printReport(outputFlag, []string{"category", "group", "spent", "scheduled", "projected", "budgeted", "status"}, table)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gnucashHeader is the header of GnuCash's own transaction export, which
+// its CSV importer's "GnuCash Export Format" preset maps column by column.
+var gnucashHeader = []string{"Date", "Transaction ID", "Number", "Description", "Notes", "Commodity/Currency", "Void Reason", "Action", "Memo", "Full Account Name", "Account Name", "Amount With Sym", "Amount Num.", "Value With Sym", "Value Num.", "Reconcile", "Reconcile Date", "Rate/Price"}
+
+// gnucashWriter backs -preset gnucash: a CSV for GnuCash's importer with
+// "Multi-split" checked and the "GnuCash Export Format" preset, which reads
+// ISO dates. Each transaction is split rows sharing its Actual ID, the
+// account and the categories offsetting it (one per part of a split
+// transaction), signed as GnuCash does: positive
+// amounts debit the account. Accounts are named Assets:<account> or
+// Liabilities:<account> (for type=credit or type=liability in
+// ACCOUNT_METADATA), and categories Expenses:<category> or
+// Income:<category>, which the importer asks to map to your accounts the
+// first time it sees them. Transfers follow -format ledger, with any
+// category in the memo of the other account's split.
+type gnucashWriter struct {
+	w           *csv.Writer
+	categoryMap map[string]Category
+	payeeMap    map[string]Payee
+	meta        AccountMetadata
+	exported    map[string]bool // account IDs in the export
+}
+
+func NewGnuCashWriter(w io.Writer, categories map[string]Category, payeeMap map[string]Payee, meta AccountMetadata, accounts []Account) TransactionWriter {
+	return &gnucashWriter{w: csv.NewWriter(w), categoryMap: categories, payeeMap: payeeMap, meta: meta, exported: accountIDs(accounts)}
+}
+
+func (w *gnucashWriter) WriteHeader() error {
+	w.w.Write(gnucashHeader) //nolint
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *gnucashWriter) Add(acct Account, txns []Transaction) error {
+	for _, txn := range txns {
+		legs := counterparts(txn, w.categoryMap, w.payeeMap, w.exported)
+		if legs == nil {
+			continue
+		}
+		reconcile := "n"
+		switch {
+		case txn.Reconciled:
+			reconcile = "y"
+		case txn.Cleared:
+			reconcile = "c"
+		}
+		currency := "CURRENCY::" + strings.ToUpper(cmp.Or(w.meta.For(acct)["currency"], "USD"))
+		total := legsTotal(legs).String()
+		// the transaction's own fields go on its first split only
+		w.w.Write([]string{txn.Date.String(), txn.ID, "", w.payeeMap[txn.PayeeID].Name, ledgerText(txn.Notes), currency, "", "", "", //nolint
+			w.account(acct), gnucashLeaf(w.account(acct)), "", total, "", total, reconcile, "", "1"})
+		for _, l := range legs {
+			other := gnucashCategory(Category{IsIncome: l.amount.Sign() > 0})
+			memo := ""
+			switch {
+			case l.transfer.ID != "":
+				other, memo = w.account(l.transfer), ledgerText(l.category.Name)
+			case l.category.ID != "":
+				other = gnucashCategory(l.category)
+			}
+			amount := l.amount.Neg().String()
+			w.w.Write([]string{"", txn.ID, "", "", "", "", "", "", memo, //nolint
+				other, gnucashLeaf(other), "", amount, "", amount, "n", "", "1"})
+		}
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// WritePlaceholder does nothing: GnuCash has no use for a row without
+// accounts, and a file with just the header imports fine.
+func (w *gnucashWriter) WritePlaceholder(Date, string) error { return nil }
+
+// account returns the GnuCash account of an Actual account.
+func (w *gnucashWriter) account(acct Account) string {
+	if w.meta.IsLiability(acct) {
+		return "Liabilities:" + gnucashName(acct.Name)
+	}
+	return "Assets:" + gnucashName(acct.Name)
+}
+
+// gnucashCategory returns the GnuCash account of a category, or of
+// uncategorized spending or income for the zero Category.
+func gnucashCategory(c Category) string {
+	if c.IsIncome {
+		return "Income:" + gnucashName(cmp.Or(c.Name, "Uncategorized"))
+	}
+	return "Expenses:" + gnucashName(cmp.Or(c.Name, "Uncategorized"))
+}
+
+// gnucashName keeps a name from adding a level to the account tree: colons
+// separate account names in GnuCash.
+func gnucashName(name string) string {
+	return strings.ReplaceAll(ledgerText(name), ":", "-")
+}
+
+// gnucashLeaf returns the last name of a full account name.
+func gnucashLeaf(full string) string {
+	return full[strings.LastIndex(full, ":")+1:]
+}
+
+// parsePreset checks -preset: none or gnucash.
+func parsePreset(s string) (string, error) {
+	switch s {
+	case "none":
+		return "", nil
+	case "gnucash":
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -preset value %q", s)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// headerLocales are preset header names for HEADER_LOCALE.
+var headerLocales = map[string]map[string]string{
+	"de": {
+		"account":  "Konto",
+		"date":     "Datum",
+		"payee":    "Empfänger",
+		"amount":   "Betrag",
+		"category": "Kategorie",
+		"notes":    "Notizen",
+	},
+	"fr": {
+		"account":  "Compte",
+		"date":     "Date",
+		"payee":    "Bénéficiaire",
+		"amount":   "Montant",
+		"category": "Catégorie",
+		"notes":    "Notes",
+	},
+	"es": {
+		"account":  "Cuenta",
+		"date":     "Fecha",
+		"payee":    "Beneficiario",
+		"amount":   "Importe",
+		"category": "Categoría",
+		"notes":    "Notas",
+	},
+}
+
+// headerNames resolves the header name for each column from a locale preset
+// overridden by explicit mappings, later mappings winning.
+func headerNames(locale string, mappings ...map[string]string) (map[string]string, error) {
+	names := make(map[string]string)
+	if locale != "" {
+		preset, ok := headerLocales[locale]
+		if !ok {
+			return nil, fmt.Errorf("unknown HEADER_LOCALE %q", locale)
+		}
+		maps.Copy(names, preset)
+	}
+	for _, m := range mappings {
+		maps.Copy(names, m)
+	}
+	return names, nil
+}
+
+// parseHeaderMapping parses comma-separated "column=Name" or "column->Name"
+// pairs, e.g. "amount->Betrag,payee->Description".
+func parseHeaderMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		column, name, ok := strings.Cut(pair, "->")
+		if !ok {
+			column, name, ok = strings.Cut(pair, "=")
+		}
+		column, name = strings.TrimSpace(column), strings.TrimSpace(name)
+		if !ok || column == "" || name == "" {
+			return nil, fmt.Errorf("invalid header mapping %q: expected column->Name", pair)
+		}
+		mapping[column] = name
+	}
+	return mapping, nil
+}
+
+// checkHeaderColumns reports mapped columns that no export has: neither a
+// registry column, an ACCOUNT_METADATA key for -meta-columns nor a
+// NOTE_PATTERNS field.
+func checkHeaderColumns(names map[string]string, meta AccountMetadata, notes NotePatterns) error {
+	known := knownColumns(meta, notes)
+	for _, column := range slices.Sorted(maps.Keys(names)) {
+		if !known[column] {
+			return fmt.Errorf("header mapping names unknown column %q", column)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportSelection is what the interactive prompt asks for.
+type exportSelection struct {
+	Accounts      []string // IDs
+	IncludeClosed bool
+	From, To      string // YYYY-MM
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptExport asks which accounts and months to export. Open accounts start
+// selected; numbers and ranges such as "1 3-5" toggle accounts.
+func promptExport(in io.Reader, out io.Writer, accounts []Account, currentMonth string) (exportSelection, error) {
+	if len(accounts) == 0 {
+		return exportSelection{}, errors.New("the budget has no accounts")
+	}
+	r := bufio.NewReader(in)
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(out, prompt)
+		line, err := r.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", fmt.Errorf("reading answer: %w", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	selected := make([]bool, len(accounts))
+	for i, account := range accounts {
+		selected[i] = !account.Closed
+	}
+	for {
+		fmt.Fprintln(out, "Accounts:")
+		for i, account := range accounts {
+			box := "[ ]"
+			if selected[i] {
+				box = "[x]"
+			}
+			name := account.Name
+			if account.Closed {
+				name += " (closed)"
+			}
+			fmt.Fprintf(out, "  %s %2d) %s\n", box, i+1, name)
+		}
+		answer, err := ask("Toggle accounts by number (e.g. 1 3-5), a for all, n for none, Enter to continue: ")
+		if err != nil {
+			return exportSelection{}, err
+		}
+		if answer == "" {
+			if slices.Contains(selected, true) {
+				break
+			}
+			fmt.Fprintln(out, "Select at least one account.")
+			continue
+		}
+		switch answer {
+		case "a", "n":
+			for i := range selected {
+				selected[i] = answer == "a"
+			}
+		default:
+			toggle, err := parseSelection(answer, len(accounts))
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			for _, i := range toggle {
+				selected[i] = !selected[i]
+			}
+		}
+	}
+
+	askMonth := func(prompt, def string) (string, error) {
+		for {
+			answer, err := ask(fmt.Sprintf("%s (YYYY-MM) [%s]: ", prompt, def))
+			if err != nil {
+				return "", err
+			}
+			if answer == "" {
+				return def, nil
+			}
+			if _, err := time.Parse("2006-01", answer); err == nil {
+				return answer, nil
+			}
+			fmt.Fprintf(out, "%q isn't a month like %s.\n", answer, currentMonth)
+		}
+	}
+	var sel exportSelection
+	var err error
+	if sel.From, err = askMonth("From month", currentMonth); err != nil {
+		return exportSelection{}, err
+	}
+	for {
+		if sel.To, err = askMonth("To month", sel.From); err != nil {
+			return exportSelection{}, err
+		}
+		// YYYY-MM strings sort chronologically
+		if sel.To >= sel.From {
+			break
+		}
+		fmt.Fprintf(out, "The last month can't be before %s.\n", sel.From)
+	}
+
+	for i, account := range accounts {
+		if selected[i] {
+			sel.Accounts = append(sel.Accounts, account.ID)
+			sel.IncludeClosed = sel.IncludeClosed || account.Closed
+		}
+	}
+	answer, err := ask(fmt.Sprintf("Export %d accounts from %s to %s? [Y/n] ", len(sel.Accounts), sel.From, sel.To))
+	if err != nil {
+		return exportSelection{}, err
+	}
+	if answer != "" && !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		return exportSelection{}, errors.New("export cancelled")
+	}
+	return sel, nil
+}
+
+// parseSelection parses space- or comma-separated numbers and ranges from 1
+// to n into zero-based indexes.
+func parseSelection(s string, n int) ([]int, error) {
+	var indexes []int
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		lo, hi, isRange := strings.Cut(field, "-")
+		if !isRange {
+			hi = lo
+		}
+		first, err1 := strconv.Atoi(lo)
+		last, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("%q isn't an account number or range from 1 to %d", field, n)
+		}
+		for i := first; i <= last; i++ {
+			indexes = append(indexes, i-1)
+		}
+	}
+	return indexes, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jobsFilename = "jobs.json"
+
+// maxJobHistory is how many finished jobs jobs.json keeps.
+const maxJobHistory = 100
+
+// maxQueuedJobs is how many jobs may wait to run; more are refused.
+const maxQueuedJobs = 20
+
+// Export job states.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// exportJob is one export run by serve.
+type exportJob struct {
+	ID     int    `json:"id"`
+	Reason string `json:"reason"`
+	// Flags are added to the serve export flags, e.g. the web UI's -from.
+	Flags    []string  `json:"flags,omitempty"`
+	State    string    `json:"state"`
+	RetryOf  int       `json:"retry_of,omitempty"`
+	Created  time.Time `json:"created"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+	// Error is the last line the failed export logged.
+	Error string `json:"error,omitempty"`
+}
+
+// exportRunner runs export jobs as child processes, one at a time in the
+// order they were queued, and keeps their history in jobs.json so it
+// survives restarts. A job queued while one with the same flags is still
+// waiting is coalesced into it, and at most maxQueuedJobs wait at once.
+type exportRunner struct {
+	exe  string
+	args []string
+	path string
+
+	mu     sync.Mutex
+	jobs   []*exportJob // oldest first
+	nextID int
+	wake   chan struct{}
+}
+
+// newExportRunner loads the job history at path and starts running queued
+// jobs. Jobs that were running when the server stopped are marked failed;
+// their savepoints let a retry resume them.
+func newExportRunner(exe string, args []string, path string) (*exportRunner, error) {
+	r := &exportRunner{exe: exe, args: args, path: path, nextID: 1, wake: make(chan struct{}, 1)}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("reading jobs: %w", err)
+	default:
+		if err := json.Unmarshal(data, &r.jobs); err != nil {
+			return nil, fmt.Errorf("decoding jobs: %w", err)
+		}
+	}
+	for _, job := range r.jobs {
+		r.nextID = max(r.nextID, job.ID+1)
+		if job.State == jobRunning {
+			job.State, job.Finished, job.Error = jobFailed, time.Now(), "interrupted by a server restart"
+		}
+	}
+	r.save()
+	go r.work()
+	r.wake <- struct{}{}
+	return r, nil
+}
+
+// Trigger queues an export with the serve flags.
+func (r *exportRunner) Trigger(reason string) error {
+	_, err := r.Run(reason, nil)
+	return err
+}
+
+// Run queues an export with extra export flags, which override the serve ones.
+func (r *exportRunner) Run(reason string, extra []string) (exportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enqueue(reason, extra, 0)
+}
+
+// Retry queues a failed job again.
+func (r *exportRunner) Retry(id int, reason string) (exportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.jobs, func(job *exportJob) bool { return job.ID == id })
+	if i < 0 {
+		return exportJob{}, fmt.Errorf("no job %d", id)
+	}
+	if r.jobs[i].State != jobFailed {
+		return exportJob{}, fmt.Errorf("job %d is %s; only failed jobs can be retried", id, r.jobs[i].State)
+	}
+	return r.enqueue(reason, r.jobs[i].Flags, id)
+}
+
+// Jobs returns the job history, newest first.
+func (r *exportRunner) Jobs() []exportJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]exportJob, 0, len(r.jobs))
+	for _, job := range slices.Backward(r.jobs) {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// enqueue adds a job, or returns the queued job with the same flags; r.mu
+// must be held.
+func (r *exportRunner) enqueue(reason string, flags []string, retryOf int) (exportJob, error) {
+	queued := 0
+	for _, job := range r.jobs {
+		if job.State != jobQueued {
+			continue
+		}
+		if slices.Equal(job.Flags, flags) {
+			slog.Info("Export already queued", "job", job.ID, "reason", reason)
+			return *job, nil
+		}
+		queued++
+	}
+	if queued >= maxQueuedJobs {
+		return exportJob{}, fmt.Errorf("%d exports are already queued; try again once some finish", queued)
+	}
+	job := &exportJob{ID: r.nextID, Reason: reason, Flags: flags, State: jobQueued, RetryOf: retryOf, Created: time.Now()}
+	r.nextID++
+	r.jobs = append(r.jobs, job)
+	r.save()
+	slog.Info("Queued export", "job", job.ID, "reason", reason, "flags", strings.Join(flags, " "))
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return *job, nil
+}
+
+func (r *exportRunner) work() {
+	for range r.wake {
+		for {
+			job := r.start()
+			if job == nil {
+				break
+			}
+			errText := r.run(job)
+
+			r.mu.Lock()
+			job.Finished = time.Now()
+			if errText == "" {
+				job.State = jobSucceeded
+			} else {
+				job.State, job.Error = jobFailed, errText
+			}
+			r.save()
+			r.mu.Unlock()
+		}
+	}
+}
+
+// start marks the oldest queued job running and returns it, or nil.
+func (r *exportRunner) start() *exportJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.State == jobQueued {
+			job.State, job.Started = jobRunning, time.Now()
+			r.save()
+			return job
+		}
+	}
+	return nil
+}
+
+// run runs job's export, returning what went wrong, if anything.
+func (r *exportRunner) run(job *exportJob) string {
+	slog.Info("Starting export", "job", job.ID, "reason", job.Reason)
+	var stderr tailWriter
+	cmd := exec.Command(r.exe, append(slices.Clone(r.args), job.Flags...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		slog.Warn("Export failed", "job", job.ID, "err", err)
+		if line := stderr.lastLine(); line != "" {
+			return line
+		}
+		return err.Error()
+	}
+	slog.Info("Finished export", "job", job.ID, "duration", time.Since(job.Started))
+	return ""
+}
+
+// save writes the job history, dropping the oldest finished jobs beyond
+// maxJobHistory; r.mu must be held. Failures are only logged since the
+// queue keeps working in memory.
+func (r *exportRunner) save() {
+	finished := 0
+	for _, job := range slices.Backward(r.jobs) {
+		if job.State == jobSucceeded || job.State == jobFailed {
+			finished++
+		}
+		if finished > maxJobHistory {
+			r.jobs = slices.DeleteFunc(r.jobs, func(j *exportJob) bool { return j.ID <= job.ID && (j.State == jobSucceeded || j.State == jobFailed) })
+			break
+		}
+	}
+	data, err := json.MarshalIndent(r.jobs, "", "  ")
+	if err == nil {
+		err = os.WriteFile(r.path+".tmp", data, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(r.path+".tmp", r.path)
+	}
+	if err != nil {
+		slog.Warn("Failed to save jobs", "path", r.path, "err", err)
+	}
+}
+
+// tailWriter keeps the last few KB written to it.
+type tailWriter struct {
+	buf []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > 4096 {
+		t.buf = t.buf[len(t.buf)-4096:]
+	}
+	return len(p), nil
+}
+
+// lastLine returns the last non-empty line written.
+func (t *tailWriter) lastLine() string {
+	text := strings.TrimSpace(string(t.buf))
+	return strings.TrimSpace(text[strings.LastIndex(text, "\n")+1:])
+}
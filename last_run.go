@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const lastRunFilename = "last-run.json"
+
+// lastRunLookback is how far before the last run -since-last-run looks again,
+// so transactions that reach Actual a few days late are still picked up.
+const lastRunLookback = 7 * 24 * time.Hour
+
+// lastRun is the state -since-last-run keeps between runs.
+type lastRun struct {
+	Time time.Time `json:"time"`
+	// Seen maps the IDs of exported transactions to their dates, so months
+	// fetched again don't export them twice.
+	Seen map[string]Date `json:"seen"`
+	// Months holds the months whose export was last written by
+	// -since-last-run, so Seen covers all of its rows. Other months are
+	// rewritten rather than appended to.
+	Months map[string]bool `json:"months"`
+}
+
+func loadLastRun(path string) (*lastRun, error) {
+	state := &lastRun{Seen: make(map[string]Date), Months: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading last run: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("decoding last run: %w", err)
+	}
+	if state.Seen == nil {
+		state.Seen = make(map[string]Date)
+	}
+	if state.Months == nil {
+		state.Months = make(map[string]bool)
+	}
+	return state, nil
+}
+
+func (r *lastRun) save(path string) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding last run: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing last run: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing last run: %w", err)
+	}
+	return nil
+}
+
+// since returns the first day of the first month a run at now fetches: the
+// month lastRunLookback before the last run, or the current month on the
+// first run.
+func (r *lastRun) since(now time.Time) Date {
+	t := now
+	if !r.Time.IsZero() {
+		t = r.Time.Add(-lastRunLookback)
+	}
+	t = t.Local()
+	return Date{time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// exportSinceLastRun appends the transactions added since the last run to the
+// exports of each month from then until now, then records the run. A month
+// the last runs didn't write, such as one a plain export wrote, is rewritten
+// instead, as its rows aren't in Seen. opts supplies everything but the
+// range.
+func exportSinceLastRun(ctx context.Context, cfg Config, client ActualClient, opts ExportOptions) error {
+	path := filepath.Join(cfg.TransactionOutputDir, lastRunFilename)
+	state, err := loadLastRun(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	start := state.since(now)
+	if state.Time.IsZero() {
+		slog.Info("No previous run recorded, exporting the current month", "path", path)
+	} else {
+		slog.Info("Exporting transactions added since the last run", "last_run", state.Time.Local().Format(time.RFC3339))
+	}
+
+	opts.Seen = state.Seen
+	for _, p := range splitMonths(start, NewDate(now.Local()).EndOfMonth()) {
+		opts.Start, opts.End, opts.Range = p.Start, p.End, p.Month
+		opts.Append = state.Months[p.Month]
+		if !opts.Append {
+			slog.Info("No previous run wrote this month, rewriting it", "month", p.Month)
+		}
+		if err := NewExporter(cfg, client, opts).Run(ctx); err != nil {
+			return err
+		}
+		if !opts.DryRun {
+			state.Months[p.Month] = true
+		}
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	// later runs start no earlier than this run's lookback
+	state.Time = now
+	oldest := state.since(now)
+	for id, date := range state.Seen {
+		if date.Before(oldest) {
+			delete(state.Seen, id)
+		}
+	}
+	for month := range state.Months {
+		if month < oldest.Format("2006-01") {
+			delete(state.Months, month)
+		}
+	}
+	return state.save(path)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const latestFilename = "latest.csv"
+
+// updateLatest points dir/latest.csv at the newest export in dir, either as a
+// relative symlink or as a copy, replacing any previous latest.csv atomically.
+func updateLatest(dir string, layout outputLayout, mode string) error {
+	sets, err := listExports(dir, layout)
+	if err != nil {
+		return fmt.Errorf("listing exports: %w", err)
+	}
+	var newest string
+	for i := len(sets) - 1; i >= 0 && newest == ""; i-- {
+		if _, err := os.Stat(sets[i].base + ".csv"); err == nil {
+			newest = sets[i].base + ".csv"
+		}
+	}
+	if newest == "" {
+		return nil
+	}
+
+	latest := filepath.Join(dir, latestFilename)
+	tmp := latest + ".tmp"
+	os.Remove(tmp) //nolint
+	switch mode {
+	case "symlink":
+		target, err := filepath.Rel(dir, newest)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, tmp); err != nil {
+			return err
+		}
+	case "copy":
+		if err := copyFile(newest, tmp); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported -latest mode %q", mode)
+	}
+	return os.Rename(tmp, latest)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close() //nolint
+		return err
+	}
+	return out.Close()
+}
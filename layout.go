@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultOutputLayout = "{range}.csv"
+
+// outputLayout maps an export range to a path under the output directory.
+// Templates may use {range} (2024-06, 2024-01-2024-06 or 2024-01-15-2024-02-14), {year} (2024) and
+// {month} (06), e.g. "{year}/{month}.csv".
+type outputLayout struct {
+	template string
+	pattern  *regexp.Regexp
+}
+
+func parseOutputLayout(template string) (outputLayout, error) {
+	if !strings.HasSuffix(template, ".csv") {
+		return outputLayout{}, fmt.Errorf("OUTPUT_LAYOUT %q must end in .csv", template)
+	}
+	hasRange := strings.Contains(template, "{range}")
+	hasYearMonth := strings.Contains(template, "{year}") && strings.Contains(template, "{month}")
+	if !hasRange && !hasYearMonth {
+		return outputLayout{}, fmt.Errorf("OUTPUT_LAYOUT %q must contain {range} or both {year} and {month}", template)
+	}
+
+	// build a regexp matching the layout's base path (without .csv) plus any extension,
+	// so sidecar files like .manifest.json are matched too
+	base := filepath.ToSlash(strings.TrimSuffix(template, ".csv"))
+	expr := regexp.QuoteMeta(base)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{range}"), `(?P<range>\d{4}-\d{2}(?:-\d{2})?(?:-\d{4}-\d{2}(?:-\d{2})?)?)`, 1)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{year}"), `(?P<year>\d{4})`, 1)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{month}"), `(?P<month>\d{2})`, 1)
+	for _, p := range []string{"{range}", "{year}", "{month}"} {
+		expr = strings.ReplaceAll(expr, regexp.QuoteMeta(p), `\d+`)
+	}
+	pattern, err := regexp.Compile("^" + expr + `(\..+)$`)
+	if err != nil {
+		return outputLayout{}, fmt.Errorf("OUTPUT_LAYOUT %q: %w", template, err)
+	}
+	return outputLayout{template: template, pattern: pattern}, nil
+}
+
+// Path returns the export path for monthRange relative to the output directory.
+// from is the first day of the range.
+func (l outputLayout) Path(monthRange string, from time.Time) (string, error) {
+	if monthRange != from.Format("2006-01") && !strings.Contains(l.template, "{range}") {
+		return "", fmt.Errorf("OUTPUT_LAYOUT %q needs {range} to name exports other than single months", l.template)
+	}
+	r := strings.NewReplacer(
+		"{range}", monthRange,
+		"{year}", from.Format("2006"),
+		"{month}", from.Format("01"),
+	)
+	return filepath.FromSlash(r.Replace(l.template)), nil
+}
+
+// Match parses a path relative to the output directory, returning the export's
+// range, its last month, and the path without extension.
+func (l outputLayout) Match(rel string) (monthRange string, end time.Time, base string, ok bool) {
+	rel = filepath.ToSlash(rel)
+	m := l.pattern.FindStringSubmatch(rel)
+	if m == nil {
+		return "", time.Time{}, "", false
+	}
+	var year, month string
+	for i, name := range l.pattern.SubexpNames() {
+		switch name {
+		case "range":
+			monthRange = m[i]
+		case "year":
+			year = m[i]
+		case "month":
+			month = m[i]
+		}
+	}
+	if monthRange == "" {
+		monthRange = year + "-" + month
+	}
+	_, end, err := parseMonthRange(monthRange)
+	if err != nil {
+		return "", time.Time{}, "", false
+	}
+	base = strings.TrimSuffix(rel, m[len(m)-1])
+	return monthRange, end, filepath.FromSlash(base), true
+}
+
+// inProgress reports whether rel is a file still being written rather than
+// a finished export or sidecar: the .partial and .savepoint files next to an
+// unfinished export, or a .tmp about to replace a file.
+func inProgress(rel string) bool {
+	switch filepath.Ext(rel) {
+	case ".partial", ".savepoint", ".tmp":
+		return true
+	}
+	return false
+}
+
+// parseMonthRange parses "2024-06", "2024-01-2024-06" or "2024-01-15-2024-02-14"
+// into its first and last months.
+func parseMonthRange(monthRange string) (from, to time.Time, err error) {
+	fromPart, toPart := monthRange, monthRange
+	if len(monthRange) > len(time.DateOnly) {
+		// both halves have the same length
+		half := (len(monthRange) - 1) / 2
+		fromPart, toPart = monthRange[:half], monthRange[half+1:]
+	}
+	if from, err = parseRangeMonth(fromPart); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to, err = parseRangeMonth(toPart); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return from, to, nil
+}
+
+// parseRangeMonth parses a month or a day of a range into its month.
+func parseRangeMonth(s string) (time.Time, error) {
+	if len(s) == len(time.DateOnly) {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Parse("2006-01", s)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+func runLedger(args []string) {
+	if len(args) == 0 || args[0] != "open" {
+		fmt.Fprintln(os.Stderr, "usage: actual2csv ledger open [-date YYYY-MM-DD] [-equity ACCOUNT] [-o file] [-cfg configFilePath]")
+		os.Exit(2)
+	}
+	runLedgerOpen(args[1:])
+}
+
+// runLedgerOpen writes an hledger journal entry setting every open account to
+// its balance at the start of -date, offset against an equity account, so a
+// new journal fed by the CSV exports reconciles with Actual from that day.
+func runLedgerOpen(args []string) {
+	fs := flag.NewFlagSet("ledger open", flag.ExitOnError)
+	var cfgFlag configFlags
+	var dateFlag, equityFlag, outFlag string
+	cfgFlag.register(fs)
+	fs.StringVar(&dateFlag, "date", "", "Date of the opening entry in YYYY-MM-DD format (defaults to today); balances exclude transactions on that date")
+	fs.StringVar(&equityFlag, "equity", "equity:opening balances", "Account that offsets the opening balances")
+	fs.StringVar(&outFlag, "o", "", "Write the journal to this file instead of stdout")
+	fs.Parse(args) //nolint
+
+	date := time.Now().Local()
+	if dateFlag != "" {
+		var err error
+		if date, err = time.Parse(time.DateOnly, dateFlag); err != nil {
+			log.Fatalf("Invalid -date value: %v", err)
+		}
+	}
+	cutoff := date.AddDate(0, 0, -1).Format(time.DateOnly)
+
+	cfg := loadConfig(cfgFlag)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	type posting struct {
+		account string
+		amount  Money
+	}
+	var postings []posting
+	width := len(equityFlag)
+	for _, account := range accountsResp.Data {
+		if account.Closed {
+			continue
+		}
+		balance, err := client.FetchBalance(account.ID, cutoff)
+		if err != nil {
+			log.Fatalf("Failed to fetch balance for account %s: %v", account.Name, err)
+		}
+		if balance.Data.Sign() == 0 {
+			continue
+		}
+		postings = append(postings, posting{account.Name, balance.Data})
+		width = max(width, len(account.Name))
+	}
+
+	var out io.Writer = os.Stdout
+	if outFlag != "" {
+		f, err := os.Create(outFlag)
+		if err != nil {
+			log.Fatalf("Failed to create journal: %v", err)
+		}
+		defer f.Close() //nolint
+		out = f
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s Opening balances\n", date.Format(time.DateOnly))
+	for _, p := range postings {
+		fmt.Fprintf(&b, "    %-*s  %12s\n", width, p.account, p.amount)
+	}
+	// hledger infers the balancing amount of the equity posting
+	fmt.Fprintf(&b, "    %s\n", equityFlag)
+	if _, err := io.WriteString(out, b.String()); err != nil {
+		log.Fatalf("Failed to write journal: %v", err)
+	}
+	if outFlag != "" {
+		slog.Info("Wrote opening balances", "accounts", len(postings), "path", outFlag)
+	}
+}
+
+// ledgerWriter backs -format ledger: an hledger/Ledger journal with an entry
+// per transaction, the payee as its description and the notes as a comment.
+// The account is one posting and the category the other, offsetting it, so
+// income is credited to its category like spending is debited to one;
+// uncategorized transactions go to Uncategorized and split transactions get
+// a posting per part. Transfers are one entry between the two accounts,
+// written from the side the money left unless the other account isn't
+// exported, with any category Actual gave them as a posting comment.
+type ledgerWriter struct {
+	w           *bufio.Writer
+	categoryMap map[string]Category
+	payeeMap    map[string]Payee
+	exported    map[string]bool // account IDs in the export
+}
+
+func NewLedgerWriter(w io.Writer, categories map[string]Category, payeeMap map[string]Payee, accounts []Account) TransactionWriter {
+	return &ledgerWriter{w: bufio.NewWriter(w), categoryMap: categories, payeeMap: payeeMap, exported: accountIDs(accounts)}
+}
+
+func (w *ledgerWriter) WriteHeader() error { return nil }
+
+func (w *ledgerWriter) Add(acct Account, txns []Transaction) error {
+	for _, txn := range txns {
+		legs := counterparts(txn, w.categoryMap, w.payeeMap, w.exported)
+		if legs == nil {
+			continue
+		}
+		payee := w.payeeMap[txn.PayeeID]
+		status := ""
+		if txn.Cleared || txn.Reconciled {
+			status = " *"
+		}
+		fmt.Fprintf(w.w, "%s%s", txn.Date, status)
+		if description := ledgerText(payee.Name); description != "" {
+			fmt.Fprintf(w.w, " %s", description)
+		}
+		if notes := ledgerText(txn.Notes); notes != "" {
+			fmt.Fprintf(w.w, "  ; %s", notes)
+		}
+		// two spaces end an account name, so its spaces are collapsed too
+		account := ledgerText(acct.Name)
+		others := make([]string, len(legs))
+		width := len(account)
+		for i, l := range legs {
+			others[i] = ledgerText(cmp.Or(l.transfer.Name, l.category.Name, "Uncategorized"))
+			width = max(width, len(others[i]))
+		}
+		fmt.Fprintf(w.w, "\n    %-*s  %12s\n", width, account, legsTotal(legs))
+		for i, l := range legs {
+			fmt.Fprintf(w.w, "    %-*s  %12s", width, others[i], l.amount.Neg())
+			if l.transfer.ID != "" && l.category.Name != "" {
+				fmt.Fprintf(w.w, "  ; category: %s", ledgerText(l.category.Name))
+			}
+			w.w.WriteString("\n")
+		}
+		w.w.WriteString("\n")
+	}
+	return w.w.Flush()
+}
+
+func (w *ledgerWriter) WritePlaceholder(date Date, note string) error {
+	fmt.Fprintf(w.w, "; %s %s\n", date, note)
+	return w.w.Flush()
+}
+
+// leg is one posting offsetting an account's posting in the double-entry
+// formats: a category, another account for a transfer, or neither for an
+// uncategorized transaction. amount is the account's side of it, so the leg
+// posts its negation.
+type leg struct {
+	category Category
+	transfer Account
+	amount   Money
+}
+
+// counterparts returns the legs offsetting txn in the double-entry formats,
+// one per part of a split transaction, or nil when txn is written from
+// another account. A transfer leg goes to the other account whether or not
+// Actual categorized it, as it does for transfers out of the budget; its
+// category is kept for a comment. A transfer between two exported accounts
+// is written once, from the account the money left.
+func counterparts(txn Transaction, categoryMap map[string]Category, payeeMap map[string]Payee, exported map[string]bool) []leg {
+	if txn.IsParent && len(txn.Subtransactions) > 0 {
+		var legs []leg
+		for _, sub := range txn.Subtransactions {
+			legs = append(legs, counterparts(sub, categoryMap, payeeMap, exported)...)
+		}
+		return legs
+	}
+	category := categoryMap[txn.CategoryID]
+	payee := payeeMap[txn.PayeeID]
+	if payee.TransferAccount == "" {
+		return []leg{{category: category, amount: txn.Amount}}
+	}
+	if exported[payee.TransferAccount] && transferReceived(txn) {
+		return nil
+	}
+	// Actual names transfer payees after the other account
+	return []leg{{category: category, transfer: Account{ID: payee.TransferAccount, Name: payee.Name}, amount: txn.Amount}}
+}
+
+// transferReceived reports whether txn is the side of a transfer the money
+// went to, breaking the tie for zero amounts by transaction ID.
+func transferReceived(txn Transaction) bool {
+	if sign := txn.Amount.Sign(); sign != 0 || txn.TransferID == nil {
+		return sign > 0
+	}
+	return txn.ID > *txn.TransferID
+}
+
+// legsTotal returns the amount of the account posting legs offset.
+func legsTotal(legs []leg) Money {
+	var total Money
+	for _, l := range legs {
+		total = total.Add(l.amount)
+	}
+	return total
+}
+
+// accountIDs returns the set of accounts' IDs.
+func accountIDs(accounts []Account) map[string]bool {
+	ids := make(map[string]bool)
+	for _, acct := range accounts {
+		ids[acct.ID] = true
+	}
+	return ids
+}
+
+// ledgerText puts s on one line with single spaces, as journal descriptions,
+// comments and account names need.
+func ledgerText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
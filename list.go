@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strconv"
+	"time"
+)
+
+// listFlags are shared by the accounts, categories and payees commands.
+type listFlags struct {
+	cfg    configFlags
+	output string
+}
+
+func (f *listFlags) register(fs *flag.FlagSet) {
+	f.cfg.register(fs)
+	fs.StringVar(&f.output, "output", "table", "Output format: table, csv")
+}
+
+func (f *listFlags) validate() {
+	switch f.output {
+	case "table", "csv":
+	default:
+		log.Fatalf("Invalid -output value %q: must be table or csv", f.output)
+	}
+}
+
+// runAccounts lists the budget's accounts.
+func runAccounts(args []string) {
+	fs := flag.NewFlagSet("accounts", flag.ExitOnError)
+	var f listFlags
+	var closedFlag bool
+	var orderFlag string
+	f.register(fs)
+	fs.BoolVar(&closedFlag, "closed", false, "Include closed accounts")
+	fs.StringVar(&orderFlag, "account-order", "api", "Order of accounts: api, alpha, config (ACCOUNT_ORDER, then by name), balance (largest first)")
+	fs.Parse(args) //nolint
+	f.validate()
+
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+	accounts, err := orderAccounts(client, accountsResp.Data, orderFlag, cfg.AccountOrder, NewDate(time.Now()))
+	if err != nil {
+		log.Fatalf("Failed to order accounts: %v", err)
+	}
+	var rows [][]string
+	for _, a := range accounts {
+		if a.Closed && !closedFlag {
+			continue
+		}
+		rows = append(rows, []string{a.ID, a.Name, strconv.FormatBool(a.OffBudget), strconv.FormatBool(a.Closed)})
+	}
+	printReport(f.output, []string{"id", "name", "off_budget", "closed"}, rows)
+}
+
+// runCategories lists the budget's categories with their group.
+func runCategories(args []string) {
+	fs := flag.NewFlagSet("categories", flag.ExitOnError)
+	var f listFlags
+	var hiddenFlag bool
+	f.register(fs)
+	fs.BoolVar(&hiddenFlag, "hidden", false, "Include hidden categories")
+	fs.Parse(args) //nolint
+	f.validate()
+
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	groupsResp, err := client.FetchCategoryGroups()
+	if err != nil {
+		log.Fatalf("Failed to fetch category groups: %v", err)
+	}
+	var rows [][]string
+	for _, g := range groupsResp.Data {
+		for _, c := range g.Categories {
+			if (c.Hidden || g.Hidden) && !hiddenFlag {
+				continue
+			}
+			rows = append(rows, []string{c.ID, c.Name, g.Name, strconv.FormatBool(c.IsIncome), strconv.FormatBool(c.Hidden || g.Hidden)})
+		}
+	}
+	printReport(f.output, []string{"id", "name", "group", "income", "hidden"}, rows)
+}
+
+// runPayees lists the budget's payees. Transfer payees show the account they
+// transfer to.
+func runPayees(args []string) {
+	fs := flag.NewFlagSet("payees", flag.ExitOnError)
+	var f listFlags
+	f.register(fs)
+	fs.Parse(args) //nolint
+	f.validate()
+
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	payeesResp, err := client.FetchPayees()
+	if err != nil {
+		log.Fatalf("Failed to fetch payees: %v", err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+	accountNames := make(map[string]string, len(accountsResp.Data))
+	for _, a := range accountsResp.Data {
+		accountNames[a.ID] = a.Name
+	}
+	var rows [][]string
+	for _, p := range payeesResp.Data {
+		rows = append(rows, []string{p.ID, p.Name, accountNames[p.TransferAccount]})
+	}
+	printReport(f.output, []string{"id", "name", "transfer_account"}, rows)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// locationRegions are the US state and Canadian province codes banks append
+// to card transactions, e.g. "STARBUCKS #1234 SEATTLE WA".
+var locationRegions = strings.Fields(`AL AK AZ AR CA CO CT DE DC FL GA HI ID IL IN IA KS KY LA ME MD MA MI MN
+	MS MO MT NE NV NH NJ NM NY NC ND OH OK OR PA PR RI SC SD TN TX UT VT VA WA WV WI WY
+	AB BC MB NB NL NS NT NU ON PE QC SK YT`)
+
+// locationAmbiguousRegions are region codes that are also words payees end
+// with, like "BLUE BOTTLE CO". Unless the bank padded the fields, they're only
+// read as a region after a store number, as in "SHELL #0412 TULSA OK".
+var locationAmbiguousRegions = strings.Fields(`CO IN OR ON ME OK`)
+
+// locationStoreNumber matches the store number banks put before the city.
+var locationStoreNumber = regexp.MustCompile(`^#?\d+$`)
+
+// locationCityPrefixes start two-word city names, so "SAN DIEGO CA" isn't
+// read as the city Diego.
+var locationCityPrefixes = strings.Fields(`SAN SANTA LOS LAS LA EL NEW NORTH SOUTH EAST WEST FORT FT SAINT ST MT
+	PORT PALM PALO SALT LONG GRAND CEDAR COLORADO BATON CORPUS OKLAHOMA KANSAS JERSEY VIRGINIA`)
+
+// locationCityAbbreviations are expanded by -location clean.
+var locationCityAbbreviations = map[string]string{"FT": "Fort", "ST": "St.", "MT": "Mount"}
+
+// locationFieldGap separates the fixed-width name, city and state fields
+// some banks pad with spaces.
+var locationFieldGap = regexp.MustCompile(`\s{2,}`)
+
+// parseLocation reads the city and state or province a bank appended to an
+// imported payee, or returns "" for both. Cities are only taken if they look
+// like one: phone numbers and web sites, which some merchants put there
+// instead, are left out.
+func parseLocation(s string) (city, region string) {
+	s = strings.TrimSpace(s)
+	if fields := locationFieldGap.Split(s, -1); len(fields) >= 3 {
+		// padded fields: name, city, state
+		region, city = fields[len(fields)-1], fields[len(fields)-2]
+		if !slices.Contains(locationRegions, region) {
+			return "", ""
+		}
+		if !locationCity(strings.Fields(city)) {
+			city = ""
+		}
+		return strings.Join(strings.Fields(city), " "), region
+	}
+	words := strings.Fields(s)
+	// the merchant, at least one word for the city and the state
+	if len(words) < 3 || !slices.Contains(locationRegions, words[len(words)-1]) {
+		return "", ""
+	}
+	region, words = words[len(words)-1], words[:len(words)-1]
+	cityWords := words[len(words)-1:]
+	if len(words) >= 3 && slices.Contains(locationCityPrefixes, strings.ToUpper(words[len(words)-2])) {
+		cityWords = words[len(words)-2:]
+	}
+	if slices.Contains(locationAmbiguousRegions, region) {
+		if before := len(words) - len(cityWords) - 1; before < 0 || !locationStoreNumber.MatchString(words[before]) {
+			return "", ""
+		}
+	}
+	if !locationCity(cityWords) {
+		return "", region
+	}
+	return strings.Join(cityWords, " "), region
+}
+
+// locationCity reports whether words look like a city name.
+func locationCity(words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	for _, word := range words {
+		for _, r := range word {
+			if !unicode.IsLetter(r) && r != '-' && r != '\'' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cleanCity title-cases a city the way banks write it, e.g. "FT LAUDERDALE"
+// becomes "Fort Lauderdale".
+func cleanCity(city string) string {
+	words := strings.Fields(city)
+	for i, word := range words {
+		if long, ok := locationCityAbbreviations[strings.ToUpper(word)]; ok && i == 0 && len(words) > 1 {
+			words[i] = long
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// parseLocationMode checks -location: none, raw (the city as the bank wrote
+// it) or clean (title-cased, abbreviations expanded).
+func parseLocationMode(s string) (string, error) {
+	switch s {
+	case "none":
+		return "", nil
+	case "raw", "clean":
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -location value %q", s)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogging applies -log-level and -log-format. The text format keeps the
+// standard log lines, with the level and fields appended to the message; json
+// writes one object per line for log collectors such as Loki.
+func setupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: must be debug, info, warn or error", level)
+	}
+	switch strings.ToLower(format) {
+	case "text":
+		slog.SetLogLoggerLevel(l)
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: l})))
+		// what's still logged through the log package are fatal errors
+		slog.SetLogLoggerLevel(slog.LevelError)
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+	return nil
+}
@@ -1,169 +1,861 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// version is overridden at build time via -ldflags "-X main.version=..."
+var version = "dev"
+
 // Config holds environment configuration
 type Config struct {
 	BudgetSyncID         string
 	ActualAPIKey         string
 	ActualAPIURL         string
+	ActualClientID       string
 	TransactionOutputDir string
+	OutputLayout         outputLayout
+	HeaderNames          map[string]string
+	AccountMetadata      AccountMetadata
+	AccountOrder         []string // ACCOUNT_ORDER, for -account-order config
+	Owners               *OwnerResolver
+	Classifier           *Classifier
+	Merchants            *MerchantCategories
+	DerivedRules         []DerivedRule
+	NotePatterns         NotePatterns
+	VATRates             VATRates
+	PayPeriods           *PayPeriods
+	CategoryAlerts       CategoryAlerts
+	CacheDir             string
+	MaxResponseBytes     int64
+	StrictSchema         bool
+	RequestRate          float64 // requests per second across all goroutines; 0 is unlimited
+	PublishURL           string
+	PublishTopic         string
+	NotifyURL            string
+	NotifySecret         string
+	WebhookSecret        string
+	UIPassword           string
+	APITokens            []apiToken
+	RedactionProfiles    RedactionProfiles
+	RedactionKey         string
+	DriveFolder          string
+	DriveClientID        string
+	DriveClientSecret    string
+	DropboxFolder        string
+	DropboxAppKey        string
+	OneDriveFolder       string
+	OneDriveClientID     string
+	OneDriveTenant       string
+
+	// AuthMode selects how requests authenticate beyond the API key:
+	// "" (API key only), "oidc-client-credentials" or "oidc-device".
+	AuthMode         string
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCScopes       string
 }
 
 func main() {
+	// Flags without a command run an export, as before subcommands existed.
+	cmd, args := "export", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "export":
+		runExport(args)
+	case "accounts":
+		runAccounts(args)
+	case "categories":
+		runCategories(args)
+	case "payees":
+		runPayees(args)
+	case "capabilities":
+		runCapabilities(args)
+	case "close":
+		runClose(args)
+	case "auth":
+		runAuth(args)
+	case "reorganize":
+		runReorganize(args)
+	case "digest":
+		runDigest(args)
+	case "tx":
+		runTx(args)
+	case "register":
+		runRegister(args)
+	case "reconcile-bank":
+		runReconcileBank(args)
+	case "search":
+		runSearch(args)
+	case "report":
+		runReport(args)
+	case "serve":
+		runServe(args)
+	case "ledger":
+		runLedger(args)
+	case "batch":
+		runBatch(args)
+	case "drive", "dropbox", "onedrive":
+		runMirror(cmd, args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "actual2csv: unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+const usage = `Usage: actual2csv <command> [flags]
+
+Commands:
+  export          Export transactions to CSV (the default when only flags are given)
+  accounts        List accounts
+  categories      List categories
+  payees          List payees
+  capabilities    Show which optional API endpoints the server supports
+  close           Finalize a month's export after checking reconciliation
+  report          Reports: duplicate-payees, category-audit, trial-balance, compare, forecast, by-tag
+  register        Print an account's month with running balances
+  reconcile-bank  Compare an account with a bank statement CSV
+  search          Search exported transactions
+  tx              Get and search transactions
+  ledger          Write hledger opening balances
+  digest          Send highlights of the trailing days
+  reorganize      Move flat exports into OUTPUT_LAYOUT
+  serve           Trigger exports over HTTP
+  batch           Run the exports described on stdin
+  auth            Rotate the API key
+  drive           Mirror exports into Google Drive
+  dropbox         Mirror exports into Dropbox
+  onedrive        Mirror exports into OneDrive
+
+Run "actual2csv <command> -h" for a command's flags.
+`
+
+// runExport exports transactions for a range of months to CSV.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
 	// Parse command line flags
-	var fromFlag, toFlag, cfgFlag string
-	flag.StringVar(&fromFlag, "from", "", "Start month in YYYY-MM format (optional, defaults to current month)")
-	flag.StringVar(&toFlag, "to", "", "End month in YYYY-MM format (optional, defaults to -from)")
-	flag.StringVar(&cfgFlag, "cfg", "./.env", "Path to configuration file")
-	flag.Parse()
+	var cfgFlag configFlags
+	var accountsFlag, excludeAccountsFlag listFlag
+	var accountOrderFlag, fillGapsFlag, yearFlag, yearFilesFlag, columnsFlag, headerNamesFlag, delimiterFlag, redactFlag, presetFlag string
+	var includeClosedFlag, sinceLastRunFlag, allFlag, reopenFlag, checkClosedFlag, interactiveFlag, dryRunFlag bool
+	var rateFlag float64
+	var latencyTargetFlag time.Duration
+	var fromFlag, toFlag, startFlag, endFlag, outputFlag, metaColumnsFlag, metaFilterFlag, errorsFileFlag, formatFlag, locationFlag, emptyFlag, zeroAccountsFlag, progressFlag, retainSizeFlag, latestFlag, langFlag, profileFlag, flushBytesFlag string
+	var retainFlag, notesMaxFlag, flushRowsFlag, concurrencyFlag, previewRowsFlag, ofxVersionFlag int
+	var versionFlag, liabilitiesFlag, chartsFlag, vatFlag, derivedFlag, ownerFlag, classifyFlag, mccFlag, splitByClassFlag, strictSchemaFlag, sanitizeNotesFlag, rawNotesFlag, statsFlag, pruneDryRunFlag, preambleFlag, balancesFlag, crlfFlag, quoteAllFlag, decimalCommaFlag, debitCreditFlag, noteFieldsFlag, dayColumnsFlag, payPeriodFlag bool
+	fs.StringVar(&fromFlag, "from", "", "Start month in YYYY-MM format (optional, defaults to current month)")
+	fs.StringVar(&toFlag, "to", "", "End month in YYYY-MM format (optional, defaults to -from)")
+	fs.StringVar(&startFlag, "start", "", "First day in YYYY-MM-DD format, for ranges that aren't whole months (overrides -from/-to)")
+	fs.StringVar(&endFlag, "end", "", "Last day in YYYY-MM-DD format (optional, defaults to today)")
+	fs.BoolVar(&dryRunFlag, "dry-run", false, "Print the first -preview-rows rows of each account and per-account totals to stdout without writing any files")
+	fs.IntVar(&previewRowsFlag, "preview-rows", 10, "Rows per account printed by -dry-run")
+	fs.BoolVar(&interactiveFlag, "interactive", false, "Pick the accounts and months to export from prompts")
+	fs.StringVar(&yearFlag, "year", "", "Export January through December of this year, e.g. 2023")
+	fs.StringVar(&yearFilesFlag, "year-files", "combined", "Files written by -year: combined (one file for the year), monthly (one file per month)")
+	cfgFlag.register(fs)
+	fs.StringVar(&outputFlag, "output", "", "Write the export to this path instead of TRANSACTION_OUTPUT_DIR, or to stdout with -")
+	fs.StringVar(&formatFlag, "format", "csv", "Output format: csv, beancount (Beancount ledger), events (append-only JSONL change log in the output directory), ledger (hledger/Ledger journal), ndjson (one JSON transaction per line), ofx (a bank statement file per account), text-summary (plain prose summary), xlsx (Excel workbook with date and number cells)")
+	fs.IntVar(&ofxVersionFlag, "ofx-version", 1, "OFX version for -format ofx: 1 (SGML, widest support) or 2 (XML)")
+	fs.StringVar(&emptyFlag, "empty", "header", "Output when no transactions are found: header (headers only), none (no file), placeholder (a single zero-amount row)")
+	fs.StringVar(&fillGapsFlag, "fill-gaps", "none", "Write zero-amount rows for periods without activity so pivot tables keep every month: none, months (each account's empty months), categories (each category's empty months)")
+	fs.StringVar(&zeroAccountsFlag, "zero-accounts", "include", "Whether accounts without transactions appear in the manifest and stats: include, omit")
+	fs.BoolVar(&preambleFlag, "preamble", false, "Write metadata (budget, export time, period, version) as # comment lines before the CSV header")
+	fs.BoolVar(&balancesFlag, "balances", false, "Append opening balance, total debits, total credits and closing balance rows after each account")
+	fs.BoolVar(&sanitizeNotesFlag, "sanitize-notes", false, "Replace non-printable characters and newlines in notes with spaces")
+	fs.IntVar(&notesMaxFlag, "notes-max", 0, "Truncate notes longer than this many characters (0 disables)")
+	fs.BoolVar(&rawNotesFlag, "raw-notes", false, "Add a raw_notes column with the unmodified notes")
+	fs.BoolVar(&noteFieldsFlag, "note-fields", false, "Add a column per named group of NOTE_PATTERNS, e.g. an invoice number, extracted from notes")
+	fs.StringVar(&presetFlag, "preset", "none", "CSV layout for importing into another application: none, gnucash (GnuCash's multi-split import with its \"GnuCash Export Format\" preset)")
+	fs.StringVar(&columnsFlag, "columns", "", "Comma-separated columns to write, in order, e.g. date,payee,amount,category (defaults to all)")
+	fs.StringVar(&delimiterFlag, "delimiter", ",", "Field delimiter, e.g. ';' for European Excel or '\\t' (or tab) for tab-separated files")
+	fs.BoolVar(&crlfFlag, "crlf", false, "End lines with CRLF for Windows software that expects it")
+	fs.StringVar(&redactFlag, "redact", "", "Drop or hash columns of transaction rows: a REDACTION_PROFILES name or e.g. payee=hash,notes=drop")
+	fs.BoolVar(&debitCreditFlag, "debit-credit", false, "Replace the amount column with debit (outflows) and credit (inflows) columns holding positive amounts")
+	fs.BoolVar(&decimalCommaFlag, "decimal-comma", false, "Write amounts with a decimal comma, e.g. 12,34 (pair it with -delimiter ';')")
+	fs.BoolVar(&quoteAllFlag, "quote-all", false, "Quote every field, not just those containing delimiters, quotes or newlines")
+	fs.StringVar(&headerNamesFlag, "header-names", "", "Rename headers for this export, e.g. 'amount->Betrag,payee->Description' (on top of HEADER_NAMES)")
+	fs.StringVar(&metaColumnsFlag, "meta-columns", "", "Comma-separated ACCOUNT_METADATA keys to add as columns, e.g. owner,bank")
+	fs.Var(&accountsFlag, "accounts", "Only export these accounts, by name or ID, e.g. Checking,Visa (may be repeated)")
+	fs.Var(&excludeAccountsFlag, "exclude-accounts", "Skip accounts matching these globs or /regexps/, by name or ID, e.g. 'Mortgage*,/(?i)escrow/' (may be repeated)")
+	fs.BoolVar(&reopenFlag, "reopen", false, "Allow changing exports of months finalized with the close command")
+	fs.BoolVar(&checkClosedFlag, "check-closed", true, "After exporting, compare closed and previously exported months against the API and report retroactive changes")
+	fs.BoolVar(&allFlag, "all", false, "Export every month of the budget's history, one file per month")
+	fs.BoolVar(&sinceLastRunFlag, "since-last-run", false, "Append only transactions added since the last -since-last-run to each month's export, from a week before that run through the current month")
+	fs.BoolVar(&includeClosedFlag, "include-closed", false, "Also export closed accounts, e.g. for months when they were still open")
+	fs.StringVar(&accountOrderFlag, "account-order", "api", "Order of accounts in the export: api, alpha, config (-accounts or ACCOUNT_ORDER, then by name), balance (largest first)")
+	fs.StringVar(&metaFilterFlag, "meta", "", "Only export accounts whose ACCOUNT_METADATA matches, e.g. owner=alice,bank=Chase")
+	fs.BoolVar(&ownerFlag, "owner", false, "Add an owner column from OWNER_PAYEE_RULES and ACCOUNT_METADATA owner=..., with per-owner subtotals in the manifest")
+	fs.BoolVar(&vatFlag, "vat", false, "Add net, tax and gross columns using VAT_RATES for tax-inclusive categories")
+	fs.BoolVar(&derivedFlag, "derived-rows", false, "Add synthetic rows (e.g. mileage) for notes matching DERIVED_ROW_RULES")
+	fs.BoolVar(&classifyFlag, "classify", false, "Add a class column (e.g. business/personal) from CLASSIFICATION_RULES")
+	fs.StringVar(&locationFlag, "location", "none", "Add city and state columns parsed from the payee as imported from the bank: none, raw (as the bank wrote them), clean (title-cased, e.g. Fort Lauderdale)")
+	fs.BoolVar(&dayColumnsFlag, "day-columns", false, "Add day_of_week, is_weekend and week_of_month columns derived from the date")
+	fs.BoolVar(&payPeriodFlag, "pay-period", false, "Add a pay_period column with the first day of the transaction's PAY_PERIOD pay period")
+	fs.BoolVar(&mccFlag, "mcc", false, "Add mcc and merchant_type columns with the payee's merchant category code, from MERCHANT_CATEGORIES and a built-in table")
+	fs.BoolVar(&splitByClassFlag, "split-by-class", false, "Write one {range}.{class}.csv per class instead of a combined file (implies -classify)")
+	fs.StringVar(&errorsFileFlag, "errors-file", "", "Write problematic rows and errors to this CSV instead of the export")
+	fs.BoolVar(&strictSchemaFlag, "strict-schema", false, "Fail if API responses contain fields actual2csv doesn't know about")
+	fs.BoolVar(&liabilitiesFlag, "liabilities", false, "Write accounts marked type=liability in ACCOUNT_METADATA (credit cards) as debit/credit postings with positive amounts")
+	fs.BoolVar(&chartsFlag, "charts", false, "Also write spending-by-category bar and pie charts as SVG next to the export")
+	fs.BoolVar(&statsFlag, "stats", false, "Also write per-account stats to {range}.stats.csv")
+	fs.IntVar(&retainFlag, "retain", 0, "Prune exports older than this many months after a successful run (0 keeps everything)")
+	fs.IntVar(&flushRowsFlag, "flush-rows", defaultFlushPolicy.Rows, "Buffer up to this many CSV rows before writing them out; 0 disables the limit, and with -flush-bytes 0 rows are written after every account and month")
+	fs.StringVar(&flushBytesFlag, "flush-bytes", "1MB", "Buffer up to this many bytes of CSV rows before writing them out, e.g. 4MB; 0 disables the limit")
+	fs.StringVar(&retainSizeFlag, "retain-size", "", "Prune the oldest exports until the output directory is under this size, e.g. 500MB")
+	fs.BoolVar(&pruneDryRunFlag, "prune-dry-run", false, "List exports that -retain/-retain-size would prune without deleting them")
+	fs.IntVar(&concurrencyFlag, "concurrency", 1, "Number of transaction requests to make in parallel")
+	fs.DurationVar(&latencyTargetFlag, "latency-target", 0, "Adapt the number of parallel transaction requests, up to -concurrency, to keep them faster than this, e.g. 2s; failed requests are retried (0 keeps -concurrency fixed)")
+	fs.StringVar(&progressFlag, "progress", "none", "Report progress on stderr for GUIs and wrappers: none, json")
+	fs.Float64Var(&rateFlag, "rate", 0, "Make at most this many API requests per second, e.g. 5 (0 is unlimited)")
+	fs.StringVar(&profileFlag, "profile", "", "Write a pprof profile of the run to actual2csv.<mode>.pprof: cpu, mem")
+	fs.StringVar(&langFlag, "lang", "en", "Language of summaries, charts and category alerts: en, de, fr, es")
+	fs.StringVar(&latestFlag, "latest", "none", "Maintain latest.csv in the output directory pointing at the newest export: none, symlink, copy")
+	fs.BoolVar(&versionFlag, "version", false, "Print version and exit")
+	fs.Parse(args) //nolint
+
+	if versionFlag {
+		fmt.Println("actual2csv", version)
+		return
+	}
+
+	cfg, errs := parseConfig(cfgFlag)
+	cf, _ := cfgFlag.read() // errors are reported by parseConfig
+	errs.Check(cf.applyFlags(fs), "the [export] section takes export flags without the leading -")
+	cfg.StrictSchema = strictSchemaFlag
+	cfg.RequestRate = rateFlag
+	if headerNamesFlag != "" {
+		mapping, err := parseHeaderMapping(headerNamesFlag)
+		errs.Check(err, "e.g. -header-names 'amount->Betrag,payee->Description'")
+		errs.Check(checkHeaderColumns(mapping, cfg.AccountMetadata, cfg.NotePatterns), "columns are "+strings.Join(columnNames(), ", ")+", ACCOUNT_METADATA keys and NOTE_PATTERNS groups")
+		cfg.HeaderNames, _ = headerNames("", cfg.HeaderNames, mapping)
+	}
+
+	if interactiveFlag {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-from", fromFlag != ""}, {"-start", startFlag != ""}, {"-year", yearFlag != ""}, {"-all", allFlag}, {"-since-last-run", sinceLastRunFlag}, {"-accounts", len(accountsFlag) > 0}} {
+			if f.set {
+				errs.Add(f.name+" can't be used with -interactive", "the prompts ask for the accounts and months")
+			}
+		}
+		if !isTerminal(os.Stdin) {
+			errs.Add("-interactive needs a terminal", "pass -from/-to and -accounts instead when scripting")
+		}
+		errs.Fatal()
+		accountsResp, err := NewActualClient(cfg, newHTTPClient(cfg)).FetchAccounts()
+		if err != nil {
+			log.Fatalf("Failed to fetch accounts: %v", err)
+		}
+		// prompts go to stderr like the logs, so they work with -output -
+		sel, err := promptExport(os.Stdin, os.Stderr, accountsResp.Data, time.Now().Local().Format("2006-01"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fromFlag, toFlag, accountsFlag = sel.From, sel.To, sel.Accounts
+		includeClosedFlag = includeClosedFlag || sel.IncludeClosed
+	}
 
-	// Validate from/to flags: -to requires -from
+	// Validate flags, collecting every problem with the configuration problems
 	if toFlag != "" && fromFlag == "" {
-		log.Fatal("-to requires -from")
+		errs.Add("-to requires -from", "")
+	}
+	if endFlag != "" && startFlag == "" {
+		errs.Add("-end requires -start", "")
+	}
+	if startFlag != "" && fromFlag != "" {
+		errs.Add("-start and -from can't be combined", "use -start/-end for day ranges or -from/-to for months")
+	}
+	if yearFlag != "" && (fromFlag != "" || startFlag != "") {
+		errs.Add("-year can't be combined with -from or -start", "")
+	}
+	switch yearFilesFlag {
+	case "combined", "monthly":
+	default:
+		errs.Add(fmt.Sprintf("invalid -year-files value %q", yearFilesFlag), "must be combined or monthly")
+	}
+	if yearFilesFlag == "monthly" && yearFlag != "" && outputFlag != "" {
+		errs.Add("-year-files monthly can't be used with -output", "monthly files are written to TRANSACTION_OUTPUT_DIR")
+	}
+	switch formatFlag {
+	case "csv", "beancount", "events", "ledger", "ndjson", "ofx", "text-summary", "xlsx":
+	default:
+		errs.Add(fmt.Sprintf("invalid -format value %q", formatFlag), "must be csv, beancount, events, ledger, ndjson, ofx, text-summary or xlsx")
+	}
+	if ofxVersionFlag != 1 && ofxVersionFlag != 2 {
+		errs.Add(fmt.Sprintf("invalid -ofx-version value %d", ofxVersionFlag), "must be 1 or 2")
+	}
+	switch emptyFlag {
+	case "header", "none", "placeholder":
+	default:
+		errs.Add(fmt.Sprintf("invalid -empty value %q", emptyFlag), "must be header, none or placeholder")
+	}
+	switch fillGapsFlag {
+	case "none", "months", "categories":
+	default:
+		errs.Add(fmt.Sprintf("invalid -fill-gaps value %q", fillGapsFlag), "must be none, months or categories")
+	}
+	switch zeroAccountsFlag {
+	case "include", "omit":
+	default:
+		errs.Add(fmt.Sprintf("invalid -zero-accounts value %q", zeroAccountsFlag), "must be include or omit")
+	}
+	switch latestFlag {
+	case "none", "symlink", "copy":
+	default:
+		errs.Add(fmt.Sprintf("invalid -latest value %q", latestFlag), "must be none, symlink or copy")
+	}
+	_, err := catalog(langFlag)
+	errs.Check(err, "-lang must be en, de, fr or es")
+	switch profileFlag {
+	case "", "cpu", "mem":
+	default:
+		errs.Add(fmt.Sprintf("invalid -profile value %q", profileFlag), "must be cpu or mem")
 	}
 
-	// Load environment variables
-	if err := godotenv.Load(cfgFlag); err != nil {
-		log.Printf("Warning: Error loading configuration file: %v", err)
+	if previewRowsFlag < 0 {
+		errs.Add(fmt.Sprintf("invalid -preview-rows value %d", previewRowsFlag), "must be 0 or more")
+	}
+	if concurrencyFlag < 1 {
+		errs.Add(fmt.Sprintf("invalid -concurrency value %d", concurrencyFlag), "must be at least 1")
+	}
+	var progress *progressReporter
+	switch progressFlag {
+	case "none":
+	case "json":
+		progress = newProgressReporter(os.Stderr)
+	default:
+		errs.Add(fmt.Sprintf("invalid -progress value %q", progressFlag), "must be none or json")
+	}
+	switch accountOrderFlag {
+	case "api", "alpha", "balance":
+	case "config":
+		if len(accountsFlag) == 0 && len(cfg.AccountOrder) == 0 {
+			errs.Add("-account-order config needs an order", "set ACCOUNT_ORDER=Checking,Visa,... or list the accounts with -accounts")
+		}
+	default:
+		errs.Add(fmt.Sprintf("invalid -account-order value %q", accountOrderFlag), "must be api, alpha, config or balance")
+	}
+	if latencyTargetFlag < 0 {
+		errs.Add(fmt.Sprintf("invalid -latency-target value %s", latencyTargetFlag), "must be a duration like 2s, or 0 to keep -concurrency fixed")
+	}
+	if rateFlag < 0 {
+		errs.Add(fmt.Sprintf("invalid -rate value %g", rateFlag), "must be a number of requests per second, or 0 for no limit")
+	}
+	flushPolicy := FlushPolicy{Rows: flushRowsFlag}
+	if flushPolicy.Bytes, err = parseByteSize(flushBytesFlag); err != nil {
+		errs.Add(fmt.Sprintf("invalid -flush-bytes value %q", flushBytesFlag), "e.g. 4MB, or 0 to disable")
+	}
+	var retainBytes int64
+	if retainSizeFlag != "" {
+		if retainBytes, err = parseByteSize(retainSizeFlag); err != nil {
+			errs.Add(fmt.Sprintf("invalid -retain-size value %q", retainSizeFlag), "e.g. 500MB")
+		}
 	}
+	excludeAccounts, err := ParseAccountPatterns(excludeAccountsFlag)
+	errs.Check(err, "-exclude-accounts takes globs like Mortgage* or regular expressions like /(?i)escrow/")
+	metaFilter, err := parseKeyValues(metaFilterFlag)
+	errs.Check(err, "-meta takes key=value pairs, e.g. owner=alice,bank=Chase")
 
-	cfg := Config{
-		BudgetSyncID:         getEnv("BUDGET_SYNC_ID", ""),
-		ActualAPIKey:         getEnv("ACTUAL_API_KEY", ""),
-		ActualAPIURL:         getEnv("ACTUAL_API_URL", ""),
-		TransactionOutputDir: getEnv("TRANSACTION_OUTPUT_DIR", ""),
+	// flag combinations that would silently do nothing
+	if formatFlag != "csv" {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-split-by-class", splitByClassFlag}, {"-latest", latestFlag != "none"}, {"-delimiter", delimiterFlag != ","}, {"-crlf", crlfFlag}, {"-quote-all", quoteAllFlag}, {"-decimal-comma", decimalCommaFlag}} {
+			if f.set {
+				errs.Add(f.name+" only applies to -format csv", "drop it or use -format csv")
+			}
+		}
+	}
+	// xlsx workbooks are converted from the CSV export, so the rows can be shaped alike
+	if formatFlag != "csv" && formatFlag != "xlsx" {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-balances", balancesFlag}, {"-fill-gaps", fillGapsFlag != "none"}, {"-columns", columnsFlag != ""}, {"-redact", redactFlag != ""}, {"-debit-credit", debitCreditFlag}, {"-preamble", preambleFlag}} {
+			if f.set {
+				errs.Add(f.name+" only applies to -format csv or xlsx", "drop it or use -format csv or xlsx")
+			}
+		}
+	}
+	preset, err := parsePreset(presetFlag)
+	errs.Check(err, "must be none or gnucash")
+	if preset != "" {
+		if formatFlag != "csv" {
+			errs.Add("-preset only applies to -format csv", "drop it or use -format csv")
+		}
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-columns", columnsFlag != ""}, {"-meta-columns", metaColumnsFlag != ""}, {"-note-fields", noteFieldsFlag}, {"-raw-notes", rawNotesFlag}, {"-owner", ownerFlag}, {"-classify", classifyFlag}, {"-split-by-class", splitByClassFlag}, {"-mcc", mccFlag}, {"-location", locationFlag != "none"}, {"-day-columns", dayColumnsFlag}, {"-pay-period", payPeriodFlag}, {"-vat", vatFlag}, {"-derived-rows", derivedFlag}, {"-liabilities", liabilitiesFlag}, {"-debit-credit", debitCreditFlag}, {"-balances", balancesFlag}, {"-fill-gaps", fillGapsFlag != "none"}, {"-redact", redactFlag != ""}, {"-preamble", preambleFlag}, {"-delimiter", delimiterFlag != ","}, {"-decimal-comma", decimalCommaFlag}} {
+			if f.set {
+				errs.Add(f.name+" can't be used with -preset "+preset, "the preset decides the columns and amounts")
+			}
+		}
+	}
+	if outputFlag == "-" && formatFlag == "xlsx" {
+		errs.Add("-output - can't be used with -format xlsx", "write the workbook to a file with -output path instead")
+	}
+	if outputFlag == "-" && formatFlag == "ofx" {
+		errs.Add("-output - can't be used with -format ofx", "each account gets its own file; use -output path instead")
+	}
+	if ofxVersionFlag != 1 && formatFlag != "ofx" {
+		errs.Add("-ofx-version only applies to -format ofx", "drop it or use -format ofx")
+	}
+	if outputFlag != "" && formatFlag == "events" {
+		errs.Add("-output can't be used with -format events", "events are always appended to "+eventsFilename+" in TRANSACTION_OUTPUT_DIR")
+	}
+	if outputFlag == "-" {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-empty none", emptyFlag == "none"}, {"-split-by-class", splitByClassFlag}, {"-stats", statsFlag}, {"-charts", chartsFlag}, {"-latest", latestFlag != "none"}} {
+			if f.set {
+				errs.Add(f.name+" can't be used with -output -", "write to a file with -output path instead")
+			}
+		}
+	}
+	if sinceLastRunFlag {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-from", fromFlag != ""}, {"-start", startFlag != ""}, {"-year", yearFlag != ""}, {"-output", outputFlag != ""}, {"-format " + formatFlag, formatFlag != "csv"}, {"-balances", balancesFlag}, {"-fill-gaps", fillGapsFlag != "none"}} {
+			if f.set {
+				errs.Add(f.name+" can't be used with -since-last-run", "it appends to the monthly exports in TRANSACTION_OUTPUT_DIR")
+			}
+		}
+	}
+	if allFlag {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-from", fromFlag != ""}, {"-start", startFlag != ""}, {"-year", yearFlag != ""}, {"-output", outputFlag != ""}, {"-since-last-run", sinceLastRunFlag}, {"-retain", retainFlag > 0 || retainBytes > 0}} {
+			if f.set {
+				errs.Add(f.name+" can't be used with -all", "-all writes every month of history to TRANSACTION_OUTPUT_DIR")
+			}
+		}
+	}
+	if pruneDryRunFlag && retainFlag == 0 && retainBytes == 0 {
+		errs.Add("-prune-dry-run requires -retain or -retain-size", "")
+	}
+	if vatFlag && len(cfg.VATRates) == 0 {
+		errs.Add("-vat requires VAT_RATES", "e.g. VAT_RATES=Office Supplies=19;Food=7")
+	}
+	if payPeriodFlag && cfg.PayPeriods == nil {
+		errs.Add("-pay-period requires PAY_PERIOD", "e.g. PAY_PERIOD=biweekly:2024-01-05, a payday")
+	}
+	if noteFieldsFlag && len(cfg.NotePatterns) == 0 {
+		errs.Add("-note-fields requires NOTE_PATTERNS", `e.g. NOTE_PATTERNS=(?i)invoice #?(?P<invoice>\d+)`)
+	}
+	if derivedFlag && len(cfg.DerivedRules) == 0 {
+		errs.Add("-derived-rows requires DERIVED_ROW_RULES", "e.g. DERIVED_ROW_RULES=miles:0.67:Mileage reimbursement")
 	}
 
-	// Validate config
-	if cfg.BudgetSyncID == "" || cfg.ActualAPIKey == "" || cfg.ActualAPIURL == "" {
-		log.Fatal("Missing required environment variables: BUDGET_SYNC_ID, ACTUAL_API_KEY, ACTUAL_API_URL")
+	if splitByClassFlag {
+		classifyFlag = true
 	}
 
 	// Determine date range based on flags
-	var startDate, endDate, monthRange string
-	if fromFlag == "" && toFlag == "" {
+	var fromTime, toTime Date
+	var monthRange string
+	if startFlag != "" {
+		if endFlag == "" {
+			endFlag = NewDate(time.Now().Local()).String()
+		}
+		var startErr, endErr error
+		if fromTime, startErr = ParseDate(startFlag); startErr != nil {
+			errs.Add(fmt.Sprintf("invalid -start value %q", startFlag), "use YYYY-MM-DD")
+		}
+		if toTime, endErr = ParseDate(endFlag); endErr != nil {
+			errs.Add(fmt.Sprintf("invalid -end value %q", endFlag), "use YYYY-MM-DD")
+		}
+		if startErr == nil && endErr == nil && fromTime.After(toTime) {
+			errs.Add("-start must be before or equal to -end", "")
+		}
+		monthRange = fmt.Sprintf("%s-%s", startFlag, endFlag)
+	} else if yearFlag != "" {
+		if fromTime.Time, err = time.Parse("2006", yearFlag); err != nil {
+			errs.Add(fmt.Sprintf("invalid -year value %q", yearFlag), "use YYYY")
+		}
+		toTime = Date{fromTime.AddDate(0, 11, 0)}
+		monthRange = fmt.Sprintf("%s-01-%s-12", yearFlag, yearFlag)
+	} else if fromFlag == "" && toFlag == "" {
 		// Use current month
 		currentMonth := time.Now().Local().Format("2006-01")
-		startDate = currentMonth + "-01"
-		endDate = currentMonth + "-31" // This works for all months due to Go's time parsing
+		fromTime.Time, _ = time.Parse("2006-01", currentMonth)
+		toTime = fromTime
 		monthRange = currentMonth
-	} else {
-		// fromFlag is guaranteed to be non-empty if toFlag is non-empty (validation above)
+	} else if fromFlag != "" {
 		if toFlag == "" {
 			toFlag = fromFlag
 		}
 		// Validate month formats
-		fromTime, err := time.Parse("2006-01", fromFlag)
-		if err != nil {
-			log.Fatalf("Invalid -from format: %v", err)
+		var fromErr, toErr error
+		if fromTime.Time, fromErr = time.Parse("2006-01", fromFlag); fromErr != nil {
+			errs.Add(fmt.Sprintf("invalid -from value %q", fromFlag), "use YYYY-MM")
 		}
-		toTime, err := time.Parse("2006-01", toFlag)
-		if err != nil {
-			log.Fatalf("Invalid -to format: %v", err)
+		if toTime.Time, toErr = time.Parse("2006-01", toFlag); toErr != nil && toFlag != fromFlag {
+			errs.Add(fmt.Sprintf("invalid -to value %q", toFlag), "use YYYY-MM")
 		}
-		// Validate that from is not after to
-		if fromTime.After(toTime) {
-			log.Fatalf("-from must be before or equal to -to")
+		if fromErr == nil && toErr == nil && fromTime.After(toTime) {
+			errs.Add("-from must be before or equal to -to", "")
 		}
-		startDate = fromFlag + "-01"
-		endDate = toFlag + "-31"
 		if fromFlag == toFlag {
 			monthRange = fromFlag
 		} else {
 			monthRange = fmt.Sprintf("%s-%s", fromFlag, toFlag)
 		}
 	}
-
-	// Create file
-	if err := os.MkdirAll(cfg.TransactionOutputDir, 0o755); err != nil {
-		log.Fatalf("Failed to create output directory: %v", err)
+	if startFlag == "" {
+		// month ranges run through the end of the last month
+		toTime = Date{toTime.AddDate(0, 1, -1)}
 	}
-	filename := fmt.Sprintf("%s.csv", monthRange)
-	filepath := filepath.Join(cfg.TransactionOutputDir, filename)
-	file, err := os.Create(filepath)
-	if err != nil {
-		log.Fatalf("Failed to create CSV file: %v", err)
+	if outputFlag == "" && !dryRunFlag {
+		errs.Check(checkWritableDir(cfg.TransactionOutputDir), "point TRANSACTION_OUTPUT_DIR at a directory you can write to")
 	}
-	defer file.Close() //nolint
-
-	// Client
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	csvOpts := CSVOptions{
+		HeaderNames:     cfg.HeaderNames,
+		SanitizeNotes:   sanitizeNotesFlag,
+		NotesMax:        notesMaxFlag,
+		RawNotes:        rawNotesFlag,
+		MetaColumns:     splitList(metaColumnsFlag),
+		AccountMetadata: cfg.AccountMetadata,
+		Liabilities:     liabilitiesFlag,
+		Flush:           flushPolicy,
+		Columns:         splitList(columnsFlag),
+	}
+	if noteFieldsFlag {
+		csvOpts.NotePatterns = cfg.NotePatterns
+	}
+	if derivedFlag {
+		csvOpts.DerivedRules = cfg.DerivedRules
+	}
+	if vatFlag {
+		csvOpts.VATRates = cfg.VATRates
+	}
+	if ownerFlag {
+		csvOpts.Owners = cfg.Owners
 	}
-	actualClient := NewActualClient(cfg, client)
+	if classifyFlag {
+		csvOpts.Classifier = cfg.Classifier
+	}
+	if mccFlag {
+		csvOpts.Merchants = cfg.Merchants
+	}
+	csvOpts.DayColumns = dayColumnsFlag
+	if payPeriodFlag {
+		csvOpts.PayPeriods = cfg.PayPeriods
+	}
+	csvOpts.Location, err = parseLocationMode(locationFlag)
+	errs.Check(err, "must be none, raw or clean")
+	csvOpts.CRLF = crlfFlag
+	csvOpts.QuoteAll = quoteAllFlag
+	csvOpts.DecimalComma = decimalCommaFlag
+	csvOpts.DebitCredit = debitCreditFlag
+	if debitCreditFlag && liabilitiesFlag {
+		errs.Add("-debit-credit can't be combined with -liabilities", "-liabilities already writes postings with positive amounts")
+	}
+	if redactFlag != "" {
+		csvOpts.Redaction, err = resolveRedaction(redactFlag, cfg.RedactionProfiles)
+		errs.Check(err, "use a REDACTION_PROFILES name or column=drop|hash pairs")
+		if err == nil {
+			errs.Check(csvOpts.Redaction.checkColumns(cfg.AccountMetadata, cfg.NotePatterns), "columns are "+strings.Join(columnNames(), ", ")+", ACCOUNT_METADATA keys and NOTE_PATTERNS groups")
+		}
+		if csvOpts.Redaction.hashes() && cfg.RedactionKey == "" {
+			errs.Add("-redact hashes columns but REDACTION_KEY is unset", "set REDACTION_KEY to a secret; unkeyed hashes of payee names can be guessed")
+		}
+		csvOpts.RedactionKey = cfg.RedactionKey
+	}
+	csvOpts.Delimiter, err = parseDelimiter(delimiterFlag)
+	errs.Check(err, "use a single character such as ; or |, or \\t for tabs")
+	errs.Check(checkColumns(csvOpts), "available columns are "+strings.Join(registryColumns(csvOpts), ", "))
+	if splitByClassFlag && len(csvOpts.Columns) > 0 && !slices.Contains(csvOpts.Columns, "class") {
+		errs.Add("-split-by-class needs the class column, which -columns leaves out", "add class to -columns")
+	}
+	errs.Fatal()
 
-	// Build name maps
-	categoriesResp, err := actualClient.FetchCategories()
+	stopProfile, err := startProfile(profileFlag)
 	if err != nil {
-		failWithMsg(file, fmt.Sprintf("Failed to fetch categories: %s", err))
+		log.Fatal(err)
+	}
+	defer stopProfile()
+
+	opts := ExportOptions{
+		Start:            fromTime,
+		End:              toTime,
+		Range:            monthRange,
+		Format:           formatFlag,
+		Output:           outputFlag,
+		Empty:            emptyFlag,
+		FillGaps:         fillGapsFlag,
+		Reopen:           reopenFlag,
+		DryRun:           dryRunFlag,
+		PreviewRows:      previewRowsFlag,
+		OmitZeroAccounts: zeroAccountsFlag == "omit",
+		Lang:             langFlag,
+		IncludeClosed:    includeClosedFlag,
+		Accounts:         accountsFlag,
+		ExcludeAccounts:  excludeAccounts,
+		AccountOrder:     accountOrderFlag,
+		MetaFilter:       metaFilter,
+		CSV:              csvOpts,
+		Preamble:         preambleFlag,
+		Balances:         balancesFlag,
+		OFXVersion:       ofxVersionFlag,
+		Preset:           preset,
+		SplitByClass:     splitByClassFlag,
+		ErrorsFile:       errorsFileFlag,
+		Stats:            statsFlag,
+		Charts:           chartsFlag,
+		Retain:           retainFlag,
+		RetainBytes:      retainBytes,
+		PruneDryRun:      pruneDryRunFlag,
+		Latest:           latestFlag,
+		Concurrency:      concurrencyFlag,
+		LatencyTarget:    latencyTargetFlag,
+		Progress:         progress,
 	}
-	categoryMap := make(map[string]Category)
-	for _, category := range categoriesResp.Data {
-		categoryMap[category.ID] = category
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	if len(cfg.CategoryAlerts) > 0 && !dryRunFlag && outputFlag != "-" {
+		categoriesResp, err := client.FetchCategories()
+		if err != nil {
+			log.Fatalf("Failed to fetch categories: %v", err)
+		}
+		errs.Check(cfg.CategoryAlerts.check(categoriesResp.Data), "use a category's name or ID, as listed by actual2csv categories")
+		errs.Fatal()
 	}
 
-	payeesResp, err := actualClient.FetchPayees()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// a second interrupt exits right away
+		<-ctx.Done()
+		stop()
+	}()
+	switch {
+	case allFlag:
+		err = exportAll(ctx, cfg, client, opts)
+	case sinceLastRunFlag:
+		err = exportSinceLastRun(ctx, cfg, client, opts)
+	case yearFlag != "" && yearFilesFlag == "monthly":
+		err = exportMonthly(ctx, cfg, client, opts)
+	default:
+		err = NewExporter(cfg, client, opts).Run(ctx)
+	}
 	if err != nil {
-		failWithMsg(file, fmt.Sprintf("Failed to fetch payees: %s", err))
+		log.Fatal(err)
+	}
+	// exports to stdout, such as the API's, may be for another budget than
+	// the output directory's, so they leave its checks and state alone
+	if checkClosedFlag && !dryRunFlag && outputFlag != "-" {
+		reportClosedChanges(cfg, client)
 	}
-	payeeMap := make(map[string]Payee)
-	for _, payee := range payeesResp.Data {
-		payeeMap[payee.ID] = payee
+	if !dryRunFlag && outputFlag != "-" {
+		checkCategoryAlerts(cfg, client, langFlag, time.Now())
 	}
+	if !dryRunFlag && outputFlag == "" {
+		syncMirrors(cfg)
+	}
+}
 
-	// Fetch accounts
-	accountsResp, err := actualClient.FetchAccounts()
-	if err != nil {
-		failWithMsg(file, fmt.Sprintf("Failed to fetch accounts: %s", err))
+// loadConfig reads the configuration file and environment, exiting with every
+// problem found if the configuration is invalid.
+func loadConfig(c configFlags) Config {
+	cfg, errs := parseConfig(c)
+	errs.Fatal()
+	return cfg
+}
+
+// parseConfig reads the configuration file and environment, collecting
+// problems instead of exiting so callers can add their own checks.
+func parseConfig(c configFlags) (Config, validationErrors) {
+	var errs validationErrors
+
+	// Load environment variables; the .env file is optional with a config file
+	if err := godotenv.Load(c.env); err != nil && (c.file == "" || !errors.Is(err, os.ErrNotExist)) {
+		slog.Warn("Error loading configuration file", "err", err)
+	}
+	cf, err := c.read()
+	errs.Check(err, "")
+	cf.applyEnv()
+	logLevel, logFormat := c.logLevel, c.logFormat
+	if logLevel == "" {
+		logLevel = getEnv("LOG_LEVEL", "info")
+	}
+	if logFormat == "" {
+		logFormat = getEnv("LOG_FORMAT", "text")
 	}
-	accounts := accountsResp.Data
-	log.Printf("Found %d accounts", len(accounts))
+	errs.Check(setupLogging(logLevel, logFormat), "")
+	timezone := c.timezone
+	if timezone == "" {
+		timezone = getEnv("TIMEZONE", "")
+	}
+	errs.Check(setupTimezone(timezone), "use an IANA name like America/Los_Angeles or UTC")
 
-	// Write txns
-	csvWriter := NewCSVWriter(file, categoryMap, payeeMap)
-	var totalTransactions int
-	for _, account := range accounts {
-		if account.Closed {
-			log.Printf("Skipping closed account: %s", account.Name)
-			continue
-		}
+	cfg := Config{
+		BudgetSyncID:         getEnv("BUDGET_SYNC_ID", ""),
+		ActualAPIKey:         getEnv("ACTUAL_API_KEY", ""),
+		ActualAPIURL:         getEnv("ACTUAL_API_URL", ""),
+		ActualClientID:       getEnv("ACTUAL_CLIENT_ID", ""),
+		TransactionOutputDir: getEnv("TRANSACTION_OUTPUT_DIR", ""),
+		CacheDir:             getEnv("CACHE_DIR", defaultCacheDir()),
+		MaxResponseBytes:     defaultMaxResponseBytes,
+		PublishURL:           getEnv("PUBLISH_URL", ""),
+		PublishTopic:         getEnv("PUBLISH_TOPIC", ""),
+		NotifyURL:            getEnv("NOTIFY_URL", ""),
+		NotifySecret:         getEnv("NOTIFY_SECRET", ""),
+		WebhookSecret:        getEnv("WEBHOOK_SECRET", ""),
+		UIPassword:           getEnv("UI_PASSWORD", ""),
+		RedactionKey:         getEnv("REDACTION_KEY", ""),
+		DriveFolder:          getEnv("GDRIVE_FOLDER", ""),
+		DriveClientID:        getEnv("GDRIVE_CLIENT_ID", ""),
+		DriveClientSecret:    getEnv("GDRIVE_CLIENT_SECRET", ""),
+		DropboxFolder:        getEnv("DROPBOX_FOLDER", ""),
+		DropboxAppKey:        getEnv("DROPBOX_APP_KEY", ""),
+		OneDriveFolder:       getEnv("ONEDRIVE_FOLDER", ""),
+		OneDriveClientID:     getEnv("ONEDRIVE_CLIENT_ID", ""),
+		OneDriveTenant:       getEnv("ONEDRIVE_TENANT", "common"),
+		AuthMode:             getEnv("AUTH_MODE", ""),
+		OIDCIssuer:           getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:         getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:     getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCScopes:           getEnv("OIDC_SCOPES", ""),
+	}
 
-		txnResponse, err := actualClient.FetchTransactions(account.ID, startDate, endDate)
-		if err != nil {
-			failWithMsg(file, fmt.Sprintf("Failed to fetch transactions for account %s: %v", account.Name, err))
-			continue
+	// Validate config
+	switch {
+	case cfg.BudgetSyncID == "":
+		errs.Add("BUDGET_SYNC_ID is not set", "find it in Actual under Settings > Show advanced settings > Sync ID")
+	case !syncIDPattern.MatchString(cfg.BudgetSyncID):
+		errs.Add(fmt.Sprintf("BUDGET_SYNC_ID %q is not a sync ID", cfg.BudgetSyncID), "expected a UUID like 1cfdbb80-6274-49bf-b0c2-737235a4c81f from Settings > Show advanced settings")
+	}
+	if cfg.ActualAPIKey == "" {
+		errs.Add("ACTUAL_API_KEY is not set", "use the API_KEY configured for actual-http-api")
+	}
+	if cfg.ActualAPIURL == "" {
+		errs.Add("ACTUAL_API_URL is not set", "e.g. http://localhost:5007/v1")
+	} else {
+		errs.Check(validateAPIURL(cfg.ActualAPIURL), "use http(s)://host[:port]/v1, h2c://host[:port]/v1 or unix:///path/to.sock?path=/v1")
+	}
+	if v := getEnv("MAX_RESPONSE_BYTES", ""); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			errs.Add(fmt.Sprintf("MAX_RESPONSE_BYTES %q is invalid", v), "use a positive number of bytes")
 		}
-		transactions := txnResponse.Data
-
-		if len(transactions) == 0 {
-			log.Printf("No transactions for account: %s", account.Name)
-			continue
+		cfg.MaxResponseBytes = n
+	}
+	meta, err := parseAccountMetadata(getEnv("ACCOUNT_METADATA", ""))
+	errs.Check(err, "e.g. ACCOUNT_METADATA=Checking:owner=alice,bank=Chase;Visa:type=credit")
+	cfg.AccountMetadata = meta
+	// HEADER_NAMES wins over the config file's [headers] section like other settings
+	mapping, err := parseHeaderMapping(getEnv("HEADER_NAMES", ""))
+	errs.Check(err, "e.g. HEADER_NAMES=amount->Betrag,payee->Description")
+	names, err := headerNames(getEnv("HEADER_LOCALE", ""), cf["headers"], mapping)
+	errs.Check(err, "HEADER_LOCALE is one of de, fr, es")
+	notePatterns, err := parseNotePatterns(getEnv("NOTE_PATTERNS", ""))
+	errs.Check(err, `e.g. NOTE_PATTERNS=(?i)invoice #?(?P<invoice>\d+);\[(?P<project>[A-Z]+-\d+)\]`)
+	cfg.NotePatterns = notePatterns
+	errs.Check(checkHeaderColumns(names, meta, notePatterns), "columns are "+strings.Join(columnNames(), ", ")+", ACCOUNT_METADATA keys and NOTE_PATTERNS groups")
+	cfg.HeaderNames = names
+	var accountOrder listFlag
+	accountOrder.Set(getEnv("ACCOUNT_ORDER", "")) //nolint
+	cfg.AccountOrder = accountOrder
+	owners, err := NewOwnerResolver(meta, getEnv("OWNER_PAYEE_RULES", ""))
+	errs.Check(err, "e.g. OWNER_PAYEE_RULES=alice=(?i)starbucks;bob=(?i)home depot")
+	cfg.Owners = owners
+	classifier, err := NewClassifier(getEnv("CLASSIFICATION_RULES", ""), getEnv("CLASSIFICATION_DEFAULT", ""))
+	errs.Check(err, "e.g. CLASSIFICATION_RULES=business:account=Biz Checking;business:payee=(?i)adobe")
+	cfg.Classifier = classifier
+	merchants, err := parseMerchantCategories(getEnv("MERCHANT_CATEGORIES", ""))
+	errs.Check(err, "e.g. MERCHANT_CATEGORIES=5411=(?i)corner market;5995:Pet Shops=(?i)petco|chewy")
+	cfg.Merchants = merchants
+	derived, err := parseDerivedRules(getEnv("DERIVED_ROW_RULES", ""))
+	errs.Check(err, "e.g. DERIVED_ROW_RULES=miles:0.67:Mileage reimbursement")
+	cfg.DerivedRules = derived
+	vatRates, err := parseVATRates(getEnv("VAT_RATES", ""))
+	errs.Check(err, "e.g. VAT_RATES=Office Supplies=19;Food=7")
+	cfg.VATRates = vatRates
+	payPeriods, err := parsePayPeriods(getEnv("PAY_PERIOD", ""))
+	errs.Check(err, "e.g. PAY_PERIOD=biweekly:2024-01-05, a payday")
+	cfg.PayPeriods = payPeriods
+	cfg.RedactionProfiles, err = parseRedactionProfiles(getEnv("REDACTION_PROFILES", ""))
+	errs.Check(err, "e.g. REDACTION_PROFILES=accountant:payee=hash,notes=drop;partner:notes=drop")
+	errs.Check(cfg.RedactionProfiles.checkColumns(meta, notePatterns), "columns are "+strings.Join(columnNames(), ", ")+", ACCOUNT_METADATA keys and NOTE_PATTERNS groups")
+	errs.Check(cfg.RedactionProfiles.checkKey(cfg.RedactionKey), "set REDACTION_KEY to a secret; unkeyed hashes of payee names can be guessed")
+	cfg.APITokens, err = parseAPITokens(getEnv("API_TOKENS", ""))
+	errs.Check(err, "e.g. API_TOKENS=partner:token=s3cret,accounts=Joint Checking|Joint Visa;accountant:token=t0ken,formats=csv,redact=accountant")
+	for _, t := range cfg.APITokens {
+		if _, ok := cfg.RedactionProfiles[t.Redact]; t.Redact != "" && !ok {
+			errs.Add(fmt.Sprintf("API token %s uses unknown redaction profile %q", t.Name, t.Redact), "define it in REDACTION_PROFILES")
 		}
-
-		if err := csvWriter.Add(account, transactions); err != nil {
-			failWithMsg(file, fmt.Sprintf("Failed to write transactions for account %s: %v", account.Name, err))
+	}
+	alerts, err := parseCategoryAlerts(getEnv("CATEGORY_ALERTS", ""))
+	errs.Check(err, "e.g. CATEGORY_ALERTS=Dining>400;Groceries>650")
+	cfg.CategoryAlerts = alerts
+	layout, err := parseOutputLayout(getEnv("OUTPUT_LAYOUT", defaultOutputLayout))
+	errs.Check(err, "e.g. OUTPUT_LAYOUT={year}/{month}.csv")
+	cfg.OutputLayout = layout
+	switch cfg.AuthMode {
+	case "":
+	case authModeClientCredentials, authModeDevice:
+		if cfg.OIDCIssuer == "" || cfg.OIDCClientID == "" {
+			errs.Add(fmt.Sprintf("AUTH_MODE=%s requires OIDC_ISSUER and OIDC_CLIENT_ID", cfg.AuthMode), "")
 		}
-		totalTransactions += len(transactions)
-		log.Printf("Added %d transactions for account %s (%s)", len(transactions), account.Name, account.ID)
+	default:
+		errs.Add(fmt.Sprintf("AUTH_MODE %q is not supported", cfg.AuthMode), "use "+authModeClientCredentials+" or "+authModeDevice+", or leave it unset")
 	}
-
-	if totalTransactions == 0 {
-		log.Println("No transactions found for any account")
-		return
+	if cfg.NotifyURL != "" {
+		_, err := NewNotifier(cfg.NotifyURL, cfg.NotifySecret)
+		errs.Check(err, "use an http(s) webhook URL")
+	}
+	if cfg.DriveFolder != "" && (cfg.DriveClientID == "" || cfg.DriveClientSecret == "") {
+		errs.Add("GDRIVE_FOLDER requires GDRIVE_CLIENT_ID and GDRIVE_CLIENT_SECRET", "create an OAuth client of type \"TVs and Limited Input devices\" in the Google Cloud console")
 	}
+	if cfg.DropboxFolder != "" && cfg.DropboxAppKey == "" {
+		errs.Add("DROPBOX_FOLDER requires DROPBOX_APP_KEY", "create an app in the Dropbox App Console with the files.content.write permission")
+	}
+	if cfg.OneDriveFolder != "" && cfg.OneDriveClientID == "" {
+		errs.Add("ONEDRIVE_FOLDER requires ONEDRIVE_CLIENT_ID", "register an app in the Azure portal with public client flows allowed and the Files.ReadWrite permission")
+	}
+	return cfg, errs
+}
 
-	log.Printf("Written %d total transactions to CSV for range %s", totalTransactions, monthRange)
+// budgetName looks up the budget's display name, falling back to its sync ID.
+func budgetName(client ActualClient, syncID string) string {
+	budgets, err := client.FetchBudgets()
+	if err != nil {
+		slog.Warn("Failed to fetch budgets", "err", err)
+		return syncID
+	}
+	for _, b := range budgets.Data {
+		if b.GroupID == syncID || b.CloudFileID == syncID {
+			return b.Name
+		}
+	}
+	return syncID
 }
 
 func getEnv(key, defaultValue string) string {
@@ -173,7 +865,39 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func failWithMsg(w *os.File, msg string) {
-	w.WriteString("[FIXME] " + msg) //nolint
-	log.Fatal(msg)
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "actual2csv")
+}
+
+// sameContents reports whether both files exist and hold identical bytes.
+func sameContents(a, b string) bool {
+	aData, err := os.ReadFile(a)
+	if err != nil {
+		return false
+	}
+	bData, err := os.ReadFile(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aData, bData)
+}
+
+// listFlag is a flag taking comma-separated values, which may also be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
 }
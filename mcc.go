@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// merchantTypes names the merchant category codes (ISO 18245) the built-in
+// merchant table uses, plus common ones for MERCHANT_CATEGORIES rules.
+var merchantTypes = map[string]string{
+	"4111": "Commuter Transport",
+	"4121": "Taxis and Rideshare",
+	"4511": "Airlines",
+	"4814": "Telecommunication Services",
+	"4899": "Cable and Streaming Services",
+	"4900": "Utilities",
+	"5200": "Home Supply Warehouse Stores",
+	"5300": "Wholesale Clubs",
+	"5310": "Discount Stores",
+	"5411": "Grocery Stores and Supermarkets",
+	"5541": "Service Stations",
+	"5542": "Automated Fuel Dispensers",
+	"5651": "Family Clothing Stores",
+	"5732": "Electronics Stores",
+	"5812": "Restaurants",
+	"5814": "Fast Food Restaurants",
+	"5815": "Digital Goods: Media",
+	"5816": "Digital Goods: Games",
+	"5912": "Drug Stores and Pharmacies",
+	"5942": "Book Stores",
+	"5999": "Miscellaneous Retail",
+	"7011": "Lodging",
+	"7832": "Motion Picture Theaters",
+	"7997": "Clubs and Gyms",
+	"8011": "Doctors",
+	"8021": "Dentists",
+	"8099": "Health Practitioners",
+}
+
+// builtinMerchants maps well-known merchants to their usual merchant
+// category code, checked after MERCHANT_CATEGORIES rules.
+var builtinMerchants = []merchantRule{
+	{"5411", "", regexp.MustCompile(`(?i)whole foods|trader joe|safeway|kroger|aldi|lidl|publix|wegmans|albertsons|h-e-b|sprouts|tesco|sainsbury|rewe|edeka`)},
+	{"5300", "", regexp.MustCompile(`(?i)costco|sam'?s club|bj'?s wholesale`)},
+	{"5310", "", regexp.MustCompile(`(?i)walmart|target|dollar general|dollar tree`)},
+	{"5200", "", regexp.MustCompile(`(?i)home depot|lowe'?s|menards|ikea`)},
+	{"5541", "", regexp.MustCompile(`(?i)\b(shell|chevron|exxon|mobil|bp|texaco|sunoco|arco|valero|76)\b`)},
+	{"5814", "", regexp.MustCompile(`(?i)mcdonald|starbucks|dunkin|chipotle|subway|taco bell|burger king|wendy'?s|chick-fil-a|kfc|domino'?s|pizza hut`)},
+	{"5812", "", regexp.MustCompile(`(?i)doordash|grubhub|uber ?eats|deliveroo|restaurant|bistro|grill`)},
+	{"4121", "", regexp.MustCompile(`(?i)\buber\b|lyft|taxi|bolt\.eu`)},
+	{"4111", "", regexp.MustCompile(`(?i)\bmta\b|clipper|ventra|\bbart\b|oyster|transit`)},
+	{"4511", "", regexp.MustCompile(`(?i)airlines?|delta air|united air|southwest|jetblue|ryanair|easyjet|lufthansa`)},
+	{"7011", "", regexp.MustCompile(`(?i)marriott|hilton|hyatt|holiday inn|airbnb|booking\.com|hotel`)},
+	{"5815", "", regexp.MustCompile(`(?i)netflix|spotify|hulu|disney\+|hbo ?max|audible|kindle|apple\.com/bill|google \*?play`)},
+	{"5816", "", regexp.MustCompile(`(?i)steam(games|powered)?|playstation|xbox|nintendo`)},
+	{"4814", "", regexp.MustCompile(`(?i)verizon|at&t|t-mobile|vodafone|sprint|mint mobile`)},
+	{"4899", "", regexp.MustCompile(`(?i)comcast|xfinity|spectrum|cox comm|dish network|directv`)},
+	{"4900", "", regexp.MustCompile(`(?i)electric|\bgas (co|company)\b|water (dept|utility)|pg&e|con ?ed|duke energy`)},
+	{"5912", "", regexp.MustCompile(`(?i)\bcvs\b|walgreens|rite aid|pharmacy|boots`)},
+	{"5732", "", regexp.MustCompile(`(?i)best buy|apple store|micro center|b&h photo`)},
+	{"5942", "", regexp.MustCompile(`(?i)barnes|books`)},
+	{"5651", "", regexp.MustCompile(`(?i)\bgap\b|old navy|h&m|uniqlo|zara|primark`)},
+	{"7832", "", regexp.MustCompile(`(?i)\bamc\b|regal|cinemark|cinema`)},
+	{"7997", "", regexp.MustCompile(`(?i)planet fitness|equinox|24 hour fitness|\bgym\b|ymca`)},
+	{"5999", "", regexp.MustCompile(`(?i)amazon|amzn|etsy|ebay`)},
+}
+
+// MerchantCategories maps payees to merchant category codes (MCCs), for
+// analysis finer than Actual's categories. Rules from MERCHANT_CATEGORIES are
+// checked in order before the built-in table, against the payee and then the
+// payee as imported from the bank; a rule can name a code the built-in table
+// doesn't know:
+//
+//	MERCHANT_CATEGORIES=5411=(?i)corner market;5995:Pet Shops=(?i)petco|chewy
+type MerchantCategories struct {
+	rules []merchantRule
+}
+
+type merchantRule struct {
+	mcc          string
+	merchantType string
+	pattern      *regexp.Regexp
+}
+
+var mccPattern = regexp.MustCompile(`^\d{4}$`)
+
+func parseMerchantCategories(s string) (*MerchantCategories, error) {
+	m := &MerchantCategories{}
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		code, expr, ok := strings.Cut(entry, "=")
+		code, merchantType, _ := strings.Cut(strings.TrimSpace(code), ":")
+		if !ok || !mccPattern.MatchString(code) {
+			return nil, fmt.Errorf("invalid MERCHANT_CATEGORIES entry %q: expected mcc[:type]=regexp with a four digit mcc", entry)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MERCHANT_CATEGORIES pattern for %s: %w", code, err)
+		}
+		m.rules = append(m.rules, merchantRule{mcc: code, merchantType: strings.TrimSpace(merchantType), pattern: pattern})
+	}
+	m.rules = append(m.rules, builtinMerchants...)
+	return m, nil
+}
+
+// Lookup returns the merchant category code and type of a transaction's
+// payee, or "" for both when no rule matches.
+func (m *MerchantCategories) Lookup(payeeName string, txn Transaction) (mcc, merchantType string) {
+	names := []string{payeeName}
+	if txn.ImportedPayee != nil {
+		names = append(names, *txn.ImportedPayee)
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, rule := range m.rules {
+			if rule.pattern.MatchString(name) {
+				if rule.merchantType != "" {
+					return rule.mcc, rule.merchantType
+				}
+				return rule.mcc, merchantTypes[rule.mcc]
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+)
+
+// messageCatalogs hold report text per -lang. English is the fallback for
+// languages and keys without a translation.
+var messageCatalogs = map[string]messages{
+	"en": {
+		"summary.none":          "Summary for %s: no transactions.",
+		"summary.totals":        "Summary for %s: %d transactions, %s in, %s out, %s.",
+		"summary.saving":        "saving %s",
+		"summary.overspending":  "overspending by %s",
+		"summary.even":          "breaking even",
+		"summary.top":           "Top categories: %s.",
+		"summary.biggest":       "Biggest expenses: %s.",
+		"summary.expense":       "%s to %s on %s from %s",
+		"digest.subject":        "Digest for %s to %s",
+		"digest.none":           "No transactions.",
+		"digest.totals":         "%d transactions, %s in, %s out.",
+		"digest.new_payees":     "New payees: %s.",
+		"digest.overspent":      "Overspent categories this month: %s.",
+		"digest.overspent_item": "%s by %s",
+		"alert.subject":         "%[1]d categories over their monthly limit in %[2]s %[3]d",
+		"alert.item":            "%s: %s spent of %s",
+		"list.and":              "and",
+		"chart.title":           "Spending by category, %s",
+		"chart.other":           "Other",
+		"date.long":             "%[2]s %[1]d, %[3]d",
+		"month.1":               "January",
+		"month.2":               "February",
+		"month.3":               "March",
+		"month.4":               "April",
+		"month.5":               "May",
+		"month.6":               "June",
+		"month.7":               "July",
+		"month.8":               "August",
+		"month.9":               "September",
+		"month.10":              "October",
+		"month.11":              "November",
+		"month.12":              "December",
+	},
+	"de": {
+		"summary.none":          "Zusammenfassung für %s: keine Buchungen.",
+		"summary.totals":        "Zusammenfassung für %s: %d Buchungen, %s Einnahmen, %s Ausgaben, %s.",
+		"summary.saving":        "%s gespart",
+		"summary.overspending":  "%s zu viel ausgegeben",
+		"summary.even":          "ausgeglichen",
+		"summary.top":           "Größte Kategorien: %s.",
+		"summary.biggest":       "Größte Ausgaben: %s.",
+		"summary.expense":       "%s an %s am %s von %s",
+		"digest.subject":        "Übersicht vom %s bis %s",
+		"digest.none":           "Keine Buchungen.",
+		"digest.totals":         "%d Buchungen, %s Einnahmen, %s Ausgaben.",
+		"digest.new_payees":     "Neue Empfänger: %s.",
+		"digest.overspent":      "Überzogene Kategorien in diesem Monat: %s.",
+		"digest.overspent_item": "%s um %s",
+		"alert.subject":         "%[1]d Kategorien über ihrem Monatslimit im %[2]s %[3]d",
+		"alert.item":            "%s: %s von %s ausgegeben",
+		"list.and":              "und",
+		"chart.title":           "Ausgaben nach Kategorie, %s",
+		"chart.other":           "Sonstiges",
+		"date.long":             "%[1]d. %[2]s %[3]d",
+		"month.1":               "Januar",
+		"month.2":               "Februar",
+		"month.3":               "März",
+		"month.4":               "April",
+		"month.5":               "Mai",
+		"month.6":               "Juni",
+		"month.7":               "Juli",
+		"month.8":               "August",
+		"month.9":               "September",
+		"month.10":              "Oktober",
+		"month.11":              "November",
+		"month.12":              "Dezember",
+	},
+	"fr": {
+		"summary.none":          "Résumé pour %s : aucune transaction.",
+		"summary.totals":        "Résumé pour %s : %d transactions, %s de recettes, %s de dépenses, %s.",
+		"summary.saving":        "%s épargnés",
+		"summary.overspending":  "%s de dépassement",
+		"summary.even":          "à l'équilibre",
+		"summary.top":           "Principales catégories : %s.",
+		"summary.biggest":       "Plus grosses dépenses : %s.",
+		"summary.expense":       "%s à %s le %s depuis %s",
+		"digest.subject":        "Récapitulatif du %s au %s",
+		"digest.none":           "Aucune transaction.",
+		"digest.totals":         "%d transactions, %s de recettes, %s de dépenses.",
+		"digest.new_payees":     "Nouveaux bénéficiaires : %s.",
+		"digest.overspent":      "Catégories dépassées ce mois-ci : %s.",
+		"digest.overspent_item": "%s de %s",
+		"alert.subject":         "%[1]d catégories au-dessus de leur limite mensuelle en %[2]s %[3]d",
+		"alert.item":            "%s : %s dépensés sur %s",
+		"list.and":              "et",
+		"chart.title":           "Dépenses par catégorie, %s",
+		"chart.other":           "Autres",
+		"date.long":             "%[1]d %[2]s %[3]d",
+		"month.1":               "janvier",
+		"month.2":               "février",
+		"month.3":               "mars",
+		"month.4":               "avril",
+		"month.5":               "mai",
+		"month.6":               "juin",
+		"month.7":               "juillet",
+		"month.8":               "août",
+		"month.9":               "septembre",
+		"month.10":              "octobre",
+		"month.11":              "novembre",
+		"month.12":              "décembre",
+	},
+	"es": {
+		"summary.none":          "Resumen de %s: sin transacciones.",
+		"summary.totals":        "Resumen de %s: %d transacciones, %s de ingresos, %s de gastos, %s.",
+		"summary.saving":        "%s ahorrados",
+		"summary.overspending":  "%s de exceso de gasto",
+		"summary.even":          "sin saldo",
+		"summary.top":           "Categorías principales: %s.",
+		"summary.biggest":       "Mayores gastos: %s.",
+		"summary.expense":       "%s a %s el %s desde %s",
+		"digest.subject":        "Resumen del %s al %s",
+		"digest.none":           "Sin transacciones.",
+		"digest.totals":         "%d transacciones, %s de ingresos, %s de gastos.",
+		"digest.new_payees":     "Nuevos beneficiarios: %s.",
+		"digest.overspent":      "Categorías excedidas este mes: %s.",
+		"digest.overspent_item": "%s por %s",
+		"alert.subject":         "%[1]d categorías por encima de su límite mensual en %[2]s de %[3]d",
+		"alert.item":            "%s: %s gastados de %s",
+		"list.and":              "y",
+		"chart.title":           "Gastos por categoría, %s",
+		"chart.other":           "Otros",
+		"date.long":             "%[1]d de %[2]s de %[3]d",
+		"month.1":               "enero",
+		"month.2":               "febrero",
+		"month.3":               "marzo",
+		"month.4":               "abril",
+		"month.5":               "mayo",
+		"month.6":               "junio",
+		"month.7":               "julio",
+		"month.8":               "agosto",
+		"month.9":               "septiembre",
+		"month.10":              "octubre",
+		"month.11":              "noviembre",
+		"month.12":              "diciembre",
+	},
+}
+
+// messages is a catalog of report text keyed by message ID.
+type messages map[string]string
+
+// catalog returns the messages for lang.
+func catalog(lang string) (messages, error) {
+	m, ok := messageCatalogs[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q", lang)
+	}
+	return m, nil
+}
+
+// Sprintf formats the message with the given key, falling back to English.
+func (m messages) Sprintf(key string, args ...any) string {
+	format, ok := m[key]
+	if !ok {
+		format = messageCatalogs["en"][key]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Date spells out a date, e.g. "January 5, 2024".
+func (m messages) Date(date Date) string {
+	month := m.Sprintf(fmt.Sprintf("month.%d", date.Month()))
+	return m.Sprintf("date.long", date.Day(), month, date.Year())
+}
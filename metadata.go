@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccountMetadata holds user-defined key/value pairs per account, keyed by
+// account name or ID. It is parsed from ACCOUNT_METADATA, e.g.
+//
+//	ACCOUNT_METADATA=Checking:owner=alice,bank=Chase;Visa:owner=bob
+type AccountMetadata map[string]map[string]string
+
+func parseAccountMetadata(s string) (AccountMetadata, error) {
+	meta := make(AccountMetadata)
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		account, pairs, ok := strings.Cut(entry, ":")
+		account = strings.TrimSpace(account)
+		if !ok || account == "" {
+			return nil, fmt.Errorf("invalid ACCOUNT_METADATA entry %q: expected account:key=value,...", entry)
+		}
+		kv, err := parseKeyValues(pairs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ACCOUNT_METADATA entry %q: %w", entry, err)
+		}
+		meta[account] = kv
+	}
+	return meta, nil
+}
+
+// For returns the metadata configured for acct by ID, falling back to name.
+func (m AccountMetadata) For(acct Account) map[string]string {
+	if kv, ok := m[acct.ID]; ok {
+		return kv
+	}
+	return m[acct.Name]
+}
+
+// Matches reports whether acct has every key/value pair in filter.
+func (m AccountMetadata) Matches(acct Account, filter map[string]string) bool {
+	kv := m.For(acct)
+	for k, v := range filter {
+		if kv[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// IsLiability reports whether acct is marked type=liability or type=credit,
+// e.g. a credit card.
+func (m AccountMetadata) IsLiability(acct Account) bool {
+	t := m.For(acct)["type"]
+	return t == "liability" || t == "credit"
+}
+
+// parseKeyValues parses "k1=v1,k2=v2".
+func parseKeyValues(s string) (map[string]string, error) {
+	kv := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		kv[k] = strings.TrimSpace(v)
+	}
+	return kv, nil
+}
+
+// splitList parses a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
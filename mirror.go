@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mirrorSink is a cloud storage service the output directory is mirrored to.
+type mirrorSink interface {
+	// Put creates or replaces the file at a slash-separated path, keeping
+	// the file's sharing and revision history when it already exists.
+	Put(path string, content []byte) error
+}
+
+// mirrorAttempts is how often a request to a sink is tried before the sync
+// gives up; failed requests are retried after mirrorBackoff, doubling it each
+// time.
+const (
+	mirrorAttempts = 4
+	mirrorBackoff  = time.Second
+)
+
+// mirrorChunkSize is the size of the pieces files larger than it are uploaded
+// in, through the services' resumable upload sessions, so a dropped
+// connection costs a piece rather than the file. OneDrive requires multiples
+// of 320 KiB.
+const mirrorChunkSize = 10 * 320 << 10
+
+// mirrorTarget is a configured mirrorSink and the folder exports go into.
+type mirrorTarget struct {
+	name   string // drive, dropbox or onedrive
+	folder string
+	open   func() mirrorSink
+}
+
+// mirrorTargets returns the sinks enabled by GDRIVE_FOLDER, DROPBOX_FOLDER
+// and ONEDRIVE_FOLDER.
+func mirrorTargets(cfg Config) []mirrorTarget {
+	var targets []mirrorTarget
+	if cfg.DriveFolder != "" {
+		targets = append(targets, mirrorTarget{"drive", cfg.DriveFolder, func() mirrorSink { return newDriveClient(cfg) }})
+	}
+	if cfg.DropboxFolder != "" {
+		targets = append(targets, mirrorTarget{"dropbox", cfg.DropboxFolder, func() mirrorSink { return newDropboxClient(cfg) }})
+	}
+	if cfg.OneDriveFolder != "" {
+		targets = append(targets, mirrorTarget{"onedrive", cfg.OneDriveFolder, func() mirrorSink { return newOneDriveClient(cfg) }})
+	}
+	return targets
+}
+
+// runMirror runs "actual2csv drive|dropbox|onedrive sync", which mirrors the
+// output directory on demand and authorizes actual2csv on first use.
+func runMirror(service string, args []string) {
+	if len(args) == 0 || args[0] != "sync" {
+		fmt.Fprintf(os.Stderr, "usage: actual2csv %s sync [-cfg configFilePath]\n", service)
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet(service+" sync", flag.ExitOnError)
+	var cfgFlag configFlags
+	cfgFlag.register(fs)
+	fs.Parse(args[1:]) //nolint
+
+	cfg := loadConfig(cfgFlag)
+	for _, target := range mirrorTargets(cfg) {
+		if target.name == service {
+			if err := syncMirror(cfg, target); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	log.Fatalf("%s_FOLDER is not set", map[string]string{"drive": "GDRIVE", "dropbox": "DROPBOX", "onedrive": "ONEDRIVE"}[service])
+}
+
+// syncMirrors mirrors the output directory to every configured sink after an
+// export. Failures are warnings, since the export itself succeeded.
+func syncMirrors(cfg Config) {
+	for _, target := range mirrorTargets(cfg) {
+		if err := syncMirror(cfg, target); err != nil {
+			slog.Warn("Failed to mirror exports", "sink", target.name, "err", err)
+		}
+	}
+}
+
+// mirrorState records the checksum of each file last uploaded to a sink, so
+// unchanged files are skipped.
+type mirrorState struct {
+	Folder string            `json:"folder"`
+	Files  map[string]string `json:"files"` // remote path -> MD5
+}
+
+// syncMirror uploads the exports in the output directory, with their sidecar
+// files, that changed since the last sync into target's folder. Layouts that
+// already nest exports in directories are mirrored as-is; flat exports go
+// into a folder for the year they start in.
+func syncMirror(cfg Config, target mirrorTarget) (err error) {
+	statePath := filepath.Join(cfg.TransactionOutputDir, target.name+".state.json")
+	state := mirrorState{Folder: target.folder}
+	data, err := os.ReadFile(statePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading %s state: %w", target.name, err)
+	}
+	if err == nil {
+		// a different folder or an unreadable state starts over, which only
+		// costs uploading every file again
+		var saved mirrorState
+		if json.Unmarshal(data, &saved) == nil && saved.Folder == state.Folder {
+			state = saved
+		}
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]string)
+	}
+	// save progress even if a later upload fails
+	defer func() {
+		data, saveErr := json.Marshal(state)
+		if saveErr == nil {
+			saveErr = os.WriteFile(statePath+".tmp", data, 0o644)
+		}
+		if saveErr == nil {
+			saveErr = os.Rename(statePath+".tmp", statePath)
+		}
+		if saveErr != nil && err == nil {
+			err = fmt.Errorf("writing %s state: %w", target.name, saveErr)
+		}
+	}()
+
+	var sink mirrorSink
+	startedAt := time.Now()
+	var uploaded int
+	err = filepath.WalkDir(cfg.TransactionOutputDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(cfg.TransactionOutputDir, file)
+		if err != nil {
+			return err
+		}
+		remote, ok := mirrorPath(cfg.OutputLayout, rel)
+		if !ok {
+			return nil
+		}
+		remote = path.Join(strings.Trim(target.folder, "/"), remote)
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(content)
+		checksum := hex.EncodeToString(sum[:])
+		if state.Files[remote] == checksum {
+			return nil
+		}
+		// only authenticate when there's something to upload
+		if sink == nil {
+			sink = target.open()
+		}
+		if err := sink.Put(remote, content); err != nil {
+			return err
+		}
+		state.Files[remote] = checksum
+		uploaded++
+		slog.Debug("Uploaded file", "sink", target.name, "path", remote)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("mirroring to %s: %w", target.name, err)
+	}
+	slog.Info("Mirrored exports", "sink", target.name, "folder", target.folder, "uploaded", uploaded, "duration", time.Since(startedAt))
+	return nil
+}
+
+// mirrorPath returns the path rel is mirrored to, or false if rel isn't part
+// of a finished export.
+func mirrorPath(layout outputLayout, rel string) (string, bool) {
+	monthRange, _, _, ok := layout.Match(rel)
+	if !ok || inProgress(rel) {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.Contains(rel, "/") {
+		return rel, true
+	}
+	from, _, err := parseMonthRange(monthRange)
+	if err != nil {
+		return "", false
+	}
+	return from.Format("2006") + "/" + rel, true
+}
+
+func mirrorContentType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// mirrorStatusError is a sink's answer with an unexpected status code.
+type mirrorStatusError struct {
+	code int
+}
+
+func (e mirrorStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
+
+// mirrorRetry calls attempt until it succeeds or has failed mirrorAttempts
+// times. Answers other than rate limiting and server errors aren't retried,
+// since another try gets the same answer.
+func mirrorRetry(what string, attempt func() error) error {
+	backoff := mirrorBackoff
+	for i := 1; ; i++ {
+		err := attempt()
+		var status mirrorStatusError
+		if err == nil || i == mirrorAttempts || errors.As(err, &status) && status.code != http.StatusTooManyRequests && status.code < 500 {
+			return err
+		}
+		slog.Warn("Mirror request failed, retrying", "path", what, "attempt", i, "err", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// mirrorRequest sends req with mirrorRetry and decodes the JSON answer into
+// out unless it's nil, returning the answer's header.
+func mirrorRequest(client *http.Client, req *http.Request, out any) (http.Header, error) {
+	req.Header.Set("User-Agent", userAgent())
+	var header http.Header
+	err := mirrorRetry(req.URL.Path, func() error {
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			req.Body = body
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close() //nolint
+		if resp.StatusCode/100 != 2 {
+			return mirrorStatusError{resp.StatusCode}
+		}
+		header = resp.Header
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	})
+	return header, err
+}
+
+// resumableUpload uploads size bytes through a resumable upload session in
+// mirrorChunkSize pieces, retrying failed pieces. send uploads the piece at
+// offset and returns the offset the session wants next, size once it has the
+// whole file. Before retrying a piece resume asks the session which offset
+// that is, as the failed piece may have arrived; without resume the piece is
+// sent again.
+func resumableUpload(name string, size int, send func(offset int) (int, error), resume func() (int, error)) error {
+	for offset := 0; offset < size; {
+		retrying := false
+		err := mirrorRetry(name, func() error {
+			from := offset
+			if retrying && resume != nil {
+				var err error
+				if from, err = resume(); err != nil {
+					return err
+				}
+			}
+			retrying = true
+			if from >= size {
+				offset = from
+				return nil
+			}
+			next, err := send(from)
+			if err != nil {
+				return err
+			}
+			if next <= from {
+				return fmt.Errorf("upload session stuck at byte %d", from)
+			}
+			offset = next
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("uploading %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkUploaded compares what a sink reports storing with content.
+func checkUploaded(name string, content []byte, size int64, checksum, want string) error {
+	if size != int64(len(content)) {
+		return fmt.Errorf("verifying %s: uploaded %d bytes but %d arrived", name, len(content), size)
+	}
+	if checksum != want {
+		return fmt.Errorf("verifying %s: checksum %s doesn't match the file's %s", name, checksum, want)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+// Budget data as returned by actual-http-api.
+// https://actualbudget.org/docs/api/reference
+//
+// Fields the API may send as null or leave out are pointers (or omitempty
+// slices), so a missing value is distinguishable from an empty one.
+
+type Account struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	OffBudget bool   `json:"offbudget"`
+	Closed    bool   `json:"closed"`
+}
+
+type Transaction struct {
+	ID         string `json:"id"`
+	AccountID  string `json:"account"`
+	CategoryID string `json:"category"`
+	Amount     Money  `json:"amount"`
+	PayeeID    string `json:"payee"`
+	Notes      string `json:"notes"`
+	Date       Date   `json:"date"`
+	// ImportedPayee is the payee as it appeared in the bank import.
+	ImportedPayee *string `json:"imported_payee,omitempty"`
+	// ImportedID is the bank's ID for imported transactions, used to dedupe imports.
+	ImportedID *string `json:"imported_id,omitempty"`
+	Cleared    bool    `json:"cleared"`
+	Reconciled bool    `json:"reconciled"`
+	// TransferID links the two sides of a transfer between accounts.
+	TransferID *string `json:"transfer_id,omitempty"`
+	// IsParent is set on split transactions, whose parts are in Subtransactions.
+	IsParent        bool          `json:"is_parent,omitempty"`
+	IsChild         bool          `json:"is_child,omitempty"`
+	ParentID        *string       `json:"parent_id,omitempty"`
+	Subtransactions []Transaction `json:"subtransactions,omitempty"`
+	// StartingBalanceFlag marks the transaction holding an account's starting balance.
+	StartingBalanceFlag bool    `json:"starting_balance_flag,omitempty"`
+	Schedule            *string `json:"schedule,omitempty"`
+	SortOrder           *int64  `json:"sort_order,omitempty"`
+	Tombstone           bool    `json:"tombstone,omitempty"`
+	// Error is set by Actual for inconsistent transactions, e.g. splits that don't add up.
+	Error *TransactionError `json:"error,omitempty"`
+}
+
+type TransactionError struct {
+	Type       string `json:"type"`
+	Difference Money  `json:"difference"`
+}
+
+type Category struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	IsIncome bool   `json:"is_income"`
+	Hidden   bool   `json:"hidden,omitempty"`
+	GroupID  string `json:"group_id"`
+}
+
+type CategoryGroup struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	IsIncome   bool       `json:"is_income"`
+	Hidden     bool       `json:"hidden,omitempty"`
+	Categories []Category `json:"categories"`
+}
+
+type Payee struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// TransferAccount is set on the payees Actual creates for transfers to an account.
+	TransferAccount string `json:"transfer_acct,omitempty"`
+}
+
+type Budget struct {
+	Name        string `json:"name"`
+	CloudFileID string `json:"cloudFileId"`
+	GroupID     string `json:"groupId"` // the budget's sync ID
+}
+
+// Schedule is a scheduled transaction. Date is either a single day or a
+// recurrence; NextDate is the next day it's due.
+type Schedule struct {
+	ID        string         `json:"id"`
+	Name      *string        `json:"name"`
+	NextDate  Date           `json:"next_date"`
+	Completed bool           `json:"completed"`
+	PayeeID   *string        `json:"payee"`
+	AccountID *string        `json:"account"`
+	Amount    ScheduleAmount `json:"amount"`
+	Date      ScheduleDate   `json:"date"`
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in minor units (cents) of a currency. Actual budgets
+// have a single currency, so an empty Currency means the budget's own.
+// Money is encoded in JSON as a plain number of cents, as the API sends it.
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+// Add returns m + o, keeping whichever currency is set.
+func (m Money) Add(o Money) Money {
+	if m.Currency == "" {
+		m.Currency = o.Currency
+	}
+	m.Cents += o.Cents
+	return m
+}
+
+// Sub returns m - o.
+func (m Money) Sub(o Money) Money {
+	return m.Add(o.Neg())
+}
+
+func (m Money) Neg() Money {
+	m.Cents = -m.Cents
+	return m
+}
+
+func (m Money) Abs() Money {
+	if m.Cents < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Sign returns -1, 0 or +1 depending on whether m is negative, zero or positive.
+func (m Money) Sign() int {
+	switch {
+	case m.Cents < 0:
+		return -1
+	case m.Cents > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// String formats m as a decimal amount such as "-12.34", without currency.
+func (m Money) String() string {
+	sign := ""
+	abs := m.Cents
+	if abs < 0 {
+		sign, abs = "-", -abs
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.Cents, 10)), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var cents int64
+	if err := json.Unmarshal(data, &cents); err != nil {
+		return fmt.Errorf("decoding amount: %w", err)
+	}
+	m.Cents = cents
+	return nil
+}
+
+// ParseMoney parses a decimal amount such as "-12.34" or "12".
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimLeft(s, "+-"), ".")
+	if whole == "" && frac == "" || len(frac) > 2 {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	var cents int64
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return Money{}, fmt.Errorf("invalid amount %q", s)
+		}
+		cents = cents*10 + int64(c-'0')
+	}
+	if neg {
+		cents = -cents
+	}
+	return Money{Cents: cents}, nil
+}
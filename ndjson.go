@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ndjsonWriter backs -format ndjson: one EnrichedTransaction per line, for log
+// shippers such as Vector or Elasticsearch bulk loaders. Each transaction is
+// written as soon as the export has checked it, with nothing held in memory.
+type ndjsonWriter struct {
+	enc         *json.Encoder
+	categoryMap map[string]Category
+	payeeMap    map[string]Payee
+}
+
+func NewNDJSONWriter(w io.Writer, categories map[string]Category, payeeMap map[string]Payee) TransactionWriter {
+	return &ndjsonWriter{enc: json.NewEncoder(w), categoryMap: categories, payeeMap: payeeMap}
+}
+
+func (w *ndjsonWriter) WriteHeader() error { return nil }
+
+func (w *ndjsonWriter) WriteTransaction(acct Account, txn Transaction) error {
+	return w.enc.Encode(enrichTransaction(acct, txn, w.categoryMap, w.payeeMap))
+}
+
+// Add does nothing; the transactions were streamed by WriteTransaction.
+func (w *ndjsonWriter) Add(Account, []Transaction) error { return nil }
+
+func (w *ndjsonWriter) WritePlaceholder(date Date, note string) error {
+	return w.enc.Encode(EnrichedTransaction{Date: date, Notes: note})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sanitizeNotes replaces control and other non-printable characters (including
+// newlines and invalid UTF-8) with spaces and collapses runs of whitespace, so
+// blobs pasted into notes can't break line-oriented importers.
+func sanitizeNotes(notes string) string {
+	var b strings.Builder
+	b.Grow(len(notes))
+	space := false
+	for i, r := range notes {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(notes[i:]); size <= 1 {
+				r = ' '
+			}
+		}
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// truncateNotes caps notes at max runes, marking the cut with an ellipsis.
+// max <= 0 means no limit.
+func truncateNotes(notes string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(notes) <= max {
+		return notes
+	}
+	runes := []rune(notes)
+	if max == 1 {
+		return "…"
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// NotePatterns extract structured fields that users encode in notes, such as
+// invoice numbers or project codes, into columns named after the patterns'
+// named groups. They are parsed from NOTE_PATTERNS, separated by ;, e.g.
+//
+//	NOTE_PATTERNS=(?i)inv(?:oice)?[ #-]*(?P<invoice>\d+);\[(?P<project>[A-Z]+-\d+)\]
+//
+// Patterns may share a group name to accept several spellings of a field;
+// the first pattern that matches fills it.
+type NotePatterns []*regexp.Regexp
+
+func parseNotePatterns(s string) (NotePatterns, error) {
+	var patterns NotePatterns
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		re, err := regexp.Compile(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, fmt.Errorf("invalid NOTE_PATTERNS entry %q: %w", entry, err)
+		}
+		if !slices.ContainsFunc(re.SubexpNames(), func(name string) bool { return name != "" }) {
+			return nil, fmt.Errorf("NOTE_PATTERNS entry %q has no named group like (?P<invoice>...)", entry)
+		}
+		patterns = append(patterns, re)
+	}
+	if len(patterns) > 0 {
+		for _, field := range patterns.Fields() {
+			if slices.Contains(columnNames(), field) {
+				return nil, fmt.Errorf("NOTE_PATTERNS group %q is already a column", field)
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// Fields returns the patterns' group names in order of first appearance.
+func (p NotePatterns) Fields() []string {
+	var fields []string
+	for _, re := range p {
+		for _, name := range re.SubexpNames() {
+			if name != "" && !slices.Contains(fields, name) {
+				fields = append(fields, name)
+			}
+		}
+	}
+	return fields
+}
+
+// Extract returns the fields found in notes, keyed by group name.
+func (p NotePatterns) Extract(notes string) map[string]string {
+	values := make(map[string]string)
+	for _, re := range p {
+		m := re.FindStringSubmatch(notes)
+		for i, name := range re.SubexpNames() {
+			if m == nil || name == "" || m[i] == "" {
+				continue
+			}
+			if _, ok := values[name]; !ok {
+				values[name] = m[i]
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Notifier delivers short messages such as digests to the user.
+type Notifier interface {
+	Notify(subject, text string) error
+}
+
+// NewNotifier returns the notifier for NOTIFY_URL. A secret (NOTIFY_SECRET)
+// signs each notification.
+func NewNotifier(rawURL, secret string) (Notifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NOTIFY_URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &webhookNotifier{url: rawURL, secret: secret, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported NOTIFY_URL scheme %q", u.Scheme)
+	}
+}
+
+// webhookNotifier posts {"subject": ..., "text": ...} as JSON, which Slack and
+// Mattermost incoming webhooks accept as-is. With a secret, requests carry
+// X-Timestamp and X-Nonce headers and an X-Signature-256 "sha256=<hex>" HMAC
+// of "<timestamp>.<nonce>.<body>", so receivers can verify the sender and
+// reject replays.
+type webhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(subject, text string) error {
+	body, err := json.Marshal(map[string]string{
+		"subject": subject,
+		"text":    subject + "\n" + text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	if n.secret != "" {
+		timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), rand.Text()
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Signature-256", "sha256="+notificationSignature(n.secret, timestamp, nonce, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending notification: %w", err)
+	}
+	defer resp.Body.Close() //nolint
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sending notification: unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notificationSignature is the hex HMAC-SHA256 of "<timestamp>.<nonce>.<body>".
+func notificationSignature(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
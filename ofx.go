@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ofxHeaders start an OFX document, by -ofx-version: 1 is the SGML format
+// (OFX 1.0.2) most desktop software imports, 2 is the XML one (OFX 2.2).
+var ofxHeaders = map[int]string{
+	1: "OFXHEADER:100\nDATA:OFXSGML\nVERSION:102\nSECURITY:NONE\nENCODING:UTF-8\nCHARSET:NONE\nCOMPRESSION:NONE\nOLDFILEUID:NONE\nNEWFILEUID:NONE\n\n",
+	2: "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n<?OFX OFXHEADER=\"200\" VERSION=\"220\" SECURITY=\"NONE\" OLDFILEUID=\"NONE\" NEWFILEUID=\"NONE\"?>\n",
+}
+
+// ofxNameMax is the longest NAME OFX allows; the rest of a payee goes to MEMO.
+const ofxNameMax = 32
+
+// ofxAcctIDMax is the longest ACCTID OFX allows.
+const ofxAcctIDMax = 22
+
+// ofxAcctID returns the ACCTID of an account: its acctid metadata, or its
+// Actual ID if short enough. Actual's IDs are 36-character UUIDs, which
+// strict importers reject, so longer ones are replaced by the start of their
+// SHA-256, which stays the same from one export to the next.
+func ofxAcctID(acct Account, meta map[string]string) string {
+	if meta["acctid"] != "" {
+		return meta["acctid"]
+	}
+	if len(acct.ID) <= ofxAcctIDMax {
+		return acct.ID
+	}
+	sum := sha256.Sum256([]byte(acct.ID))
+	return hex.EncodeToString(sum[:])[:ofxAcctIDMax]
+}
+
+// ofxWriter backs -format ofx: a statement per account, as a bank would
+// serve it for download, with the Actual transaction ID as each
+// transaction's FITID so importers skip transactions they've already seen.
+// Accounts marked type=credit or type=liability in ACCOUNT_METADATA get a
+// credit card statement; ACCOUNT_METADATA can also set the acctid, bankid,
+// accttype and currency OFX reports, which default to an ID derived from the
+// Actual account ID (see ofxAcctID), 000000000, CHECKING and USD.
+//
+// Each account's statement is a complete OFX document, opened by its first Add
+// and closed by its balance footer. They're written one after another and
+// split into a file per account once the export is done (see splitOFX).
+type ofxWriter struct {
+	w          *bufio.Writer
+	version    int
+	start, end Date
+	payeeMap   map[string]Payee
+	meta       AccountMetadata
+	exportedAt time.Time
+	open       string // ID of the account whose statement is open
+}
+
+// NewOFXWriter returns an OFX writer for statements from start to end. open
+// is the account whose statement a resumed export had started, if any.
+func NewOFXWriter(w io.Writer, version int, start, end Date, payeeMap map[string]Payee, meta AccountMetadata, exportedAt time.Time, open string) TransactionWriter {
+	return &ofxWriter{w: bufio.NewWriter(w), version: version, start: start, end: end, payeeMap: payeeMap, meta: meta, exportedAt: exportedAt, open: open}
+}
+
+// WriteHeader does nothing; every statement has its own.
+func (w *ofxWriter) WriteHeader() error { return nil }
+
+func (w *ofxWriter) Add(acct Account, txns []Transaction) error {
+	if acct.ID != w.open {
+		w.open = acct.ID
+		w.openStatement(acct)
+	}
+	for _, txn := range txns {
+		trnType := "DEBIT"
+		switch {
+		case txn.TransferID != nil:
+			trnType = "XFER"
+		case txn.Amount.Sign() > 0:
+			trnType = "CREDIT"
+		}
+		name := w.payeeMap[txn.PayeeID].Name
+		if name == "" && txn.ImportedPayee != nil {
+			name = *txn.ImportedPayee
+		}
+		memo := txn.Notes
+		if runes := []rune(name); len(runes) > ofxNameMax {
+			memo = strings.TrimSpace(name + " " + memo)
+			name = string(runes[:ofxNameMax])
+		}
+		w.w.WriteString("<STMTTRN>\n")
+		w.leaf("TRNTYPE", trnType)
+		w.leaf("DTPOSTED", w.date(txn.Date))
+		w.leaf("TRNAMT", txn.Amount.String())
+		w.leaf("FITID", txn.ID)
+		if name != "" {
+			w.leaf("NAME", name)
+		}
+		if memo != "" {
+			w.leaf("MEMO", memo)
+		}
+		w.w.WriteString("</STMTTRN>\n")
+	}
+	return w.w.Flush()
+}
+
+// WritePlaceholder does nothing: a statement without transactions is
+// already a valid one.
+func (w *ofxWriter) WritePlaceholder(Date, string) error { return nil }
+
+// WriteBalanceFooter closes acct's statement with its closing balance.
+func (w *ofxWriter) WriteBalanceFooter(acct Account, b BalanceSummary) error {
+	w.open = ""
+	w.w.WriteString("</BANKTRANLIST>\n<LEDGERBAL>\n")
+	w.leaf("BALAMT", b.Closing.String())
+	w.leaf("DTASOF", w.date(b.EndDate))
+	w.w.WriteString("</LEDGERBAL>\n")
+	if w.meta.IsLiability(acct) {
+		w.w.WriteString("</CCSTMTRS>\n</CCSTMTTRNRS>\n</CREDITCARDMSGSRSV1>\n</OFX>\n")
+	} else {
+		w.w.WriteString("</STMTRS>\n</STMTTRNRS>\n</BANKMSGSRSV1>\n</OFX>\n")
+	}
+	return w.w.Flush()
+}
+
+func (w *ofxWriter) openStatement(acct Account) {
+	meta := w.meta.For(acct)
+	w.w.WriteString(ofxHeaders[w.version])
+	w.w.WriteString("<OFX>\n<SIGNONMSGSRSV1>\n<SONRS>\n<STATUS>\n")
+	w.leaf("CODE", "0")
+	w.leaf("SEVERITY", "INFO")
+	w.w.WriteString("</STATUS>\n")
+	w.leaf("DTSERVER", w.exportedAt.UTC().Format("20060102150405"))
+	w.leaf("LANGUAGE", "ENG")
+	w.w.WriteString("</SONRS>\n</SIGNONMSGSRSV1>\n")
+	if w.meta.IsLiability(acct) {
+		w.w.WriteString("<CREDITCARDMSGSRSV1>\n<CCSTMTTRNRS>\n")
+	} else {
+		w.w.WriteString("<BANKMSGSRSV1>\n<STMTTRNRS>\n")
+	}
+	w.leaf("TRNUID", "0")
+	w.w.WriteString("<STATUS>\n")
+	w.leaf("CODE", "0")
+	w.leaf("SEVERITY", "INFO")
+	w.w.WriteString("</STATUS>\n")
+	if w.meta.IsLiability(acct) {
+		w.w.WriteString("<CCSTMTRS>\n")
+		w.leaf("CURDEF", cmp.Or(meta["currency"], "USD"))
+		w.w.WriteString("<CCACCTFROM>\n")
+		w.leaf("ACCTID", ofxAcctID(acct, meta))
+		w.w.WriteString("</CCACCTFROM>\n")
+	} else {
+		w.w.WriteString("<STMTRS>\n")
+		w.leaf("CURDEF", cmp.Or(meta["currency"], "USD"))
+		w.w.WriteString("<BANKACCTFROM>\n")
+		w.leaf("BANKID", cmp.Or(meta["bankid"], "000000000"))
+		w.leaf("ACCTID", ofxAcctID(acct, meta))
+		w.leaf("ACCTTYPE", cmp.Or(strings.ToUpper(meta["accttype"]), "CHECKING"))
+		w.w.WriteString("</BANKACCTFROM>\n")
+	}
+	w.w.WriteString("<BANKTRANLIST>\n")
+	w.leaf("DTSTART", w.date(w.start))
+	w.leaf("DTEND", w.date(w.end))
+}
+
+// leaf writes an element holding a value, which OFX 1 leaves unclosed.
+func (w *ofxWriter) leaf(name, value string) {
+	value = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\n", " ", "\r", "").Replace(value)
+	if w.version == 1 {
+		fmt.Fprintf(w.w, "<%s>%s\n", name, value)
+	} else {
+		fmt.Fprintf(w.w, "<%s>%s</%s>\n", name, value, name)
+	}
+}
+
+func (w *ofxWriter) date(d Date) string {
+	return d.Format("20060102")
+}
+
+var (
+	ofxAccountID = regexp.MustCompile(`<ACCTID>([^<\n]*)`)
+	fileUnsafe   = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+)
+
+// splitOFX splits the statements written by ofxWriter to path into a
+// {base}.{account}.ofx file per account, named after the account, and removes
+// path. Accounts whose names make the same file name get their ACCTID added,
+// as {base}.{account}.{acctid}.ofx.
+func splitOFX(path string, version int, accounts []Account, meta AccountMetadata) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	uses := make(map[string]int)
+	for _, acct := range accounts {
+		names[ofxAcctID(acct, meta.For(acct))] = fileSafe(acct.Name)
+		uses[fileSafe(acct.Name)]++
+	}
+	for id, name := range names {
+		if uses[name] > 1 {
+			names[id] = name + "." + fileSafe(id)
+		}
+	}
+	seen := make(map[string]bool)
+	header := ofxHeaders[version]
+	base := strings.TrimSuffix(path, ".ofx")
+	var written []string
+	for _, doc := range strings.SplitAfter(string(data), "</OFX>\n") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		if !strings.HasPrefix(doc, header) {
+			return written, fmt.Errorf("statement doesn't start with an OFX %d header", version)
+		}
+		m := ofxAccountID.FindStringSubmatch(doc)
+		if m == nil {
+			return written, fmt.Errorf("statement without an ACCTID")
+		}
+		out := fmt.Sprintf("%s.%s.ofx", base, cmp.Or(names[m[1]], fileSafe(m[1])))
+		if seen[out] {
+			return written, fmt.Errorf("two statements for ACCTID %s; give the accounts different acctid metadata", m[1])
+		}
+		seen[out] = true
+		if err := os.WriteFile(out, []byte(doc), 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, out)
+	}
+	sort.Strings(written)
+	return written, os.Remove(path)
+}
+
+// fileSafe makes an account name usable in a file name.
+func fileSafe(name string) string {
+	return strings.Trim(fileUnsafe.ReplaceAllString(name, "-"), "-.")
+}
+
+// resumedStatement returns the ID of the account whose statement a resumed
+// export left open: the one with some months done but not all.
+func resumedStatement(savepoint *Savepoint, accounts []Account, periods []period) string {
+	for _, acct := range accounts {
+		done := 0
+		for _, p := range periods {
+			if savepoint.IsDone(p.Month, acct.ID) {
+				done++
+			}
+		}
+		if done > 0 && done < len(periods) {
+			return acct.ID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authModeClientCredentials = "oidc-client-credentials"
+	authModeDevice            = "oidc-device"
+	// authModeCode is only used internally, for providers without a device flow.
+	authModeCode = "oauth-code"
+)
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+type oidcToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresIn    int       `json:"expires_in,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+func (t oidcToken) valid() bool {
+	// refresh a little early so a token doesn't expire mid-request
+	return t.AccessToken != "" && time.Now().Add(30*time.Second).Before(t.Expiry)
+}
+
+type tokenErrorResponse struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	Interval    int    `json:"interval"`
+}
+
+// oidcTokenSource obtains and refreshes bearer tokens for Actual servers
+// sitting behind an OIDC-aware proxy (Authelia, Authentik, ...).
+type oidcTokenSource struct {
+	cfg    Config
+	client *http.Client
+
+	// authParams are added to the code flow's authorization request.
+	authParams url.Values
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	token     oidcToken
+}
+
+func newOIDCTokenSource(cfg Config) *oidcTokenSource {
+	s := &oidcTokenSource{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	s.loadToken()
+	return s
+}
+
+// Token returns a valid access token, refreshing or re-authenticating as needed.
+func (s *oidcTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.valid() {
+		return s.token.AccessToken, nil
+	}
+	if err := s.discover(); err != nil {
+		return "", err
+	}
+
+	if s.token.RefreshToken != "" {
+		tok, err := s.requestToken(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {s.token.RefreshToken},
+		})
+		if err == nil {
+			s.setToken(tok)
+			return tok.AccessToken, nil
+		}
+		slog.Warn("Failed to refresh OIDC token, re-authenticating", "err", err)
+	}
+
+	var tok oidcToken
+	var err error
+	switch s.cfg.AuthMode {
+	case authModeClientCredentials:
+		tok, err = s.requestToken(url.Values{"grant_type": {"client_credentials"}})
+	case authModeDevice:
+		tok, err = s.deviceFlow()
+	case authModeCode:
+		tok, err = s.codeFlow()
+	default:
+		err = fmt.Errorf("unsupported AUTH_MODE %q", s.cfg.AuthMode)
+	}
+	if err != nil {
+		return "", err
+	}
+	s.setToken(tok)
+	return tok.AccessToken, nil
+}
+
+func (s *oidcTokenSource) discover() error {
+	if s.discovery != nil {
+		return nil
+	}
+	u := strings.TrimSuffix(s.cfg.OIDCIssuer, "/") + "/.well-known/openid-configuration"
+	resp, err := s.client.Get(u)
+	if err != nil {
+		return fmt.Errorf("fetching OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close() //nolint
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching OIDC discovery document: unexpected status code: %d", resp.StatusCode)
+	}
+	var d oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return fmt.Errorf("decoding OIDC discovery document: %w", err)
+	}
+	s.discovery = &d
+	return nil
+}
+
+// deviceFlow runs the OAuth 2.0 device authorization grant (RFC 8628),
+// prompting the user to approve the request in a browser.
+func (s *oidcTokenSource) deviceFlow() (oidcToken, error) {
+	if s.discovery.DeviceAuthorizationEndpoint == "" {
+		return oidcToken{}, errors.New("OIDC provider does not advertise a device_authorization_endpoint")
+	}
+	form := s.clientForm(url.Values{"scope": {s.scopes()}})
+	resp, err := s.client.PostForm(s.discovery.DeviceAuthorizationEndpoint, form)
+	if err != nil {
+		return oidcToken{}, fmt.Errorf("starting device authorization: %w", err)
+	}
+	defer resp.Body.Close() //nolint
+	if resp.StatusCode != http.StatusOK {
+		return oidcToken{}, fmt.Errorf("starting device authorization: unexpected status code: %d", resp.StatusCode)
+	}
+	var auth struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		VerificationURL         string `json:"verification_url"` // Google's name for verification_uri
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return oidcToken{}, fmt.Errorf("decoding device authorization: %w", err)
+	}
+
+	if auth.VerificationURI == "" {
+		auth.VerificationURI = auth.VerificationURL
+	}
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "To authorize actual2csv, visit %s\n", auth.VerificationURIComplete)
+	} else {
+		fmt.Fprintf(os.Stderr, "To authorize actual2csv, visit %s and enter code %s\n", auth.VerificationURI, auth.UserCode)
+	}
+
+	interval := time.Duration(max(auth.Interval, 5)) * time.Second
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for auth.ExpiresIn == 0 || time.Now().Before(deadline) {
+		time.Sleep(interval)
+		tok, err := s.requestToken(url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {auth.DeviceCode},
+		})
+		var tokErr *tokenErrorResponse
+		switch {
+		case err == nil:
+			return tok, nil
+		case errors.As(err, &tokErr) && tokErr.Code == "authorization_pending":
+			continue
+		case errors.As(err, &tokErr) && tokErr.Code == "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return oidcToken{}, err
+		}
+	}
+	return oidcToken{}, errors.New("device authorization expired before it was approved")
+}
+
+// codeFlow runs the OAuth 2.0 authorization code grant with PKCE (RFC 7636)
+// without a redirect: the user approves the request in a browser and pastes
+// the code the provider shows.
+func (s *oidcTokenSource) codeFlow() (oidcToken, error) {
+	if !isTerminal(os.Stdin) {
+		return oidcToken{}, errors.New("authorization needs a terminal to paste the code into")
+	}
+	b := make([]byte, 32)
+	rand.Read(b) //nolint
+	verifier := base64.RawURLEncoding.EncodeToString(b)
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"client_id":             {s.cfg.OIDCClientID},
+		"response_type":         {"code"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	for k, v := range s.authParams {
+		params[k] = v
+	}
+	fmt.Fprintf(os.Stderr, "To authorize actual2csv, visit %s?%s\nand paste the code shown: ", s.discovery.AuthorizationEndpoint, params.Encode())
+	var code string
+	if _, err := fmt.Fscanln(os.Stdin, &code); err != nil {
+		return oidcToken{}, fmt.Errorf("reading authorization code: %w", err)
+	}
+	return s.requestToken(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+	})
+}
+
+func (s *oidcTokenSource) requestToken(form url.Values) (oidcToken, error) {
+	resp, err := s.client.PostForm(s.discovery.TokenEndpoint, s.clientForm(form))
+	if err != nil {
+		return oidcToken{}, fmt.Errorf("requesting token: %w", err)
+	}
+	defer resp.Body.Close() //nolint
+
+	if resp.StatusCode != http.StatusOK {
+		var tokErr tokenErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&tokErr); err == nil && tokErr.Code != "" {
+			return oidcToken{}, &tokErr
+		}
+		return oidcToken{}, fmt.Errorf("requesting token: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var tok oidcToken
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return oidcToken{}, fmt.Errorf("decoding token: %w", err)
+	}
+	if tok.ExpiresIn == 0 {
+		tok.ExpiresIn = 300
+	}
+	tok.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return tok, nil
+}
+
+func (s *oidcTokenSource) clientForm(form url.Values) url.Values {
+	form.Set("client_id", s.cfg.OIDCClientID)
+	if s.cfg.OIDCClientSecret != "" {
+		form.Set("client_secret", s.cfg.OIDCClientSecret)
+	}
+	if form.Get("scope") == "" && form.Get("grant_type") == "client_credentials" {
+		form.Set("scope", s.scopes())
+	}
+	return form
+}
+
+func (s *oidcTokenSource) scopes() string {
+	if s.cfg.OIDCScopes != "" {
+		return s.cfg.OIDCScopes
+	}
+	return "openid offline_access"
+}
+
+func (s *oidcTokenSource) setToken(tok oidcToken) {
+	// providers may omit the refresh token on refresh; keep the previous one
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = s.token.RefreshToken
+	}
+	s.token = tok
+	s.saveToken()
+}
+
+// Tokens are cached so device-flow users aren't prompted on every run.
+func (s *oidcTokenSource) tokenPath() string {
+	if s.cfg.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(s.cfg.CacheDir, "oidc-token-"+s.cfg.OIDCClientID+".json")
+}
+
+func (s *oidcTokenSource) loadToken() {
+	path := s.tokenPath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &s.token) //nolint
+}
+
+func (s *oidcTokenSource) saveToken() {
+	path := s.tokenPath()
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(s.token)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		slog.Warn("Failed to cache OIDC token", "err", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		slog.Warn("Failed to cache OIDC token", "err", err)
+	}
+}
+
+func (e *tokenErrorResponse) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("token error: %s: %s", e.Code, e.Description)
+	}
+	return "token error: " + e.Code
+}
+
+// bearerTransport attaches an OIDC access token to every request.
+type bearerTransport struct {
+	base   http.RoundTripper
+	source *oidcTokenSource
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("obtaining OIDC token: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
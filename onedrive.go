@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	oneDriveAPIURL    = "https://graph.microsoft.com/v1.0"
+	oneDriveIssuerURL = "https://login.microsoftonline.com"
+)
+
+// oneDriveClient uploads files to OneDrive through Microsoft Graph,
+// authenticated with the OAuth device flow. Tokens are cached in CACHE_DIR
+// like OIDC tokens.
+type oneDriveClient struct {
+	client *http.Client
+	// upload sends pieces to upload sessions, whose URLs carry their own
+	// authorization and reject a token
+	upload *http.Client
+}
+
+func newOneDriveClient(cfg Config) *oneDriveClient {
+	auth := cfg
+	auth.AuthMode = authModeDevice
+	auth.OIDCIssuer = oneDriveIssuerURL + "/" + cfg.OneDriveTenant + "/v2.0"
+	auth.OIDCClientID = cfg.OneDriveClientID
+	auth.OIDCClientSecret = ""
+	auth.OIDCScopes = "Files.ReadWrite offline_access"
+	return &oneDriveClient{
+		client: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: &bearerTransport{base: http.DefaultTransport, source: newOIDCTokenSource(auth)},
+		},
+		upload: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// oneDriveItem is the part of a OneDrive item's metadata uploads check.
+type oneDriveItem struct {
+	Size int64 `json:"size"`
+}
+
+// Put uploads content to p under the drive's root, creating missing folders,
+// then checks OneDrive got all of it. Replacing an existing file keeps its ID
+// and version history.
+func (c *oneDriveClient) Put(p string, content []byte) error {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	item := oneDriveAPIURL + "/me/drive/root:/" + strings.Join(segments, "/")
+	var uploaded oneDriveItem
+	var err error
+	if len(content) > mirrorChunkSize {
+		uploaded, err = c.session(item, p, content)
+	} else {
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPut, item+":/content", bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", mirrorContentType(p))
+		if _, err = mirrorRequest(c.client, req, &uploaded); err != nil {
+			err = fmt.Errorf("uploading %s: %w", p, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// Graph's quickXorHash isn't worth computing for this; the size catches
+	// truncated uploads
+	return checkUploaded(p, content, uploaded.Size, "", "")
+}
+
+// session uploads content in pieces through an upload session for the item
+// at the Graph URL item.
+func (c *oneDriveClient) session(item, p string, content []byte) (oneDriveItem, error) {
+	body, _ := json.Marshal(map[string]any{"item": map[string]any{"@microsoft.graph.conflictBehavior": "replace"}})
+	req, err := http.NewRequest(http.MethodPost, item+":/createUploadSession", bytes.NewReader(body))
+	if err != nil {
+		return oneDriveItem{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var session struct {
+		UploadURL string `json:"uploadUrl"`
+	}
+	if _, err := mirrorRequest(c.client, req, &session); err != nil {
+		return oneDriveItem{}, fmt.Errorf("starting upload of %s: %w", p, err)
+	}
+
+	var uploaded oneDriveItem
+	// a piece is answered with 202 and the ranges still missing, the last one
+	// with the item; the session reports the missing ranges on GET
+	next := func(resp *http.Response) (int, error) {
+		var progress struct {
+			NextExpectedRanges []string `json:"nextExpectedRanges"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&progress); err != nil {
+			return 0, err
+		}
+		if len(progress.NextExpectedRanges) == 0 {
+			return 0, fmt.Errorf("upload session reported no missing ranges")
+		}
+		start, _, _ := strings.Cut(progress.NextExpectedRanges[0], "-")
+		return strconv.Atoi(start)
+	}
+	send := func(req *http.Request, complete int) (int, error) {
+		req.Header.Set("User-Agent", userAgent())
+		resp, err := c.upload.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close() //nolint
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusCreated:
+			if complete > 0 {
+				return complete, json.NewDecoder(resp.Body).Decode(&uploaded)
+			}
+			return next(resp)
+		case http.StatusAccepted:
+			return next(resp)
+		}
+		return 0, mirrorStatusError{resp.StatusCode}
+	}
+	err = resumableUpload(p, len(content), func(offset int) (int, error) {
+		end := min(offset+mirrorChunkSize, len(content))
+		req, err := http.NewRequest(http.MethodPut, session.UploadURL, bytes.NewReader(content[offset:end]))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end-1, len(content)))
+		return send(req, len(content))
+	}, func() (int, error) {
+		req, err := http.NewRequest(http.MethodGet, session.UploadURL, nil)
+		if err != nil {
+			return 0, err
+		}
+		return send(req, 0)
+	})
+	return uploaded, err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OwnerResolver attributes transactions to household members. Payee rules
+// from OWNER_PAYEE_RULES take precedence over the account's "owner" metadata:
+//
+//	OWNER_PAYEE_RULES=alice=(?i)starbucks|sephora;bob=(?i)home depot
+type OwnerResolver struct {
+	meta  AccountMetadata
+	rules []ownerRule
+}
+
+type ownerRule struct {
+	owner   string
+	pattern *regexp.Regexp
+}
+
+func NewOwnerResolver(meta AccountMetadata, payeeRules string) (*OwnerResolver, error) {
+	r := &OwnerResolver{meta: meta}
+	for _, entry := range strings.Split(payeeRules, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		owner, expr, ok := strings.Cut(entry, "=")
+		owner = strings.TrimSpace(owner)
+		if !ok || owner == "" {
+			return nil, fmt.Errorf("invalid OWNER_PAYEE_RULES entry %q: expected owner=regexp", entry)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OWNER_PAYEE_RULES pattern for %s: %w", owner, err)
+		}
+		r.rules = append(r.rules, ownerRule{owner: owner, pattern: pattern})
+	}
+	return r, nil
+}
+
+// Owner returns who a transaction belongs to, or "" if unattributed.
+func (r *OwnerResolver) Owner(acct Account, payeeName string) string {
+	for _, rule := range r.rules {
+		if payeeName != "" && rule.pattern.MatchString(payeeName) {
+			return rule.owner
+		}
+	}
+	return r.meta.For(acct)["owner"]
+}
+
+// OwnerStats is a per-owner subtotal.
+type OwnerStats struct {
+	Owner        string `json:"owner"`
+	Transactions int    `json:"transactions"`
+	Sum          Money  `json:"sum"`
+}
+
+func sortedOwnerStats(m map[string]*OwnerStats) []OwnerStats {
+	var out []OwnerStats
+	for _, s := range m {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Owner < out[j].Owner })
+	return out
+}
+
+// WriteOwnersCSV writes one subtotal row per owner.
+func WriteOwnersCSV(path string, owners []OwnerStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"owner", "transactions", "sum"}); err != nil {
+		return err
+	}
+	for _, o := range owners {
+		if err := w.Write([]string{o.Owner, strconv.Itoa(o.Transactions), o.Sum.String()}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
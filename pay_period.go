@@ -0,0 +1,150 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PayPeriods divides time into pay periods for people who budget by
+// paycheck: weekly or biweekly, anchored to a payday. It is parsed from
+// PAY_PERIOD, e.g.
+//
+//	PAY_PERIOD=biweekly:2024-01-05
+type PayPeriods struct {
+	anchor Date
+	days   int
+}
+
+func parsePayPeriods(s string) (*PayPeriods, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	kind, anchor, ok := strings.Cut(strings.TrimSpace(s), ":")
+	days := map[string]int{"weekly": 7, "biweekly": 14}[kind]
+	if !ok || days == 0 {
+		return nil, fmt.Errorf("invalid PAY_PERIOD %q: expected weekly:YYYY-MM-DD or biweekly:YYYY-MM-DD", s)
+	}
+	d, err := ParseDate(anchor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PAY_PERIOD payday %q: %w", anchor, err)
+	}
+	return &PayPeriods{anchor: d, days: days}, nil
+}
+
+// Start returns the first day of the pay period d falls in.
+func (p *PayPeriods) Start(d Date) Date {
+	n := int(d.Sub(p.anchor.Time).Hours()/24) % p.days
+	if n < 0 {
+		// d is before the anchor
+		n += p.days
+	}
+	return d.AddDays(-n)
+}
+
+// End returns the last day of the pay period d falls in.
+func (p *PayPeriods) End(d Date) Date {
+	return p.Start(d).AddDays(p.days - 1)
+}
+
+// payPeriodTotals is a pay-periods report row's tally.
+type payPeriodTotals struct {
+	count         int
+	income, spent Money
+}
+
+// runPayPeriodsReport totals income and spending per PAY_PERIOD pay period,
+// the way people who budget by paycheck look at their money. Transfers
+// between accounts are left out. The scanned months are widened to whole
+// pay periods.
+func runPayPeriodsReport(args []string) {
+	fs := flag.NewFlagSet("report pay-periods", flag.ExitOnError)
+	var f reportFlags
+	var byFlag string
+	f.register(fs)
+	fs.StringVar(&byFlag, "by", "none", "Break each pay period down further: none, category")
+	fs.Parse(args) //nolint
+	f.validate()
+	switch byFlag {
+	case "none", "category":
+	default:
+		log.Fatalf("Invalid -by value %q: must be none or category", byFlag)
+	}
+
+	startDate, endDate, err := lookbackDates(f.from, f.to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := loadConfig(f.cfg)
+	if cfg.PayPeriods == nil {
+		log.Fatal("report pay-periods requires PAY_PERIOD, e.g. PAY_PERIOD=biweekly:2024-01-05")
+	}
+	start, _ := ParseDate(startDate)
+	end, _ := ParseDate(endDate)
+	start, end = cfg.PayPeriods.Start(start), cfg.PayPeriods.End(end)
+
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	categoryMap, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	// totals by pay period start, then by the -by breakdown
+	totals := make(map[string]map[string]*payPeriodTotals)
+	if err := forEachTransaction(client, accountsResp.Data, start.String(), end.String(), func(_ Account, txn Transaction) {
+		category, ok := categoryMap[txn.CategoryID]
+		if !ok && payeeMap[txn.PayeeID].TransferAccount != "" {
+			return
+		}
+		period := cfg.PayPeriods.Start(txn.Date).String()
+		var key string
+		if byFlag == "category" {
+			key = cmp.Or(category.Name, "Uncategorized")
+		}
+		if totals[period] == nil {
+			totals[period] = make(map[string]*payPeriodTotals)
+		}
+		t := totals[period][key]
+		if t == nil {
+			t = &payPeriodTotals{}
+			totals[period][key] = t
+		}
+		t.count++
+		if category.IsIncome {
+			t.income = t.income.Add(txn.Amount)
+		} else {
+			t.spent = t.spent.Add(txn.Amount)
+		}
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	header := []string{"pay_period", "end", "transactions", "income", "spent", "net"}
+	if byFlag != "none" {
+		header = slices.Insert(header, 2, byFlag)
+	}
+	var rows [][]string
+	for _, period := range slices.Sorted(maps.Keys(totals)) {
+		d, _ := ParseDate(period)
+		for _, key := range slices.Sorted(maps.Keys(totals[period])) {
+			t := totals[period][key]
+			row := []string{period, cfg.PayPeriods.End(d).String(), strconv.Itoa(t.count), t.income.String(), t.spent.String(), t.income.Add(t.spent).String()}
+			if byFlag != "none" {
+				row = slices.Insert(row, 2, key)
+			}
+			rows = append(rows, row)
+		}
+	}
+	slog.Info("Totaled pay periods", "from", start.String(), "to", end.String(), "periods", len(totals))
+	printReport(f.output, header, rows)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfile starts a pprof profile for mode ("cpu" or "mem", "" for none)
+// and returns a function that writes it to actual2csv.<mode>.pprof.
+func startProfile(mode string) (stop func(), err error) {
+	path := fmt.Sprintf("actual2csv.%s.pprof", mode)
+	switch mode {
+	case "":
+		return func() {}, nil
+	case "cpu":
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close() //nolint
+			return nil, err
+		}
+		return func() {
+			pprof.StopCPUProfile()
+			f.Close() //nolint
+			slog.Info("Wrote CPU profile", "path", path)
+		}, nil
+	case "mem":
+		return func() {
+			f, err := os.Create(path)
+			if err != nil {
+				slog.Warn("Failed to write memory profile", "err", err)
+				return
+			}
+			defer f.Close() //nolint
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				slog.Warn("Failed to write memory profile", "err", err)
+				return
+			}
+			slog.Info("Wrote memory profile", "path", path)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid -profile value %q: must be cpu or mem", mode)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressEvent is one line of -progress json. Type is always "progress", so
+// wrappers can tell the events apart from JSON logs on the same stream.
+type progressEvent struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Phase string    `json:"phase"` // start, fetch, then done or error; month precedes each file of -all and -year-files monthly
+	Range string    `json:"range"`
+	// Account and Month identify a fetch step.
+	Account   string `json:"account,omitempty"`
+	AccountID string `json:"account_id,omitempty"`
+	Month     string `json:"month,omitempty"`
+	// Step counts fetch steps (or months) done out of Steps.
+	Step  int `json:"step,omitempty"`
+	Steps int `json:"steps,omitempty"`
+	// Accounts is the number of accounts exported, set on start.
+	Accounts int `json:"accounts,omitempty"`
+	// Transactions counts the step's transactions; Total those so far.
+	Transactions int    `json:"transactions"`
+	Total        int    `json:"total"`
+	DurationMS   int64  `json:"duration_ms,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// progressReporter writes -progress json events. Its methods do nothing on a
+// nil reporter, so callers needn't check whether progress was requested.
+type progressReporter struct {
+	mu        sync.Mutex
+	enc       *json.Encoder
+	startedAt time.Time
+	total     int
+}
+
+func newProgressReporter(w io.Writer) *progressReporter {
+	return &progressReporter{enc: json.NewEncoder(w)}
+}
+
+func (p *progressReporter) emit(ev progressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ev.Type, ev.Time = "progress", time.Now()
+	p.enc.Encode(ev) //nolint
+}
+
+// Start begins an export of steps fetch steps over accounts accounts.
+func (p *progressReporter) Start(monthRange string, accounts, steps int) {
+	if p == nil {
+		return
+	}
+	p.startedAt, p.total = time.Now(), 0
+	p.emit(progressEvent{Phase: "start", Range: monthRange, Accounts: accounts, Steps: steps})
+}
+
+// Fetched reports a fetch step's transactions.
+func (p *progressReporter) Fetched(monthRange string, account Account, month string, step, steps, transactions int) {
+	if p == nil {
+		return
+	}
+	p.total += transactions
+	p.emit(progressEvent{Phase: "fetch", Range: monthRange, Account: account.Name, AccountID: account.ID, Month: month, Step: step, Steps: steps, Transactions: transactions, Total: p.total})
+}
+
+// Finish ends an export, successfully if err is nil.
+func (p *progressReporter) Finish(monthRange string, err error) {
+	if p == nil {
+		return
+	}
+	ev := progressEvent{Phase: "done", Range: monthRange, Total: p.total, DurationMS: time.Since(p.startedAt).Milliseconds()}
+	if err != nil {
+		ev.Phase, ev.Error = "error", err.Error()
+	}
+	p.emit(ev)
+}
+
+// Month reports the start of month step of steps in a multi-file export.
+func (p *progressReporter) Month(month string, step, steps int) {
+	if p == nil {
+		return
+	}
+	p.emit(progressEvent{Phase: "month", Range: month, Step: step, Steps: steps})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// publisher is a TransactionWriter that sends each transaction as a JSON
+// message to a message broker. Supported PUBLISH_URL schemes:
+//
+//	nats://[user:pass@]host:4222              NATS core publish to subject PUBLISH_TOPIC
+//	kafka+http(s)://host:8082[/base]          Kafka via the Confluent REST Proxy (v2 API)
+type publisher struct {
+	sink        messageSink
+	categoryMap map[string]Category
+	payeeMap    map[string]Payee
+}
+
+type messageSink interface {
+	Publish(key string, payloads [][]byte) error
+	Close() error
+}
+
+func NewPublisher(rawURL, topic string, categoryMap map[string]Category, payeeMap map[string]Payee) (*publisher, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("PUBLISH_TOPIC is required when PUBLISH_URL is set")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PUBLISH_URL: %w", err)
+	}
+
+	var sink messageSink
+	switch u.Scheme {
+	case "nats":
+		sink, err = dialNATS(u, topic)
+	case "kafka+http", "kafka+https":
+		u.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+		sink = &kafkaRESTSink{
+			url:    strings.TrimSuffix(u.String(), "/") + "/topics/" + url.PathEscape(topic),
+			client: &http.Client{Timeout: 30 * time.Second},
+		}
+	default:
+		err = fmt.Errorf("PUBLISH_URL has unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &publisher{sink: sink, categoryMap: categoryMap, payeeMap: payeeMap}, nil
+}
+
+func (p *publisher) WriteHeader() error { return nil }
+
+func (p *publisher) WritePlaceholder(date Date, note string) error { return nil }
+
+func (p *publisher) Add(acct Account, txns []Transaction) error {
+	if len(txns) == 0 {
+		return nil
+	}
+	payloads := make([][]byte, 0, len(txns))
+	for _, txn := range txns {
+		data, err := json.Marshal(enrichTransaction(acct, txn, p.categoryMap, p.payeeMap))
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, data)
+	}
+	if err := p.sink.Publish(acct.ID, payloads); err != nil {
+		return fmt.Errorf("publishing: %w", err)
+	}
+	return nil
+}
+
+func (p *publisher) Close() error {
+	return p.sink.Close()
+}
+
+// natsSink speaks the NATS client protocol directly; only PUB is needed.
+type natsSink struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	subject string
+}
+
+func dialNATS(u *url.URL, subject string) (*natsSink, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	s := &natsSink{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		subject: subject,
+	}
+
+	// the server greets with INFO before accepting CONNECT
+	if line, err := s.r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close() //nolint
+		return nil, fmt.Errorf("unexpected NATS greeting %q: %v", line, err)
+	}
+	opts := map[string]any{"verbose": false, "pedantic": false, "name": "actual2csv", "version": version}
+	if u.User != nil {
+		opts["user"] = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			opts["pass"] = pass
+		} else {
+			// a bare username is treated as a token
+			delete(opts, "user")
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	fmt.Fprintf(s.w, "CONNECT %s\r\n", connect)
+	if err := s.flush(); err != nil {
+		conn.Close() //nolint
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *natsSink) Publish(_ string, payloads [][]byte) error {
+	for _, payload := range payloads {
+		fmt.Fprintf(s.w, "PUB %s %d\r\n", s.subject, len(payload))
+		s.w.Write(payload)      //nolint
+		s.w.WriteString("\r\n") //nolint
+	}
+	return s.flush()
+}
+
+// flush sends buffered commands followed by a PING and waits for the PONG,
+// surfacing any -ERR the server sent in between.
+func (s *natsSink) flush() error {
+	s.w.WriteString("PING\r\n") //nolint
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.conn.SetReadDeadline(time.Now().Add(10 * time.Second)) //nolint
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("reading from NATS: %w", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "PONG"):
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS: %s", strings.TrimSpace(line))
+		case strings.HasPrefix(line, "PING"):
+			s.w.WriteString("PONG\r\n") //nolint
+			s.w.Flush()                 //nolint
+		}
+	}
+}
+
+func (s *natsSink) Close() error {
+	return s.conn.Close()
+}
+
+// kafkaRESTSink produces records through a Confluent REST Proxy.
+type kafkaRESTSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *kafkaRESTSink) Publish(key string, payloads [][]byte) error {
+	type record struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	body := struct {
+		Records []record `json:"records"`
+	}{}
+	for _, payload := range payloads {
+		body.Records = append(body.Records, record{Key: key, Value: payload})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *kafkaRESTSink) Close() error { return nil }
+
+// multiWriter fans each call out to several writers.
+type multiWriter []TransactionWriter
+
+func (m multiWriter) WriteHeader() error {
+	for _, w := range m {
+		if err := w.WriteHeader(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiWriter) Add(acct Account, txns []Transaction) error {
+	for _, w := range m {
+		if err := w.Add(acct, txns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiWriter) WritePlaceholder(date Date, note string) error {
+	for _, w := range m {
+		if err := w.WritePlaceholder(date, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiWriter) Flush(force bool) (bool, error) {
+	flushed := true
+	for _, w := range m {
+		if bw, ok := w.(bufferedWriter); ok {
+			ok, err := bw.Flush(force)
+			if err != nil {
+				return false, err
+			}
+			flushed = flushed && ok
+		}
+	}
+	return flushed, nil
+}
+
+func (m multiWriter) StartPeriod(start, end Date) {
+	for _, w := range m {
+		if pw, ok := w.(periodWriter); ok {
+			pw.StartPeriod(start, end)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Header names recognized in bank statements, lowercased, when no column
+// flag says otherwise.
+var (
+	statementDateHeaders        = []string{"date", "transaction date", "posting date", "posted date", "post date", "booking date", "value date"}
+	statementAmountHeaders      = []string{"amount", "transaction amount"}
+	statementDebitHeaders       = []string{"debit", "debits", "withdrawal", "withdrawals", "money out"}
+	statementCreditHeaders      = []string{"credit", "credits", "deposit", "deposits", "money in"}
+	statementDescriptionHeaders = []string{"description", "payee", "name", "details", "memo", "merchant"}
+)
+
+// statementDateLayouts are tried in order when -date-format isn't given.
+var statementDateLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "02.01.2006", "20060102"}
+
+// statementLine is a transaction from a bank statement.
+type statementLine struct {
+	line        int
+	date        Date
+	amount      Money
+	description string
+}
+
+// statementFormat locates the columns of a bank statement CSV and how to
+// read them.
+type statementFormat struct {
+	date, amount, debit, credit, description string
+	dateLayout                               string
+	delimiter                                rune
+	decimalComma, invert                     bool
+}
+
+// readStatement parses a bank statement CSV.
+func readStatement(path string, f statementFormat) ([]statementLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint
+	r := csv.NewReader(file)
+	r.Comma = f.delimiter
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	header := records[0]
+	column := func(flagName, name string, candidates []string) (int, error) {
+		if name != "" {
+			candidates = []string{name}
+		}
+		for i, h := range header {
+			if slices.Contains(candidates, strings.ToLower(strings.TrimSpace(h))) {
+				return i, nil
+			}
+		}
+		if name != "" {
+			return -1, fmt.Errorf("%s has no %q column", path, name)
+		}
+		return -1, fmt.Errorf("%s has no column like %q; name it with %s", path, candidates[0], flagName)
+	}
+	dateCol, err := column("-date-column", f.date, statementDateHeaders)
+	if err != nil {
+		return nil, err
+	}
+	descCol, _ := column("-description-column", f.description, statementDescriptionHeaders)
+	amountCol, err := column("-amount-column", f.amount, statementAmountHeaders)
+	debitCol, creditCol := -1, -1
+	if err != nil {
+		// statements with separate withdrawal and deposit columns
+		var debitErr, creditErr error
+		debitCol, debitErr = column("-debit-column", f.debit, statementDebitHeaders)
+		creditCol, creditErr = column("-credit-column", f.credit, statementCreditHeaders)
+		if debitErr != nil || creditErr != nil {
+			return nil, err
+		}
+	}
+
+	var lines []statementLine
+	for i, record := range records[1:] {
+		field := func(col int) string {
+			if col < 0 || col >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[col])
+		}
+		if field(dateCol) == "" {
+			continue
+		}
+		line := statementLine{line: i + 2, description: field(descCol)}
+		if line.date, err = parseStatementDate(field(dateCol), f.dateLayout); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line.line, err)
+		}
+		if amountCol >= 0 {
+			line.amount, err = parseStatementAmount(field(amountCol), f.decimalComma)
+		} else {
+			var debit, credit Money
+			if debit, err = parseStatementAmount(field(debitCol), f.decimalComma); err == nil {
+				credit, err = parseStatementAmount(field(creditCol), f.decimalComma)
+			}
+			line.amount = credit.Abs().Sub(debit.Abs())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line.line, err)
+		}
+		if f.invert {
+			line.amount = line.amount.Neg()
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// parseStatementDate parses a statement date with layout, a Go layout, or
+// else the first of statementDateLayouts that fits.
+func parseStatementDate(s, layout string) (Date, error) {
+	layouts := statementDateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return NewDate(t), nil
+		}
+	}
+	return Date{}, fmt.Errorf("unrecognized date %q; give its layout with -date-format", s)
+}
+
+// parseStatementAmount parses amounts as banks write them: with currency
+// symbols, thousands separators, or parentheses or a trailing minus for
+// negative amounts. Empty amounts are zero.
+func parseStatementAmount(s string, decimalComma bool) (Money, error) {
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg, s = true, s[1:len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		neg, s = true, strings.TrimSuffix(s, "-")
+	}
+	thousands, decimal := ",", "."
+	if decimalComma {
+		thousands, decimal = ".", ","
+	}
+	s = strings.ReplaceAll(s, thousands, "")
+	s = strings.Replace(s, decimal, ".", 1)
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) || r == '.' || r == '-' || r == '+' {
+			return r
+		}
+		return -1
+	}, s)
+	if s == "" {
+		return Money{}, nil
+	}
+	m, err := ParseMoney(s)
+	if err != nil {
+		return Money{}, err
+	}
+	if neg {
+		m = m.Neg()
+	}
+	return m, nil
+}
+
+// descriptionWords returns the lowercased words of at least three letters
+// or digits in s.
+func descriptionWords(s string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if len([]rune(w)) >= 3 {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// bankMatch pairs a statement line with an Actual transaction; either side
+// is nil for lines missing from Actual and transactions not on the statement.
+type bankMatch struct {
+	bank   *statementLine
+	actual *Transaction
+}
+
+// matchStatement pairs statement lines with transactions in two passes: equal
+// amounts dated at most window days apart, then, for amount mismatches,
+// transactions in the same direction on the same day or sharing a word of
+// the description and the payee. Each pass prefers the closest date.
+func matchStatement(lines []statementLine, txns []Transaction, window int, payeeNames func(Transaction) string) []bankMatch {
+	used := make([]bool, len(txns))
+	var matches []bankMatch
+	matched := make([]bool, len(lines))
+	pass := func(ok func(statementLine, Transaction) bool) {
+		for i, line := range lines {
+			if matched[i] {
+				continue
+			}
+			best, bestDays := -1, window+1
+			for j, txn := range txns {
+				days := int(line.date.Sub(txn.Date.Time).Abs().Hours() / 24)
+				if used[j] || days >= bestDays || !ok(line, txn) {
+					continue
+				}
+				best, bestDays = j, days
+			}
+			if best >= 0 {
+				used[best], matched[i] = true, true
+				matches = append(matches, bankMatch{&lines[i], &txns[best]})
+			}
+		}
+	}
+	pass(func(line statementLine, txn Transaction) bool { return line.amount == txn.Amount })
+	pass(func(line statementLine, txn Transaction) bool {
+		if line.amount.Sign() != txn.Amount.Sign() {
+			return false
+		}
+		if line.date.Equal(txn.Date.Time) {
+			return true
+		}
+		words := descriptionWords(payeeNames(txn))
+		return slices.ContainsFunc(descriptionWords(line.description), func(w string) bool { return slices.Contains(words, w) })
+	})
+	for i := range lines {
+		if !matched[i] {
+			matches = append(matches, bankMatch{bank: &lines[i]})
+		}
+	}
+	for j := range txns {
+		if !used[j] {
+			matches = append(matches, bankMatch{actual: &txns[j]})
+		}
+	}
+	return matches
+}
+
+// runReconcileBank compares an account with a bank statement CSV and lists
+// transactions missing from Actual, transactions not on the statement and
+// amount mismatches. It exits with status 1 when there are any.
+func runReconcileBank(args []string) {
+	fs := flag.NewFlagSet("reconcile-bank", flag.ExitOnError)
+	var cfgFlag configFlags
+	var statementFlag, accountFlag, outputFlag, delimiterFlag string
+	var format statementFormat
+	var windowFlag int
+	var allFlag bool
+	cfgFlag.register(fs)
+	fs.StringVar(&statementFlag, "statement", "", "Bank statement CSV to compare with")
+	fs.StringVar(&accountFlag, "account", "", "Actual account the statement belongs to, by name or ID")
+	fs.IntVar(&windowFlag, "window", 3, "Match transactions dated up to this many days apart, as banks post them later")
+	fs.StringVar(&outputFlag, "output", "table", "Output format: table, csv")
+	fs.BoolVar(&allFlag, "all", false, "Also list matched transactions")
+	fs.StringVar(&delimiterFlag, "delimiter", ",", "Field delimiter of the statement, e.g. ';' or tab")
+	fs.StringVar(&format.date, "date-column", "", "Statement column with the date (defaults to a column named like date or posting date)")
+	fs.StringVar(&format.amount, "amount-column", "", "Statement column with the signed amount (defaults to a column named amount)")
+	fs.StringVar(&format.debit, "debit-column", "", "Statement column with withdrawals, for statements without an amount column")
+	fs.StringVar(&format.credit, "credit-column", "", "Statement column with deposits, for statements without an amount column")
+	fs.StringVar(&format.description, "description-column", "", "Statement column with the description (defaults to a column named like description or payee)")
+	fs.StringVar(&format.dateLayout, "date-format", "", "Layout of statement dates as a Go reference date, e.g. 02/01/2006 for day/month/year (defaults to trying common layouts)")
+	fs.BoolVar(&format.decimalComma, "decimal-comma", false, "Statement amounts use a decimal comma, e.g. 1.234,56")
+	fs.BoolVar(&format.invert, "invert", false, "Flip the sign of statement amounts, for banks that show withdrawals as positive")
+	fs.Parse(args) //nolint
+	if statementFlag == "" || accountFlag == "" {
+		fmt.Fprintln(os.Stderr, "usage: actual2csv reconcile-bank -statement statement.csv -account <account> [-window 3] [-output table|csv]")
+		os.Exit(2)
+	}
+	switch outputFlag {
+	case "table", "csv":
+	default:
+		log.Fatalf("Invalid -output value %q: must be table or csv", outputFlag)
+	}
+	var err error
+	if format.delimiter, err = parseDelimiter(delimiterFlag); err != nil {
+		log.Fatal(err)
+	}
+
+	lines, err := readStatement(statementFlag, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(lines) == 0 {
+		log.Fatalf("%s has no transactions", statementFlag)
+	}
+	start, end := lines[0].date, lines[0].date
+	for _, line := range lines {
+		if line.date.Before(start) {
+			start = line.date
+		}
+		if line.date.After(end) {
+			end = line.date
+		}
+	}
+
+	cfg := loadConfig(cfgFlag)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+	account, err := findAccount(accountsResp.Data, accountFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// transactions just outside the statement may match lines posted later
+	txnResp, err := client.FetchTransactions(account.ID, start.AddDays(-windowFlag).String(), end.AddDays(windowFlag).String())
+	if err != nil {
+		log.Fatalf("Failed to fetch transactions: %v", err)
+	}
+	payeeNames := func(txn Transaction) string {
+		names := payeeMap[txn.PayeeID].Name
+		if txn.ImportedPayee != nil {
+			names += " " + *txn.ImportedPayee
+		}
+		return names
+	}
+
+	var rows [][]string
+	counts := make(map[string]int)
+	for _, m := range matchStatement(lines, txnResp.Data, windowFlag, payeeNames) {
+		var status string
+		switch {
+		case m.actual == nil:
+			status = "missing"
+		case m.bank == nil:
+			if m.actual.Date.Before(start) || m.actual.Date.After(end) {
+				continue
+			}
+			status = "extra"
+		case m.bank.amount != m.actual.Amount:
+			status = "amount-mismatch"
+		default:
+			status = "matched"
+		}
+		counts[status]++
+		if status == "matched" && !allFlag {
+			continue
+		}
+		row := []string{status, "", "", "", "", "", "", ""}
+		if m.bank != nil {
+			row[1], row[2], row[3], row[4] = strconv.Itoa(m.bank.line), m.bank.date.String(), m.bank.description, m.bank.amount.String()
+		}
+		if m.actual != nil {
+			row[5], row[6], row[7] = m.actual.Date.String(), payeeMap[m.actual.PayeeID].Name, m.actual.Amount.String()
+		}
+		rows = append(rows, row)
+	}
+	// by date, whichever side has one
+	date := func(row []string) string { return cmp.Or(row[2], row[5]) }
+	slices.SortStableFunc(rows, func(a, b []string) int { return strings.Compare(date(a), date(b)) })
+
+	slog.Info("Reconciled statement", "account", account.Name, "from", start.String(), "to", end.String(), "lines", len(lines),
+		"matched", counts["matched"], "missing", counts["missing"], "extra", counts["extra"], "amount_mismatch", counts["amount-mismatch"])
+	printReport(outputFlag, []string{"status", "line", "bank_date", "description", "bank_amount", "actual_date", "payee", "actual_amount"}, rows)
+	if counts["missing"]+counts["extra"]+counts["amount-mismatch"] > 0 {
+		os.Exit(1)
+	}
+}
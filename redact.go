@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Redaction maps CSV columns to how they are redacted in transaction rows:
+// drop empties the field and hash replaces it with a short keyed hash, so
+// equal values still group together. It is parsed from e.g. "payee=hash,notes=drop".
+type Redaction map[string]string
+
+func parseRedaction(s string) (Redaction, error) {
+	kv, err := parseKeyValues(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range slices.Sorted(maps.Keys(kv)) {
+		if action := kv[column]; action != "drop" && action != "hash" {
+			return nil, fmt.Errorf("invalid redaction %q for column %s: must be drop or hash", action, column)
+		}
+	}
+	return Redaction(kv), nil
+}
+
+// RedactionProfiles are named redactions from REDACTION_PROFILES, e.g.
+//
+//	REDACTION_PROFILES=accountant:payee=hash,notes=drop,raw_notes=drop;partner:notes=drop
+type RedactionProfiles map[string]Redaction
+
+func parseRedactionProfiles(s string) (RedactionProfiles, error) {
+	profiles := make(RedactionProfiles)
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid REDACTION_PROFILES entry %q: expected name:column=drop|hash,...", entry)
+		}
+		r, err := parseRedaction(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDACTION_PROFILES entry %q: %w", name, err)
+		}
+		profiles[name] = r
+	}
+	return profiles, nil
+}
+
+// checkKey reports profiles hashing columns without a key: unkeyed hashes of
+// payee names can be reversed by hashing a list of likely ones.
+func (p RedactionProfiles) checkKey(key string) error {
+	for _, name := range slices.Sorted(maps.Keys(p)) {
+		if p[name].hashes() && key == "" {
+			return fmt.Errorf("redaction profile %s hashes columns but REDACTION_KEY is unset", name)
+		}
+	}
+	return nil
+}
+
+// checkColumns reports profiles redacting columns that no export has.
+func (p RedactionProfiles) checkColumns(meta AccountMetadata, notes NotePatterns) error {
+	for _, name := range slices.Sorted(maps.Keys(p)) {
+		if err := p[name].checkColumns(meta, notes); err != nil {
+			return fmt.Errorf("redaction profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// resolveRedaction parses -redact: a REDACTION_PROFILES name or a
+// column=action list.
+func resolveRedaction(s string, profiles RedactionProfiles) (Redaction, error) {
+	if !strings.Contains(s, "=") {
+		r, ok := profiles[s]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction profile %q", s)
+		}
+		return r, nil
+	}
+	return parseRedaction(s)
+}
+
+// checkColumns reports redacted columns that no export has.
+func (r Redaction) checkColumns(meta AccountMetadata, notes NotePatterns) error {
+	known := knownColumns(meta, notes)
+	for _, column := range slices.Sorted(maps.Keys(r)) {
+		if !known[column] {
+			return fmt.Errorf("redaction names unknown column %q", column)
+		}
+	}
+	return nil
+}
+
+// apply redacts row in place; columns names its cells.
+func (r Redaction) apply(columns, row []string, key string) {
+	for i, column := range columns {
+		row[i] = r.value(column, row[i], key)
+	}
+}
+
+// value returns s redacted as column is.
+func (r Redaction) value(column, s, key string) string {
+	switch r[column] {
+	case "drop":
+		return ""
+	case "hash":
+		if s != "" {
+			return redactionHash(s, key)
+		}
+	}
+	return s
+}
+
+// hashes reports whether r hashes any column, which needs REDACTION_KEY.
+func (r Redaction) hashes() bool {
+	return slices.Contains(slices.Collect(maps.Values(r)), "hash")
+}
+
+// redactionHash is the first 12 hex digits of the HMAC-SHA256 of value.
+func redactionHash(value, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:12]
+}
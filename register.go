@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runRegister prints an account's transactions for one month with a running
+// balance, like Actual's register, without writing any files.
+func runRegister(args []string) {
+	fs := flag.NewFlagSet("register", flag.ExitOnError)
+	var cfgFlag configFlags
+	var monthFlag string
+	cfgFlag.register(fs)
+	fs.StringVar(&monthFlag, "month", "", "Month in YYYY-MM format (defaults to the current month)")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "usage: actual2csv register <account> [-month YYYY-MM] [-cfg configFilePath]")
+		os.Exit(2)
+	}
+	name := args[0]
+	fs.Parse(args[1:]) //nolint
+
+	month := time.Now().Local()
+	if monthFlag != "" {
+		var err error
+		if month, err = time.Parse("2006-01", monthFlag); err != nil {
+			log.Fatalf("Invalid -month value: %v", err)
+		}
+	}
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, -1)
+
+	cfg := loadConfig(cfgFlag)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+	account, err := findAccount(accountsResp.Data, name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	categoryMap, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opening, err := client.FetchBalance(account.ID, start.AddDate(0, 0, -1).Format(time.DateOnly))
+	if err != nil {
+		log.Fatalf("Failed to fetch opening balance: %v", err)
+	}
+	txnResp, err := client.FetchTransactions(account.ID, start.Format(time.DateOnly), end.Format(time.DateOnly))
+	if err != nil {
+		log.Fatalf("Failed to fetch transactions: %v", err)
+	}
+	txns := txnResp.Data
+	sort.SliceStable(txns, func(i, j int) bool { return txns[i].Date.Before(txns[j].Date) })
+
+	balance := opening.Data
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	// amounts are padded so they line up on the decimal point
+	fmt.Fprintf(tw, "DATE\tPAYEE\tCATEGORY\t%12s\t%12s\n", "AMOUNT", "BALANCE")
+	fmt.Fprintf(tw, "%s\tOpening balance\t\t%12s\t%12s\n", start.Format(time.DateOnly), "", balance)
+	for _, txn := range txns {
+		balance = balance.Add(txn.Amount)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%12s\t%12s\n", txn.Date, payeeMap[txn.PayeeID].Name, categoryMap[txn.CategoryID].Name, txn.Amount, balance)
+	}
+	fmt.Fprintf(tw, "%s\tClosing balance\t\t%12s\t%12s\n", end.Format(time.DateOnly), "", balance)
+	tw.Flush() //nolint
+}
+
+// findAccount matches an account by ID or case-insensitive name.
+func findAccount(accounts []Account, name string) (Account, error) {
+	var matches []Account
+	for _, account := range accounts {
+		if account.ID == name {
+			return account, nil
+		}
+		if strings.EqualFold(account.Name, name) {
+			matches = append(matches, account)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Account{}, fmt.Errorf("no account named %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return Account{}, fmt.Errorf("%d accounts are named %q; use the account ID instead", len(matches), name)
+	}
+}
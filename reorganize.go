@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runReorganize moves flat exports ({range}.csv and sidecars) in the output
+// directory into the configured OUTPUT_LAYOUT.
+func runReorganize(args []string) {
+	fs := flag.NewFlagSet("reorganize", flag.ExitOnError)
+	var cfgFlag configFlags
+	var dryRunFlag bool
+	cfgFlag.register(fs)
+	fs.BoolVar(&dryRunFlag, "dry-run", false, "List moves without performing them")
+	fs.Parse(args) //nolint
+
+	cfg := loadConfig(cfgFlag)
+	flat, _ := parseOutputLayout(defaultOutputLayout)
+
+	entries, err := os.ReadDir(cfg.TransactionOutputDir)
+	if err != nil {
+		log.Fatalf("Failed to read output directory: %v", err)
+	}
+
+	var moved int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		monthRange, _, base, ok := flat.Match(entry.Name())
+		if !ok {
+			continue
+		}
+		from, _, err := parseMonthRange(monthRange)
+		if err != nil {
+			continue
+		}
+		target, err := cfg.OutputLayout.Path(monthRange, from)
+		if err != nil {
+			slog.Info("Skipping file", "path", entry.Name(), "err", err)
+			continue
+		}
+		// carry the extension over so sidecars follow their CSV
+		target = strings.TrimSuffix(target, ".csv") + strings.TrimPrefix(entry.Name(), base)
+		if target == entry.Name() {
+			continue
+		}
+
+		src := filepath.Join(cfg.TransactionOutputDir, entry.Name())
+		dst := filepath.Join(cfg.TransactionOutputDir, target)
+		if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+			slog.Info("Skipping file, destination already exists", "path", src, "dest", dst)
+			continue
+		}
+		if dryRunFlag {
+			slog.Info("Would move file", "path", src, "dest", dst)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			log.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			log.Fatalf("Failed to move %s: %v", src, err)
+		}
+		slog.Info("Moved file", "path", src, "dest", dst)
+		moved++
+	}
+	slog.Info("Reorganized files", "count", moved)
+}
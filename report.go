@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func runReport(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "duplicate-payees":
+			runDuplicatePayeesReport(args[1:])
+			return
+		case "category-audit":
+			runCategoryAuditReport(args[1:])
+			return
+		case "trial-balance":
+			runTrialBalanceReport(args[1:])
+			return
+		case "compare":
+			runCompareReport(args[1:])
+			return
+		case "forecast":
+			runForecastReport(args[1:])
+			return
+		case "by-tag":
+			runByTagReport(args[1:])
+			return
+		case "round-up":
+			runRoundUpReport(args[1:])
+			return
+		case "pay-periods":
+			runPayPeriodsReport(args[1:])
+			return
+		}
+	}
+	fmt.Fprintln(os.Stderr, "usage: actual2csv report duplicate-payees|category-audit|trial-balance|compare|forecast|by-tag|round-up|pay-periods [flags]")
+	os.Exit(2)
+}
+
+// reportFlags are shared by the report subcommands.
+type reportFlags struct {
+	cfg              configFlags
+	from, to, output string
+}
+
+func (f *reportFlags) register(fs *flag.FlagSet) {
+	f.cfg.register(fs)
+	fs.StringVar(&f.from, "from", "", "First month to scan in YYYY-MM format (defaults to 12 months ago)")
+	fs.StringVar(&f.to, "to", "", "Last month to scan in YYYY-MM format (defaults to the current month)")
+	fs.StringVar(&f.output, "output", "table", "Output format: table, csv")
+}
+
+func (f *reportFlags) validate() {
+	switch f.output {
+	case "table", "csv":
+	default:
+		log.Fatalf("Invalid -output value %q: must be table or csv", f.output)
+	}
+}
+
+// forEachTransaction calls fn with every transaction of every account,
+// including closed ones, between startDate and endDate.
+func forEachTransaction(client ActualClient, accounts []Account, startDate, endDate string, fn func(Account, Transaction)) error {
+	for _, account := range accounts {
+		txnResp, err := client.FetchTransactions(account.ID, startDate, endDate)
+		if err != nil {
+			return fmt.Errorf("fetching transactions for account %s: %w", account.Name, err)
+		}
+		for _, txn := range txnResp.Data {
+			fn(account, txn)
+		}
+	}
+	return nil
+}
+
+// validateSourceOfTruth checks -source-of-truth: api takes budget figures
+// from the months endpoint, computed totals transactions.
+func validateSourceOfTruth(source string) {
+	switch source {
+	case "api", "computed":
+	default:
+		log.Fatalf("Invalid -source-of-truth value %q: must be api or computed", source)
+	}
+}
+
+// fetchBudgetMonth returns month's budget summary for -source-of-truth api,
+// warning about categories whose spending there disagrees with computed, the
+// totals by category ID from transactions. ok is false when the report has
+// to stick with computed totals. Income categories report what was received
+// rather than spent, so they are left to the transactions.
+func fetchBudgetMonth(client ActualClient, source, month string, computed map[string]Money) (_ BudgetMonth, ok bool, _ error) {
+	if source != "api" {
+		return BudgetMonth{}, false, nil
+	}
+	if !supports(client, CapMonths) {
+		slog.Warn("The server has no /months endpoint, computing totals from transactions", "month", month)
+		return BudgetMonth{}, false, nil
+	}
+	resp, err := client.FetchMonth(month)
+	if err != nil {
+		return BudgetMonth{}, false, fmt.Errorf("fetching budget month %s: %w", month, err)
+	}
+	for _, group := range resp.Data.CategoryGroups {
+		for _, category := range group.Categories {
+			if category.IsIncome {
+				continue
+			}
+			if spent := computed[category.ID]; spent != category.Spent {
+				slog.Warn("Budget month disagrees with transactions", "month", month, "category", category.Name, "api", category.Spent, "computed", spent)
+			}
+		}
+	}
+	return resp.Data, true, nil
+}
+
+// printReport writes rows to stdout as an aligned table or as CSV.
+func printReport(output string, header []string, rows [][]string) {
+	if output == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		if err := w.Write(header); err != nil {
+			log.Fatal(err)
+		}
+		if err := w.WriteAll(rows); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush() //nolint
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportSet is one export's CSV plus its sidecar files (manifest, stats).
+type exportSet struct {
+	base  string // path without extension, e.g. out/2024-06
+	end   time.Time
+	files []string
+	size  int64
+	// exporting is set while the export is being written or awaits a
+	// resume; its .partial and .savepoint files aren't in files
+	exporting bool
+}
+
+// listExports finds exports laid out under dir according to layout, oldest
+// first. Files still being written are left out.
+func listExports(dir string, layout outputLayout) ([]*exportSet, error) {
+	sets := make(map[string]*exportSet)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		_, end, relBase, ok := layout.Match(rel)
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		base := filepath.Join(dir, relBase)
+		set, ok := sets[base]
+		if !ok {
+			set = &exportSet{base: base, end: end}
+			sets[base] = set
+		}
+		if inProgress(rel) {
+			set.exporting = true
+			return nil
+		}
+		set.files = append(set.files, path)
+		set.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*exportSet
+	for _, set := range sets {
+		out = append(out, set)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].end.Equal(out[j].end) {
+			return out[i].end.Before(out[j].end)
+		}
+		return out[i].base < out[j].base
+	})
+	return out, nil
+}
+
+// pruneExports removes exports ending more than retainMonths months before now
+// and, if maxBytes > 0, the oldest remaining exports until the total size fits.
+// The export at keepBase and exports being written are never removed. With
+// dryRun, files are only listed.
+func pruneExports(dir string, layout outputLayout, now time.Time, retainMonths int, maxBytes int64, keepBase string, dryRun bool) error {
+	sets, err := listExports(dir, layout)
+	if err != nil {
+		return fmt.Errorf("listing exports: %w", err)
+	}
+
+	var total int64
+	for _, set := range sets {
+		total += set.size
+	}
+
+	cutoff := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -retainMonths+1, 0)
+	for _, set := range sets {
+		if set.base == keepBase || set.exporting {
+			continue
+		}
+		expired := retainMonths > 0 && set.end.Before(cutoff)
+		oversize := maxBytes > 0 && total > maxBytes
+		if !expired && !oversize {
+			continue
+		}
+		for _, path := range set.files {
+			if dryRun {
+				slog.Info("Would prune export", "path", path)
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("pruning %s: %w", path, err)
+			}
+			slog.Info("Pruned export", "path", path)
+		}
+		total -= set.size
+	}
+	return nil
+}
+
+// parseByteSize parses sizes like "500MB", "2G" or "1048576".
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult, s = 1<<10, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1<<20, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "G"):
+		mult, s = 1<<30, strings.TrimSuffix(s, "G")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// roundUpTotals is a round-up report row's tally.
+type roundUpTotals struct {
+	purchases, roundedUp int
+	spent, saved         Money
+}
+
+// roundUp returns how much rounding a purchase of amount up to the next
+// multiple of nearest would set aside; nothing for an exact multiple.
+func roundUp(amount, nearest Money) Money {
+	if rest := amount.Abs().Cents % nearest.Cents; rest != 0 {
+		return Money{Cents: nearest.Cents - rest}
+	}
+	return Money{}
+}
+
+// runRoundUpReport totals per month what rounding every purchase up to the
+// next dollar and saving the difference, as spare-change apps do, would have
+// put aside. Purchases are expenses: outflows that aren't transfers or in an
+// income category. A split transaction is one purchase.
+func runRoundUpReport(args []string) {
+	fs := flag.NewFlagSet("report round-up", flag.ExitOnError)
+	var f reportFlags
+	var nearestFlag string
+	var multiplierFlag int
+	f.register(fs)
+	fs.StringVar(&nearestFlag, "nearest", "1.00", "Round purchases up to the next multiple of this amount")
+	fs.IntVar(&multiplierFlag, "multiplier", 1, "Save this many times each round-up, like the boosts some apps offer")
+	fs.Parse(args) //nolint
+	f.validate()
+	nearest, err := ParseMoney(nearestFlag)
+	if err != nil || nearest.Sign() <= 0 {
+		log.Fatalf("Invalid -nearest value %q: must be a positive amount such as 1.00 or 5", nearestFlag)
+	}
+	if multiplierFlag < 1 {
+		log.Fatalf("Invalid -multiplier value %d: must be at least 1", multiplierFlag)
+	}
+
+	startDate, endDate, err := lookbackDates(f.from, f.to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	categoryMap, _, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	totals := make(map[string]*roundUpTotals)
+	if err := forEachTransaction(client, accountsResp.Data, startDate, endDate, func(_ Account, txn Transaction) {
+		if txn.Amount.Sign() >= 0 || txn.TransferID != nil || txn.IsChild || txn.StartingBalanceFlag || categoryMap[txn.CategoryID].IsIncome {
+			return
+		}
+		month := txn.Date.Format("2006-01")
+		if totals[month] == nil {
+			totals[month] = &roundUpTotals{}
+		}
+		t := totals[month]
+		t.purchases++
+		t.spent = t.spent.Add(txn.Amount.Abs())
+		if saved := roundUp(txn.Amount, nearest); saved.Sign() > 0 {
+			t.roundedUp++
+			t.saved = t.saved.Add(Money{Cents: saved.Cents * int64(multiplierFlag)})
+		}
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	header := []string{"month", "purchases", "rounded_up", "spent", "saved", "saved_percent", "running_total"}
+	var rows [][]string
+	var total roundUpTotals
+	var running Money
+	for _, month := range slices.Sorted(maps.Keys(totals)) {
+		t := totals[month]
+		running = running.Add(t.saved)
+		rows = append(rows, []string{month, strconv.Itoa(t.purchases), strconv.Itoa(t.roundedUp), t.spent.String(), t.saved.String(), roundUpPercent(t.saved, t.spent), running.String()})
+		total.purchases += t.purchases
+		total.roundedUp += t.roundedUp
+		total.spent = total.spent.Add(t.spent)
+		total.saved = total.saved.Add(t.saved)
+	}
+	rows = append(rows, []string{"total", strconv.Itoa(total.purchases), strconv.Itoa(total.roundedUp), total.spent.String(), total.saved.String(), roundUpPercent(total.saved, total.spent), running.String()})
+	slog.Info("Totaled round-ups", "from", startDate, "to", endDate, "nearest", nearest.String(), "purchases", total.purchases)
+	printReport(f.output, header, rows)
+}
+
+// roundUpPercent formats saved as a percentage of spent.
+func roundUpPercent(saved, spent Money) string {
+	if spent.Sign() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%%", float64(saved.Cents)/float64(spent.Cents)*100)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Savepoint records export progress so an interrupted run can resume.
+// Offset is the size of the partial output file after the last completed step;
+// anything written past it belongs to an unfinished step and is discarded on resume.
+type Savepoint struct {
+	Range        string          `json:"range"`
+	Offset       int64           `json:"offset"`
+	Transactions int             `json:"transactions"`
+	Done         map[string]bool `json:"done"`
+	// Stats is keyed by account ID so stats survive a resume.
+	Stats map[string]*AccountStats `json:"stats"`
+	// Owners holds per-owner subtotals when owner attribution is enabled.
+	Owners map[string]*OwnerStats `json:"owners,omitempty"`
+	// Spending holds expense totals by category name.
+	Spending map[string]Money `json:"spending,omitempty"`
+	// Largest holds the biggest outflows seen so far, largest first.
+	Largest []LargeExpense `json:"largest,omitempty"`
+	// CategoryMonths marks the categories with transactions in each month,
+	// keyed like Done, for -fill-gaps categories.
+	CategoryMonths map[string]bool `json:"category_months,omitempty"`
+	// Appended holds the dates of transactions exported for Seen, by ID.
+	Appended map[string]Date `json:"appended,omitempty"`
+	// Exported holds every transaction fetched, by ID, to record the
+	// exported months for retroactive change checks.
+	Exported map[string]closedTransaction `json:"exported,omitempty"`
+
+	path string
+}
+
+// LoadSavepoint reads the savepoint at path, returning an empty savepoint if none exists
+// or if the existing one was written for a different range. With an empty path the
+// savepoint is kept in memory only.
+func LoadSavepoint(path, monthRange string) (*Savepoint, error) {
+	sp := &Savepoint{
+		Range:          monthRange,
+		Done:           make(map[string]bool),
+		Stats:          make(map[string]*AccountStats),
+		Owners:         make(map[string]*OwnerStats),
+		Spending:       make(map[string]Money),
+		Appended:       make(map[string]Date),
+		Exported:       make(map[string]closedTransaction),
+		CategoryMonths: make(map[string]bool),
+		path:           path,
+	}
+
+	if path == "" {
+		return sp, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading savepoint: %w", err)
+	}
+
+	var saved Savepoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("decoding savepoint: %w", err)
+	}
+	if saved.Range != monthRange || saved.Done == nil {
+		return sp, nil
+	}
+	if saved.Stats == nil {
+		saved.Stats = make(map[string]*AccountStats)
+	}
+	if saved.Owners == nil {
+		saved.Owners = make(map[string]*OwnerStats)
+	}
+	if saved.Spending == nil {
+		saved.Spending = make(map[string]Money)
+	}
+	if saved.CategoryMonths == nil {
+		saved.CategoryMonths = make(map[string]bool)
+	}
+	if saved.Appended == nil {
+		saved.Appended = make(map[string]Date)
+	}
+	if saved.Exported == nil {
+		saved.Exported = make(map[string]closedTransaction)
+	}
+	saved.path = path
+	return &saved, nil
+}
+
+// Resuming reports whether any steps were completed by a previous run.
+func (s *Savepoint) Resuming() bool {
+	return len(s.Done) > 0
+}
+
+// InMemory reports whether the savepoint is never persisted.
+func (s *Savepoint) InMemory() bool {
+	return s.path == ""
+}
+
+func (s *Savepoint) IsDone(month, accountID string) bool {
+	return s.Done[savepointKey(month, accountID)]
+}
+
+// AccountStats returns the running stats for account, creating them if needed.
+func (s *Savepoint) AccountStats(account Account) *AccountStats {
+	stats, ok := s.Stats[account.ID]
+	if !ok {
+		stats = &AccountStats{AccountID: account.ID, Account: account.Name}
+		s.Stats[account.ID] = stats
+	}
+	return stats
+}
+
+// AddOwnerTotal adds txn to owner's running subtotal.
+func (s *Savepoint) AddOwnerTotal(owner string, txn Transaction) {
+	stats, ok := s.Owners[owner]
+	if !ok {
+		stats = &OwnerStats{Owner: owner}
+		s.Owners[owner] = stats
+	}
+	stats.Transactions++
+	stats.Sum = stats.Sum.Add(txn.Amount)
+}
+
+// AddSpending adds an expense transaction to its category's spending total.
+// Income categories, uncategorized transactions and inflows are ignored.
+func (s *Savepoint) AddSpending(category Category, txn Transaction) {
+	if category.ID == "" || category.IsIncome || txn.Amount.Sign() >= 0 {
+		return
+	}
+	s.Spending[category.Name] = s.Spending[category.Name].Sub(txn.Amount)
+}
+
+// AddExpense tracks txn among the run's largest outflows.
+func (s *Savepoint) AddExpense(account Account, payee, category string, txn Transaction) {
+	if txn.Amount.Sign() >= 0 {
+		return
+	}
+	s.Largest = keepLargest(s.Largest, LargeExpense{
+		Date:     txn.Date,
+		Account:  account.Name,
+		Payee:    payee,
+		Category: category,
+		Amount:   txn.Amount.Neg(),
+	}, summaryTopN)
+}
+
+// Mark records a completed step and persists the savepoint.
+func (s *Savepoint) Mark(month, accountID string, offset int64, transactions int) error {
+	s.Record(month, accountID, transactions)
+	return s.Checkpoint(offset)
+}
+
+// Record marks a step completed without persisting it, for steps whose output
+// is still buffered. A later Checkpoint persists it along with the new offset.
+func (s *Savepoint) Record(month, accountID string, transactions int) {
+	s.Done[savepointKey(month, accountID)] = true
+	s.Transactions += transactions
+}
+
+// Checkpoint persists every recorded step; offset must cover all of their output.
+func (s *Savepoint) Checkpoint(offset int64) error {
+	s.Offset = offset
+	return s.save()
+}
+
+func (s *Savepoint) Remove() error {
+	if s.InMemory() {
+		return nil
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Savepoint) save() error {
+	if s.InMemory() {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encoding savepoint: %w", err)
+	}
+	// write-then-rename so a crash never leaves a torn savepoint behind
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing savepoint: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("writing savepoint: %w", err)
+	}
+	return nil
+}
+
+func savepointKey(month, accountID string) string {
+	return month + "/" + accountID
+}
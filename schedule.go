@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ScheduleAmount is a schedule's amount. Schedules for an amount between two
+// bounds use their midpoint.
+type ScheduleAmount struct {
+	Money
+}
+
+func (a *ScheduleAmount) UnmarshalJSON(data []byte) error {
+	var between struct {
+		Num1 int64 `json:"num1"`
+		Num2 int64 `json:"num2"`
+	}
+	if err := json.Unmarshal(data, &between); err == nil {
+		a.Cents = (between.Num1 + between.Num2) / 2
+		return nil
+	}
+	return a.Money.UnmarshalJSON(data)
+}
+
+// ScheduleDate is a schedule's date: a single day, or a recurrence every
+// Interval days, weeks, months or years. Weekend adjustments and custom
+// patterns aren't modeled.
+type ScheduleDate struct {
+	Frequency string `json:"frequency"` // empty for a single day
+	Interval  int    `json:"interval"`
+	EndMode   string `json:"endMode"`
+	EndDate   Date   `json:"endDate"`
+}
+
+func (d *ScheduleDate) UnmarshalJSON(data []byte) error {
+	var day string
+	if err := json.Unmarshal(data, &day); err == nil {
+		*d = ScheduleDate{}
+		return nil
+	}
+	type recurrence ScheduleDate
+	var r recurrence
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("decoding schedule date: %w", err)
+	}
+	*d = ScheduleDate(r)
+	return nil
+}
+
+// Occurrences returns the days after from and up to through on which the
+// schedule is due, starting from NextDate.
+func (s Schedule) Occurrences(from, through Date) []Date {
+	if s.Completed || s.NextDate.IsZero() {
+		return nil
+	}
+	interval := max(s.Date.Interval, 1)
+	var days []Date
+	for d := s.NextDate; !d.After(through); {
+		if s.Date.EndMode == "on_date" && d.After(s.Date.EndDate) {
+			break
+		}
+		if d.After(from) {
+			days = append(days, d)
+		}
+		switch s.Date.Frequency {
+		case "daily":
+			d = d.AddDays(interval)
+		case "weekly":
+			d = d.AddDays(7 * interval)
+		case "monthly":
+			d = Date{d.AddDate(0, interval, 0)}
+		case "yearly":
+			d = Date{d.AddDate(interval, 0, 0)}
+		default:
+			return days
+		}
+	}
+	return days
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// unknownFields lists every JSON object key in data that has no matching
+// field in v's type, as dotted paths like "data[].imported_payee".
+func unknownFields(data []byte, v any) ([]string, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	collectUnknownFields(raw, reflect.TypeOf(v), "", seen)
+
+	fields := make([]string, 0, len(seen))
+	for f := range seen {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+func collectUnknownFields(raw any, t reflect.Type, path string, seen map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for key, value := range obj {
+			ft, ok := fields[strings.ToLower(key)]
+			if !ok {
+				seen[joinPath(path, key)] = true
+				continue
+			}
+			collectUnknownFields(value, ft, joinPath(path, key), seen)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := raw.([]any)
+		if !ok {
+			return
+		}
+		for _, elem := range arr {
+			collectUnknownFields(elem, t.Elem(), path+"[]", seen)
+		}
+	}
+}
+
+// jsonFields maps JSON names to field types the way encoding/json matches
+// them: case-insensitively, so names are lowercased.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// strictUnmarshal decodes data into v, failing with the full list of
+// unexpected fields if the API returned anything v doesn't model.
+func strictUnmarshal(data []byte, v any) error {
+	fields, err := unknownFields(data, v)
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		return fmt.Errorf("unexpected fields in API response (the API may have changed): %s", strings.Join(fields, ", "))
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+const searchIndexFilename = "search-index.json"
+
+// footerPayees are the payee labels of -balances footer rows, which aren't transactions.
+var footerPayees = []string{"Opening balance", "Total debits", "Total credits", "Closing balance"}
+
+// SearchRow is an exported transaction as read back from a CSV export.
+type SearchRow struct {
+	File     string `json:"file"`
+	Account  string `json:"account"`
+	Date     string `json:"date"`
+	Payee    string `json:"payee"`
+	Amount   string `json:"amount"`
+	Category string `json:"category"`
+	Notes    string `json:"notes"`
+}
+
+type fileStamp struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+}
+
+// searchIndex is an inverted index over every row of the CSV exports in the
+// output directory. It is rebuilt whenever an export is added, changed or removed.
+type searchIndex struct {
+	Files map[string]fileStamp `json:"files"`
+	Rows  []SearchRow          `json:"rows"`
+	Terms map[string][]int     `json:"terms"` // term -> indexes into Rows
+}
+
+// runSearch finds exported transactions whose account, payee, category or
+// notes contain every word of the query.
+func runSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	var cfgFlag configFlags
+	var outputFlag string
+	var yearFlag int
+	var reindexFlag bool
+	cfgFlag.register(fs)
+	fs.IntVar(&yearFlag, "year", 0, "Only show transactions from this year")
+	fs.StringVar(&outputFlag, "output", "table", "Output format: table, json")
+	fs.BoolVar(&reindexFlag, "reindex", false, "Rebuild the search index even if exports are unchanged")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, `usage: actual2csv search "query" [-year YYYY] [-output table|json] [-reindex] [-cfg configFilePath]`)
+		os.Exit(2)
+	}
+	query := args[0]
+	fs.Parse(args[1:]) //nolint
+	switch outputFlag {
+	case "table", "json":
+	default:
+		log.Fatalf("Invalid -output value %q: must be table or json", outputFlag)
+	}
+
+	cfg := loadConfig(cfgFlag)
+	if cfg.CacheDir == "" {
+		log.Fatal("search requires CACHE_DIR to store its index")
+	}
+	idx, err := loadSearchIndex(cfg, reindexFlag)
+	if err != nil {
+		log.Fatalf("Failed to load search index: %v", err)
+	}
+
+	year := ""
+	if yearFlag != 0 {
+		year = fmt.Sprintf("%04d-", yearFlag)
+	}
+	rows := idx.Search(query)
+	rows = slices.DeleteFunc(rows, func(r SearchRow) bool { return !strings.HasPrefix(r.Date, year) })
+
+	if outputFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if rows == nil {
+			rows = []SearchRow{}
+		}
+		if err := enc.Encode(rows); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tACCOUNT\tPAYEE\tCATEGORY\tAMOUNT\tNOTES")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Date, r.Account, r.Payee, r.Category, r.Amount, sanitizeNotes(r.Notes))
+	}
+	tw.Flush() //nolint
+}
+
+// loadSearchIndex returns the cached index, rebuilding it when the exports
+// it was built from have changed.
+func loadSearchIndex(cfg Config, rebuild bool) (*searchIndex, error) {
+	sets, err := listExports(cfg.TransactionOutputDir, cfg.OutputLayout)
+	if err != nil {
+		return nil, fmt.Errorf("listing exports: %w", err)
+	}
+	files := make(map[string]fileStamp)
+	for _, set := range sets {
+		path := set.base + ".csv"
+		if !slices.Contains(set.files, path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = fileStamp{ModTime: info.ModTime().UTC(), Size: info.Size()}
+	}
+
+	path := filepath.Join(cfg.CacheDir, searchIndexFilename)
+	if !rebuild {
+		var idx searchIndex
+		data, err := os.ReadFile(path)
+		if err == nil && json.Unmarshal(data, &idx) == nil && sameStamps(idx.Files, files) {
+			return &idx, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to read search index, rebuilding", "err", err)
+		}
+	}
+
+	idx := &searchIndex{Files: files, Terms: make(map[string][]int)}
+	seen := make(map[SearchRow]int)
+	// newest exports first, so overlapping exports resolve to the latest data
+	for i := len(sets) - 1; i >= 0; i-- {
+		file := sets[i].base + ".csv"
+		if _, ok := files[file]; !ok {
+			continue
+		}
+		if err := idx.addFile(cfg, file, seen); err != nil {
+			return nil, fmt.Errorf("indexing %s: %w", file, err)
+		}
+	}
+	slog.Info("Indexed exports", "count", len(idx.Rows), "exports", len(files))
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.CacheDir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		slog.Warn("Failed to save search index", "err", err)
+	}
+	return idx, nil
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !w.ModTime.Equal(v.ModTime) || w.Size != v.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// addFile indexes the transaction rows of one export. seen counts the rows
+// already indexed from newer exports, which are skipped as many times as they
+// were seen there; identical rows within one export, like two coffees on the
+// same day, are all kept.
+func (idx *searchIndex) addFile(cfg Config, path string, seen map[SearchRow]int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint
+
+	// exports may use another -delimiter; guess it from the header line
+	br := bufio.NewReader(f)
+	var skipped strings.Builder
+	line, err := br.ReadString('\n')
+	for err == nil && strings.HasPrefix(line, "#") {
+		skipped.WriteString(line)
+		line, err = br.ReadString('\n')
+	}
+	skipped.WriteString(line)
+	r := csv.NewReader(io.MultiReader(strings.NewReader(skipped.String()), br))
+	r.Comma = sniffDelimiter(line)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// map localized or renamed headers back to their column keys
+	col := make(map[string]int)
+	for i, name := range header {
+		for _, h := range columnNames() {
+			if name == h || name == cfg.HeaderNames[h] {
+				col[h] = i
+			}
+		}
+	}
+	field := func(record []string, h string) string {
+		if i, ok := col[h]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	count := make(map[SearchRow]int)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		row := SearchRow{
+			Account:  field(record, "account"),
+			Date:     field(record, "date"),
+			Payee:    field(record, "payee"),
+			Amount:   searchAmount(field(record, "amount"), field(record, "debit"), field(record, "credit")),
+			Category: field(record, "category"),
+			Notes:    field(record, "notes"),
+		}
+		if row.Category == "" && slices.Contains(footerPayees, row.Payee) {
+			continue
+		}
+		if count[row]++; count[row] <= seen[row] {
+			continue
+		}
+		row.File = path
+		idx.Rows = append(idx.Rows, row)
+		n := len(idx.Rows) - 1
+		for _, term := range uniqueTerms(row.Account, row.Payee, row.Category, row.Notes) {
+			idx.Terms[term] = append(idx.Terms[term], n)
+		}
+	}
+	for row, n := range count {
+		seen[row] = max(seen[row], n)
+	}
+	return nil
+}
+
+// Search returns rows containing every term of query, newest first.
+func (idx *searchIndex) Search(query string) []SearchRow {
+	terms := uniqueTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	hits := make(map[int]int)
+	for _, term := range terms {
+		for _, n := range idx.Terms[term] {
+			hits[n]++
+		}
+	}
+	var rows []SearchRow
+	for n, count := range hits {
+		if count == len(terms) {
+			rows = append(rows, idx.Rows[n])
+		}
+	}
+	slices.SortFunc(rows, func(a, b SearchRow) int { return strings.Compare(b.Date, a.Date) })
+	return rows
+}
+
+// uniqueTerms splits text into lowercase words.
+func uniqueTerms(texts ...string) []string {
+	var terms []string
+	for _, text := range texts {
+		for _, term := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}) {
+			if !slices.Contains(terms, term) {
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// sniffDelimiter returns whichever of comma, semicolon and tab occurs most
+// in a CSV header line, preferring comma.
+func sniffDelimiter(header string) rune {
+	delim := ','
+	for _, d := range []rune{';', '\t'} {
+		if strings.Count(header, string(d)) > strings.Count(header, string(delim)) {
+			delim = d
+		}
+	}
+	return delim
+}
+
+// searchAmount returns the signed amount of an export row, which
+// -debit-credit splits into positive debit and credit columns.
+func searchAmount(amount, debit, credit string) string {
+	switch {
+	case amount != "":
+		return amount
+	case debit != "":
+		return "-" + debit
+	}
+	return credit
+}
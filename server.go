@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxWebhookBytes bounds inbound webhook bodies.
+const maxWebhookBytes = 1 << 20
+
+// runServe starts server mode. Arguments after the flags are passed to every
+// triggered export, e.g. `actual2csv serve -addr :8080 -- -stats -latest symlink`,
+// but not to API exports, whose scope they could widen.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var cfgFlag configFlags
+	var addrFlag string
+	cfgFlag.register(fs)
+	fs.StringVar(&addrFlag, "addr", ":8080", "Address to listen on")
+	fs.Parse(args) //nolint
+
+	cfg := loadConfig(cfgFlag)
+	if cfg.WebhookSecret == "" && cfg.UIPassword == "" && len(cfg.APITokens) == 0 {
+		log.Fatal("serve requires WEBHOOK_SECRET, UI_PASSWORD or API_TOKENS")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate executable: %v", err)
+	}
+	runner, err := newExportRunner(exe, append(append([]string{"export"}, cfgFlag.args()...), fs.Args()...), filepath.Join(cfg.TransactionOutputDir, jobsFilename))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n") //nolint
+	})
+	if cfg.WebhookSecret != "" {
+		mux.Handle("POST /webhook", webhookHandler(cfg.WebhookSecret, runner.Trigger))
+	}
+	if len(cfg.APITokens) > 0 {
+		mux.Handle("GET /api/export", apiExportHandler(cfg.APITokens, exe, append([]string{"export"}, cfgFlag.args()...)))
+	}
+	if cfg.UIPassword != "" {
+		mux.Handle("/", newWebUI(cfg, runner))
+		slog.Info("Web UI enabled", "addr", addrFlag)
+	}
+
+	slog.Info("Listening", "addr", addrFlag)
+	log.Fatal(http.ListenAndServe(addrFlag, mux))
+}
+
+// webhookHandler accepts webhooks from bank-sync pipelines or Actual
+// automations and calls trigger, answering 503 if it refuses the job.
+// Requests must carry the secret either as X-Webhook-Secret or as an
+// X-Signature-256 "sha256=<hex>" HMAC of the body.
+func webhookHandler(secret string, trigger func(reason string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+		if err != nil {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !validWebhook(secret, r.Header, body) {
+			http.Error(w, "invalid webhook secret or signature", http.StatusUnauthorized)
+			return
+		}
+		if err := trigger("webhook from " + r.RemoteAddr); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func validWebhook(secret string, h http.Header, body []byte) bool {
+	if s := h.Get("X-Webhook-Secret"); s != "" {
+		return subtle.ConstantTimeCompare([]byte(s), []byte(secret)) == 1
+	}
+	sig, ok := strings.CutPrefix(h.Get("X-Signature-256"), "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
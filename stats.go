@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// AccountStats summarizes what an export did with one account's transactions.
+type AccountStats struct {
+	AccountID string            `json:"account_id"`
+	Account   string            `json:"account"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Fetched   int               `json:"fetched"`
+	Filtered  int               `json:"filtered"`
+	Written   int               `json:"written"`
+	Fixme     int               `json:"fixme"`
+	MinDate   Date              `json:"min_date,omitzero"`
+	MaxDate   Date              `json:"max_date,omitzero"`
+	Sum       Money             `json:"sum"`     // of written transactions
+	Debits    Money             `json:"debits"`  // sum of outflows (negative)
+	Credits   Money             `json:"credits"` // sum of inflows
+}
+
+// Observe records a written transaction. fixme marks rows that were written
+// with unresolved references.
+func (s *AccountStats) Observe(txn Transaction, fixme bool) {
+	s.Written++
+	s.Sum = s.Sum.Add(txn.Amount)
+	if txn.Amount.Sign() < 0 {
+		s.Debits = s.Debits.Add(txn.Amount)
+	} else {
+		s.Credits = s.Credits.Add(txn.Amount)
+	}
+	if fixme {
+		s.Fixme++
+	}
+	if s.MinDate.IsZero() || txn.Date.Before(s.MinDate) {
+		s.MinDate = txn.Date
+	}
+	if txn.Date.After(s.MaxDate) {
+		s.MaxDate = txn.Date
+	}
+}
+
+// RunManifest describes a completed export. It is written next to the CSV.
+type RunManifest struct {
+	Version      string         `json:"version"`
+	Range        string         `json:"range"`
+	Output       string         `json:"output,omitempty"` // empty when -empty none wrote nothing
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   time.Time      `json:"finished_at"`
+	Transactions int            `json:"transactions"`
+	Accounts     []AccountStats `json:"accounts"`
+	Owners       []OwnerStats   `json:"owners,omitempty"`
+}
+
+func (m RunManifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+var statsHeaders = []string{
+	"account_id",
+	"account",
+	"fetched",
+	"filtered",
+	"written",
+	"fixme",
+	"min_date",
+	"max_date",
+	"sum",
+}
+
+// WriteStatsCSV writes one row of stats per account.
+func WriteStatsCSV(path string, stats []AccountStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint
+
+	w := csv.NewWriter(f)
+	if err := w.Write(statsHeaders); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		if err := w.Write([]string{
+			s.AccountID,
+			s.Account,
+			strconv.Itoa(s.Fetched),
+			strconv.Itoa(s.Filtered),
+			strconv.Itoa(s.Written),
+			strconv.Itoa(s.Fixme),
+			s.MinDate.String(),
+			s.MaxDate.String(),
+			s.Sum.String(),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// summaryTopN is how many categories and expenses a text summary lists.
+const summaryTopN = 3
+
+// LargeExpense is one of the biggest outflows of a run, kept for summaries.
+type LargeExpense struct {
+	Date     Date   `json:"date"`
+	Account  string `json:"account"`
+	Payee    string `json:"payee"`
+	Category string `json:"category,omitempty"`
+	Amount   Money  `json:"amount"` // positive
+}
+
+// summaryWriter backs -format text-summary. Transactions are tallied in the
+// savepoint as the run progresses, so the writer itself has nothing to stream.
+type summaryWriter struct{}
+
+func (summaryWriter) WriteHeader() error                  { return nil }
+func (summaryWriter) Add(Account, []Transaction) error    { return nil }
+func (summaryWriter) WritePlaceholder(Date, string) error { return nil }
+
+// textSummary renders a run as short plain sentences. The first line fits in
+// an SMS; the rest lists top categories and the biggest expenses. Amounts and
+// dates are spelled out without symbols so screen readers read them naturally.
+func textSummary(msgs messages, period string, sp *Savepoint) string {
+	if sp.Transactions == 0 {
+		return msgs.Sprintf("summary.none", period) + "\n"
+	}
+	var in, out Money
+	for _, stats := range sp.Stats {
+		in = in.Add(stats.Credits)
+		out = out.Sub(stats.Debits)
+	}
+
+	var b strings.Builder
+	b.WriteString(msgs.Sprintf("summary.totals",
+		period, sp.Transactions, in, out, describeNet(msgs, in.Sub(out))) + "\n")
+
+	if items := spendingItems(msgs, sp.Spending); len(items) > 0 {
+		var parts []string
+		for _, item := range items[:min(summaryTopN, len(items))] {
+			parts = append(parts, fmt.Sprintf("%s %s", item.Label, item.Value))
+		}
+		b.WriteString(msgs.Sprintf("summary.top", joinWords(msgs, parts)) + "\n")
+	}
+
+	if len(sp.Largest) > 0 {
+		var parts []string
+		for _, e := range sp.Largest {
+			parts = append(parts, msgs.Sprintf("summary.expense", e.Amount, e.Payee, msgs.Date(e.Date), e.Account))
+		}
+		b.WriteString(msgs.Sprintf("summary.biggest", joinWords(msgs, parts)) + "\n")
+	}
+	return b.String()
+}
+
+func describeNet(msgs messages, net Money) string {
+	switch net.Sign() {
+	case 1:
+		return msgs.Sprintf("summary.saving", net)
+	case -1:
+		return msgs.Sprintf("summary.overspending", net.Neg())
+	default:
+		return msgs.Sprintf("summary.even")
+	}
+}
+
+// joinWords joins items as "a, b and c".
+func joinWords(msgs messages, items []string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + msgs.Sprintf("list.and") + " " + items[len(items)-1]
+}
+
+// keepLargest inserts e into largest, keeping at most n entries in descending order.
+func keepLargest(largest []LargeExpense, e LargeExpense, n int) []LargeExpense {
+	i := sort.Search(len(largest), func(i int) bool { return largest[i].Amount.Cents < e.Amount.Cents })
+	if i >= n {
+		return largest
+	}
+	largest = append(largest, LargeExpense{})
+	copy(largest[i+1:], largest[i:])
+	largest[i] = e
+	if len(largest) > n {
+		largest = largest[:n]
+	}
+	return largest
+}
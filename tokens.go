@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiFormats are the formats the export API can return.
+var apiFormats = []string{"csv", "text-summary"}
+
+// apiToken is a serve API token and what it may export. Tokens are parsed
+// from API_TOKENS, with | separating list items, e.g.
+//
+//	API_TOKENS=partner:token=s3cret,accounts=Joint Checking|Joint Visa;accountant:token=t0ken,formats=csv,redact=accountant
+//
+// Empty lists don't restrict: every account, every API format and, for
+// budgets, BUDGET_SYNC_ID only. Redact names a REDACTION_PROFILES profile
+// applied to every export of the token, which limits it to CSV.
+type apiToken struct {
+	Name     string
+	Token    string
+	Budgets  []string
+	Accounts []string
+	Formats  []string
+	Redact   string
+}
+
+func parseAPITokens(s string) ([]apiToken, error) {
+	var tokens []apiToken
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, pairs, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid API_TOKENS entry %q: expected name:token=...,key=value,...", entry)
+		}
+		kv, err := parseKeyValues(pairs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_TOKENS entry %q: %w", name, err)
+		}
+		t := apiToken{Name: name}
+		for k, v := range kv {
+			switch k {
+			case "token":
+				t.Token = v
+			case "budgets":
+				t.Budgets = splitTokenList(v)
+				for _, b := range t.Budgets {
+					if !syncIDPattern.MatchString(b) {
+						return nil, fmt.Errorf("API token %s: budget %q is not a sync ID", name, b)
+					}
+				}
+			case "accounts":
+				t.Accounts = splitTokenList(v)
+			case "formats":
+				t.Formats = splitTokenList(v)
+				for _, f := range t.Formats {
+					if !slices.Contains(apiFormats, f) {
+						return nil, fmt.Errorf("API token %s: unsupported format %q, must be csv or text-summary", name, f)
+					}
+				}
+			case "redact":
+				t.Redact = v
+			default:
+				return nil, fmt.Errorf("API token %s: unknown key %q, must be token, budgets, accounts, formats or redact", name, k)
+			}
+		}
+		if t.Token == "" {
+			return nil, fmt.Errorf("API token %s has no token", name)
+		}
+		if t.Redact != "" {
+			// text summaries name payees and aren't redacted
+			if len(t.Formats) == 0 {
+				t.Formats = []string{"csv"}
+			} else if slices.Contains(t.Formats, "text-summary") {
+				return nil, fmt.Errorf("API token %s: redacted tokens can only export csv", name)
+			}
+		}
+		for _, other := range tokens {
+			if other.Name == name || other.Token == t.Token {
+				return nil, fmt.Errorf("API token %s duplicates the name or token of %s", name, other.Name)
+			}
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// splitTokenList parses a | separated API_TOKENS list.
+func splitTokenList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// scope checks an export request against the token, returning the budget
+// and accounts to export. An empty budget means BUDGET_SYNC_ID.
+func (t apiToken) scope(budget, format string, accounts []string) (string, []string, error) {
+	switch {
+	case budget == "" && len(t.Budgets) > 0:
+		budget = t.Budgets[0]
+	case budget != "" && !slices.Contains(t.Budgets, budget):
+		return "", nil, fmt.Errorf("budget %q is not available to this token", budget)
+	}
+	if len(t.Formats) > 0 && !slices.Contains(t.Formats, format) {
+		return "", nil, fmt.Errorf("format %q is not available to this token", format)
+	}
+	if len(t.Accounts) == 0 {
+		return budget, accounts, nil
+	}
+	if len(accounts) == 0 {
+		return budget, t.Accounts, nil
+	}
+	for _, account := range accounts {
+		if !slices.Contains(t.Accounts, account) {
+			return "", nil, fmt.Errorf("account %q is not available to this token", account)
+		}
+	}
+	return budget, accounts, nil
+}
+
+// apiExportHandler serves GET /api/export?from=2024-01&to=2024-03, returning
+// the export in the response body. Requests authenticate with one of tokens as
+// a bearer token and may ask for a budget, format and accounts within its
+// scope. Exports run as child processes writing to stdout, so they leave the
+// output directory alone, skip the publisher, closed month checks and
+// category alerts, and don't queue behind webhook exports.
+func apiExportHandler(tokens []apiToken, exe string, baseArgs []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var token *apiToken
+		for i := range tokens {
+			if subtle.ConstantTimeCompare([]byte(bearer), []byte(tokens[i].Token)) == 1 {
+				token = &tokens[i]
+			}
+		}
+		if token == nil {
+			http.Error(w, "missing or invalid API token", http.StatusUnauthorized)
+			return
+		}
+
+		q := r.URL.Query()
+		args := append(slices.Clone(baseArgs), "-output", "-", "-check-closed=false")
+		for _, name := range []string{"from", "to"} {
+			value := q.Get(name)
+			if value == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01", value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s month %q", name, value), http.StatusBadRequest)
+				return
+			}
+			args = append(args, "-"+name, value)
+		}
+		format := q.Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		if !slices.Contains(apiFormats, format) {
+			http.Error(w, fmt.Sprintf("invalid format %q, must be csv or text-summary", format), http.StatusBadRequest)
+			return
+		}
+		budget, accounts, err := token.scope(q.Get("budget"), format, splitList(q.Get("accounts")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		args = append(args, "-format", format)
+		if token.Redact != "" {
+			args = append(args, "-redact", token.Redact)
+		}
+		if len(accounts) > 0 {
+			args = append(args, "-accounts", strings.Join(accounts, ","))
+		}
+
+		var out bytes.Buffer
+		cmd := exec.CommandContext(r.Context(), exe, args...)
+		cmd.Stdout = &out
+		cmd.Stderr = os.Stderr
+		cmd.Env = os.Environ()
+		if budget != "" {
+			cmd.Env = append(cmd.Env, "BUDGET_SYNC_ID="+budget)
+		}
+		slog.Info("Starting API export", "token", token.Name, "budget", budget, "format", format, "accounts", strings.Join(accounts, ","), "redact", token.Redact)
+		startedAt := time.Now()
+		if err := cmd.Run(); err != nil {
+			slog.Warn("API export failed", "token", token.Name, "err", err)
+			http.Error(w, "export failed; the server log has the details", http.StatusBadGateway)
+			return
+		}
+		slog.Info("Finished API export", "token", token.Name, "bytes", out.Len(), "duration", time.Since(startedAt))
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		out.WriteTo(w) //nolint
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiTransport describes how to reach ACTUAL_API_URL. Besides plain http(s)
+// URLs it understands:
+//
+//	unix:///run/actual-http-api.sock?path=/v1  HTTP over a unix domain socket
+//	h2c://localhost:5007/v1                    HTTP/2 without TLS
+type apiTransport struct {
+	baseURL    string // HTTP base URL requests are built from
+	socketPath string // non-empty for unix:// URLs
+	h2c        bool
+}
+
+func parseAPITransport(raw string) (apiTransport, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return apiTransport{}, fmt.Errorf("parsing ACTUAL_API_URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return apiTransport{baseURL: strings.TrimSuffix(raw, "/")}, nil
+	case "unix":
+		if u.Path == "" {
+			return apiTransport{}, fmt.Errorf("ACTUAL_API_URL %q is missing a socket path", raw)
+		}
+		// the host is never dialed; it only needs to form a valid URL
+		return apiTransport{
+			baseURL:    "http://localhost" + strings.TrimSuffix(u.Query().Get("path"), "/"),
+			socketPath: u.Path,
+		}, nil
+	case "h2c":
+		u.Scheme = "http"
+		return apiTransport{
+			baseURL: strings.TrimSuffix(u.String(), "/"),
+			h2c:     true,
+		}, nil
+	default:
+		return apiTransport{}, fmt.Errorf("ACTUAL_API_URL has unsupported scheme %q", u.Scheme)
+	}
+}
+
+func (t apiTransport) roundTripper() http.RoundTripper {
+	if t.socketPath == "" && !t.h2c {
+		return http.DefaultTransport
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t.socketPath != "" {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", t.socketPath)
+		}
+	}
+	if t.h2c {
+		var protocols http.Protocols
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = &protocols
+	}
+	return transport
+}
+
+// rateLimitTransport spaces requests at least interval apart across every
+// goroutine sharing the client, so parallel fetches can't overload the server.
+type rateLimitTransport struct {
+	base     http.RoundTripper
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request
+}
+
+func newRateLimitTransport(base http.RoundTripper, perSecond float64) *rateLimitTransport {
+	return &rateLimitTransport{base: base, interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	now := time.Now()
+	start := now
+	if t.next.After(now) {
+		start = t.next
+	}
+	t.next = start.Add(t.interval)
+	t.mu.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func runTx(args []string) {
+	if len(args) == 0 {
+		txUsage()
+	}
+	switch args[0] {
+	case "get":
+		runTxGet(args[1:])
+	case "search":
+		runTxSearch(args[1:])
+	default:
+		txUsage()
+	}
+}
+
+func txUsage() {
+	fmt.Fprintln(os.Stderr, "usage: actual2csv tx get <id> [flags]")
+	fmt.Fprintln(os.Stderr, "       actual2csv tx search [-payee X] [-amount Y] [flags]")
+	os.Exit(2)
+}
+
+// txFlags are shared by the tx subcommands.
+type txFlags struct {
+	cfg              configFlags
+	from, to, output string
+}
+
+func (f *txFlags) register(fs *flag.FlagSet) {
+	f.cfg.register(fs)
+	fs.StringVar(&f.from, "from", "", "First month to scan in YYYY-MM format (defaults to 12 months ago)")
+	fs.StringVar(&f.to, "to", "", "Last month to scan in YYYY-MM format (defaults to the current month)")
+	fs.StringVar(&f.output, "output", "table", "Output format: table, json")
+}
+
+// runTxGet prints the transaction with the given ID. The API has no lookup
+// by ID, so accounts are scanned over the -from/-to months.
+func runTxGet(args []string) {
+	fs := flag.NewFlagSet("tx get", flag.ExitOnError)
+	var f txFlags
+	f.register(fs)
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		txUsage()
+	}
+	id := args[0]
+	fs.Parse(args[1:]) //nolint
+
+	matches := scanTransactions(f, func(txn EnrichedTransaction) bool { return txn.ID == id })
+	if len(matches) == 0 {
+		log.Fatalf("Transaction %s not found; widen the scanned months with -from/-to", id)
+	}
+	printTransactions(f.output, matches)
+}
+
+// runTxSearch prints transactions matching every given filter.
+func runTxSearch(args []string) {
+	fs := flag.NewFlagSet("tx search", flag.ExitOnError)
+	var f txFlags
+	var payeeFlag, amountFlag string
+	f.register(fs)
+	fs.StringVar(&payeeFlag, "payee", "", "Payee name, matched case-insensitively as a substring")
+	fs.StringVar(&amountFlag, "amount", "", "Amount, e.g. 12.34; unsigned amounts match inflows and outflows")
+	fs.Parse(args) //nolint
+
+	if payeeFlag == "" && amountFlag == "" {
+		log.Fatal("tx search requires -payee and/or -amount")
+	}
+	var amount Money
+	if amountFlag != "" {
+		var err error
+		if amount, err = ParseMoney(amountFlag); err != nil {
+			log.Fatalf("Invalid -amount value %q: %v", amountFlag, err)
+		}
+	}
+	signed := strings.HasPrefix(amountFlag, "-") || strings.HasPrefix(amountFlag, "+")
+	payee := strings.ToLower(payeeFlag)
+
+	matches := scanTransactions(f, func(txn EnrichedTransaction) bool {
+		if amountFlag != "" && txn.Amount != amount && (signed || txn.Amount != amount.Neg()) {
+			return false
+		}
+		if payee != "" && !strings.Contains(strings.ToLower(txn.Payee), payee) {
+			return false
+		}
+		return true
+	})
+	printTransactions(f.output, matches)
+}
+
+// scanTransactions fetches every account's transactions in the flagged range,
+// including closed accounts, and returns those accepted by match.
+func scanTransactions(f txFlags, match func(EnrichedTransaction) bool) []EnrichedTransaction {
+	switch f.output {
+	case "table", "json":
+	default:
+		log.Fatalf("Invalid -output value %q: must be table or json", f.output)
+	}
+	startDate, endDate, err := lookbackDates(f.from, f.to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := loadConfig(f.cfg)
+	client := NewActualClient(cfg, newHTTPClient(cfg))
+	categoryMap, payeeMap, err := fetchNameMaps(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountsResp, err := client.FetchAccounts()
+	if err != nil {
+		log.Fatalf("Failed to fetch accounts: %v", err)
+	}
+
+	var matches []EnrichedTransaction
+	for _, account := range accountsResp.Data {
+		txnResp, err := client.FetchTransactions(account.ID, startDate, endDate)
+		if err != nil {
+			log.Fatalf("Failed to fetch transactions for account %s: %v", account.Name, err)
+		}
+		for _, txn := range txnResp.Data {
+			if t := enrichTransaction(account, txn, categoryMap, payeeMap); match(t) {
+				matches = append(matches, t)
+			}
+		}
+	}
+	return matches
+}
+
+func printTransactions(output string, txns []EnrichedTransaction) {
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if txns == nil {
+			txns = []EnrichedTransaction{}
+		}
+		if err := enc.Encode(txns); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tACCOUNT\tPAYEE\tCATEGORY\tAMOUNT\tNOTES")
+	for _, t := range txns {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Date, t.Account, t.Payee, t.Category, t.Amount, sanitizeNotes(t.Notes))
+	}
+	tw.Flush() //nolint
+}
+
+// lookbackDates turns optional -from/-to months into the first and last day
+// they cover, defaulting to the last 12 months.
+func lookbackDates(fromMonth, toMonth string) (startDate, endDate string, err error) {
+	now := time.Now().Local()
+	from, to := now.AddDate(0, -12, 0), now
+	if fromMonth != "" {
+		if from, err = time.Parse("2006-01", fromMonth); err != nil {
+			return "", "", fmt.Errorf("invalid -from value: %w", err)
+		}
+	}
+	if toMonth != "" {
+		if to, err = time.Parse("2006-01", toMonth); err != nil {
+			return "", "", fmt.Errorf("invalid -to value: %w", err)
+		}
+	}
+	startDate = from.Format("2006-01") + "-01"
+	endDate = time.Date(to.Year(), to.Month()+1, 0, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+	return startDate, endDate, nil
+}
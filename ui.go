@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webUI is serve's browser frontend for people who don't use the CLI: it
+// lists past exports for download, queues new ones and shows the job
+// history, which is also available as JSON under /api/jobs. Every request
+// needs UI_PASSWORD as the HTTP basic auth password; the user name is
+// only logged.
+type webUI struct {
+	cfg    Config
+	runner *exportRunner
+}
+
+func newWebUI(cfg Config, runner *exportRunner) http.Handler {
+	ui := &webUI{cfg: cfg, runner: runner}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", ui.index)
+	mux.HandleFunc("GET /files/{path...}", ui.file)
+	mux.HandleFunc("POST /run", ui.run)
+	mux.HandleFunc("POST /jobs/{id}/retry", ui.retry)
+	mux.HandleFunc("GET /api/jobs", ui.apiJobs)
+	mux.HandleFunc("POST /api/jobs/{id}/retry", ui.retry)
+	// basic auth credentials ride along on cross-site requests too
+	return ui.auth(http.NewCrossOriginProtection().Handler(mux))
+}
+
+func (ui *webUI) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(ui.cfg.UIPassword)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="actual2csv"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uiExport is an export as listed by the web UI.
+type uiExport struct {
+	Name  string
+	Files []uiFile
+}
+
+type uiFile struct {
+	Name string
+	Path string // relative to TRANSACTION_OUTPUT_DIR, with slashes
+	Size int64
+}
+
+// exports lists the exports in the output directory, newest first.
+func (ui *webUI) exports() ([]uiExport, error) {
+	dir := ui.cfg.TransactionOutputDir
+	sets, err := listExports(dir, ui.cfg.OutputLayout)
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]uiExport, 0, len(sets))
+	for _, set := range slices.Backward(sets) {
+		name, _ := filepath.Rel(dir, set.base)
+		export := uiExport{Name: filepath.ToSlash(name)}
+		for _, path := range set.files {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			rel, _ := filepath.Rel(dir, path)
+			export.Files = append(export.Files, uiFile{Name: filepath.Base(path), Path: filepath.ToSlash(rel), Size: info.Size()})
+		}
+		if len(export.Files) == 0 {
+			// a first export of the range, still running
+			continue
+		}
+		exports = append(exports, export)
+	}
+	return exports, nil
+}
+
+func (ui *webUI) index(w http.ResponseWriter, r *http.Request) {
+	exports, err := ui.exports()
+	if err != nil {
+		slog.Warn("Failed to list exports", "err", err)
+		http.Error(w, "failed to list exports", http.StatusInternalServerError)
+		return
+	}
+	jobs := ui.runner.Jobs()
+	busy := slices.ContainsFunc(jobs, func(job exportJob) bool { return job.State == jobQueued || job.State == jobRunning })
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	uiTemplate.Execute(w, map[string]any{ //nolint
+		"Busy":    busy,
+		"Jobs":    jobs[:min(len(jobs), 20)],
+		"Exports": exports,
+		"Month":   time.Now().Format("2006-01"),
+	})
+}
+
+// file downloads one of the listed export files; nothing else in the output
+// directory is served.
+func (ui *webUI) file(w http.ResponseWriter, r *http.Request) {
+	exports, err := ui.exports()
+	if err != nil {
+		slog.Warn("Failed to list exports", "err", err)
+		http.Error(w, "failed to list exports", http.StatusInternalServerError)
+		return
+	}
+	path := r.PathValue("path")
+	for _, export := range exports {
+		for _, f := range export.Files {
+			if f.Path == path {
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.Name))
+				http.ServeFile(w, r, filepath.Join(ui.cfg.TransactionOutputDir, filepath.FromSlash(path)))
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// run queues an export of the picked months and format.
+func (ui *webUI) run(w http.ResponseWriter, r *http.Request) {
+	var flags []string
+	for _, name := range []string{"from", "to"} {
+		value := r.FormValue(name)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01", value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s month %q", name, value), http.StatusBadRequest)
+			return
+		}
+		flags = append(flags, "-"+name, value)
+	}
+	switch format := r.FormValue("format"); format {
+	case "csv", "text-summary":
+		flags = append(flags, "-format", format)
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+	if _, err := ui.runner.Run(uiReason(r), flags); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// retry queues a failed job again, answering the API with the new job.
+func (ui *webUI) retry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	job, err := ui.runner.Retry(id, uiReason(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job) //nolint
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (ui *webUI) apiJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ui.runner.Jobs()) //nolint
+}
+
+// uiReason names the user behind a request in the job history.
+func uiReason(r *http.Request) string {
+	if user, _, _ := r.BasicAuth(); user != "" {
+		return "web UI (" + user + ")"
+	}
+	return "web UI"
+}
+
+var uiTemplate = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"size": func(n int64) string {
+		switch {
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+		case n >= 1<<10:
+			return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+		}
+		return fmt.Sprintf("%d B", n)
+	},
+}).Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if .Busy}}<meta http-equiv="refresh" content="5">{{end}}
+<title>actual2csv</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; }
+table { border-collapse: collapse; width: 100%; }
+td, th { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; }
+.failed { color: #b00; }
+form.inline { display: inline; }
+</style>
+</head>
+<body>
+<h1>actual2csv</h1>
+
+<h2>New export</h2>
+<form method="post" action="/run">
+<label>From <input type="month" name="from" value="{{.Month}}"></label>
+<label>To <input type="month" name="to" value="{{.Month}}"></label>
+<label>Format <select name="format">
+<option value="csv">CSV</option>
+<option value="text-summary">Text summary</option>
+</select></label>
+<button type="submit">Export</button>
+</form>
+
+{{if .Jobs}}
+<h2>Jobs</h2>
+<table>
+<tr><th>#</th><th>State</th><th>Requested by</th><th>Flags</th><th>Queued</th><th>Finished</th></tr>
+{{range .Jobs}}
+<tr>
+<td>{{.ID}}</td>
+<td{{if eq .State "failed"}} class="failed"{{end}}>{{.State}}{{if .RetryOf}} (retry of #{{.RetryOf}}){{end}}
+{{if .Error}}<br>{{.Error}}{{end}}
+{{if eq .State "failed"}}<form class="inline" method="post" action="/jobs/{{.ID}}/retry"><button type="submit">Retry</button></form>{{end}}</td>
+<td>{{.Reason}}</td>
+<td>{{range .Flags}}{{.}} {{end}}</td>
+<td>{{.Created.Format "2006-01-02 15:04"}}</td>
+<td>{{if not .Finished.IsZero}}{{.Finished.Format "2006-01-02 15:04"}}{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+
+<h2>Exports</h2>
+{{if .Exports}}
+<table>
+<tr><th>Export</th><th>Files</th></tr>
+{{range .Exports}}
+<tr><td>{{.Name}}</td><td>{{range .Files}}<a href="/files/{{.Path}}">{{.Name}}</a> ({{size .Size}})<br>{{end}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No exports yet.</p>
+{{end}}
+</body>
+</html>
+`))
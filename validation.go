@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// syncIDPattern matches budget sync IDs, which Actual generates as UUIDs.
+var syncIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validationErrors collects every configuration problem so they can be
+// reported together instead of one per run.
+type validationErrors []string
+
+// Add records a problem with a hint on how to fix it.
+func (v *validationErrors) Add(problem, hint string) {
+	if hint != "" {
+		problem += " (" + hint + ")"
+	}
+	*v = append(*v, problem)
+}
+
+// Check records err, if any, with a hint on how to fix it.
+func (v *validationErrors) Check(err error, hint string) {
+	if err != nil {
+		v.Add(err.Error(), hint)
+	}
+}
+
+// Fatal exits listing every recorded problem, if there are any.
+func (v validationErrors) Fatal() {
+	if len(v) == 0 {
+		return
+	}
+	log.Fatalf("Found %d configuration problem(s):\n  - %s", len(v), strings.Join(v, "\n  - "))
+}
+
+func validateAPIURL(raw string) error {
+	if _, err := parseAPITransport(raw); err != nil {
+		return err
+	}
+	u, _ := url.Parse(raw)
+	if u.Scheme != "unix" && u.Host == "" {
+		return fmt.Errorf("ACTUAL_API_URL %q is missing a host", raw)
+	}
+	return nil
+}
+
+// checkWritableDir verifies that files can be created in dir, creating it if needed.
+func checkWritableDir(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("TRANSACTION_OUTPUT_DIR %q cannot be created: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".actual2csv-write-test-*")
+	if err != nil {
+		return fmt.Errorf("TRANSACTION_OUTPUT_DIR %q is not writable: %w", dir, err)
+	}
+	f.Close()           //nolint
+	os.Remove(f.Name()) //nolint
+	return nil
+}
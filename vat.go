@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// VATRates maps tax-inclusive categories (by name or ID) to their VAT/GST
+// rate in percent, parsed from VAT_RATES, e.g. "Office Supplies=19;Food=7".
+type VATRates map[string]float64
+
+func parseVATRates(s string) (VATRates, error) {
+	rates := make(VATRates)
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		category, rate, ok := strings.Cut(entry, "=")
+		category = strings.TrimSpace(category)
+		r, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(rate), "%"), 64)
+		if !ok || category == "" || err != nil || r < 0 {
+			return nil, fmt.Errorf("invalid VAT_RATES entry %q: expected category=percent", entry)
+		}
+		rates[category] = r
+	}
+	return rates, nil
+}
+
+// Split breaks a gross amount into net and tax for category.
+// Categories without a rate are treated as untaxed.
+func (v VATRates) Split(category Category, gross Money) (net, tax Money) {
+	rate, ok := v[category.ID]
+	if !ok {
+		rate, ok = v[category.Name]
+	}
+	if !ok || category.ID == "" {
+		return gross, Money{Currency: gross.Currency}
+	}
+	net = Money{Cents: int64(math.Round(float64(gross.Cents) / (1 + rate/100))), Currency: gross.Currency}
+	return net, gross.Sub(net)
+}
@@ -0,0 +1,65 @@
+package main
+
+// TransactionWriter is implemented by every output format.
+// Add is called once per (account, month) step, in order.
+type TransactionWriter interface {
+	WriteHeader() error
+	Add(Account, []Transaction) error
+	// WritePlaceholder writes a zero-amount row so empty periods still produce data.
+	WritePlaceholder(date Date, note string) error
+}
+
+// transactionStreamer is implemented by writers that take transactions one at
+// a time as the export checks them, rather than a step's worth through Add,
+// which they ignore. Other writers, such as publishers, still get Add.
+type transactionStreamer interface {
+	WriteTransaction(Account, Transaction) error
+}
+
+// periodWriter is implemented by writers that need to know which date range
+// the following Add call covers.
+type periodWriter interface {
+	StartPeriod(start, end Date)
+}
+
+// BalanceSummary is an account's statement totals for the exported period.
+type BalanceSummary struct {
+	StartDate Date
+	EndDate   Date
+	Opening   Money
+	Debits    Money
+	Credits   Money
+	Closing   Money
+}
+
+// footerWriter is implemented by writers that can append per-account balance footers.
+type footerWriter interface {
+	WriteBalanceFooter(Account, BalanceSummary) error
+}
+
+// gapWriter is implemented by writers that can mark an account or category
+// without transactions in the period starting on date, for -fill-gaps.
+type gapWriter interface {
+	WriteGap(account, category string, date Date) error
+}
+
+// FlushPolicy controls how long buffered writers hold rows before writing them
+// to the output. A zero policy writes after every step; otherwise rows are held
+// until either limit is reached, which cuts writes on slow or network filesystems.
+type FlushPolicy struct {
+	Rows  int
+	Bytes int64
+}
+
+// defaultFlushPolicy keeps a few megabytes at most in memory; on a local disk
+// it performs like per-step flushing and needs far fewer writes on network
+// filesystems (see BenchmarkWriteFile:
+// `go test -run '^$' -bench WriteFile -args -dir /mnt/nas`).
+var defaultFlushPolicy = FlushPolicy{Rows: 10000, Bytes: 1 << 20}
+
+// bufferedWriter is implemented by writers that hold rows across steps. Flush
+// writes them out if the policy says so, or unconditionally with force, and
+// reports whether nothing is left buffered.
+type bufferedWriter interface {
+	Flush(force bool) (bool, error)
+}